@@ -8,26 +8,188 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/williamkoller/golang-payment-stripe/internal/app/cardtesting"
+	"github.com/williamkoller/golang-payment-stripe/internal/app/jobs"
+	"github.com/williamkoller/golang-payment-stripe/internal/app/ports"
 	"github.com/williamkoller/golang-payment-stripe/internal/app/saga"
 	"github.com/williamkoller/golang-payment-stripe/internal/app/service"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/customer"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/dispute"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/notification"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/risk"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/captcha"
 	"github.com/williamkoller/golang-payment-stripe/internal/infra/config"
 	"github.com/williamkoller/golang-payment-stripe/internal/infra/http/router"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/http/webhook"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/idempotency"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/inbox"
 	"github.com/williamkoller/golang-payment-stripe/internal/infra/logger"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/notifier"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/outbox"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/publisher"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/repo/eventstore"
 	"github.com/williamkoller/golang-payment-stripe/internal/infra/repo/memory"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/repo/sqlrepo"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/riskrules"
 	stripeinfra "github.com/williamkoller/golang-payment-stripe/internal/infra/stripe"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/velocity"
 )
 
 func main() {
 	cfg := config.Load()
 	zl := logger.New(cfg)
 
-	repo := memory.NewPaymentRepo()
+	var (
+		repo      payment.Repository
+		ob        outbox.Store
+		idem      idempotency.Store
+		customers customer.Repository
+		ib        inbox.Store
+		disputes  dispute.Repository
+		qs        cardtesting.Store
+		notices   notification.Repository
+	)
+	switch cfg.RepoDriver {
+	case "sqlite", "eventstore":
+		db, err := sqlrepo.Open("sqlite", cfg.DatabaseDSN)
+		if err != nil {
+			zl.Sugar().Fatalw("database_open", "error", err)
+		}
+		defer db.Close()
+		repo = sqlrepo.NewPaymentRepo(db)
+		if cfg.RepoDriver == "eventstore" {
+			// pagamentos como streams em payment_events; as projeções de
+			// leitura são reconstruídas dos eventos na inicialização
+			es, err := eventstore.NewPaymentRepo(sqlrepo.NewEventStore(db))
+			if err != nil {
+				zl.Sugar().Fatalw("eventstore_rebuild", "error", err)
+			}
+			repo = es
+		}
+		ob = sqlrepo.NewOutboxStore(db)
+		idem = sqlrepo.NewIdempotencyStore(db)
+		customers = sqlrepo.NewCustomerRepo(db)
+		ib = sqlrepo.NewInboxStore(db)
+		disputes = sqlrepo.NewDisputeRepo(db)
+		qs = sqlrepo.NewQuarantineStore(db)
+		notices = sqlrepo.NewNotificationRepo(db)
+	default:
+		ob = outbox.NewMemoryStore()
+		repo = memory.NewPaymentRepo(ob)
+		idem = idempotency.NewMemoryStore()
+		customers = memory.NewCustomerRepo()
+		ib = inbox.NewMemoryStore()
+		disputes = memory.NewDisputeRepo()
+		qs = cardtesting.NewMemoryStore()
+		notices = memory.NewNotificationRepo()
+	}
 	stripeClient := stripeinfra.NewClient(cfg, zl)
+	if cfg.AdminAPIToken == "" {
+		zl.Sugar().Warnw("admin_api_disabled", "reason", "ADMIN_API_TOKEN is not set")
+	}
 
-	paymentSaga := saga.NewPaymentSaga(zl, repo, stripeClient, cfg)
-	paymentSvc := service.NewPaymentService(zl, repo, paymentSaga)
+	loc, err := time.LoadLocation(cfg.RiskTimezone)
+	if err != nil {
+		zl.Sugar().Fatalw("risk_timezone", "error", err)
+	}
+	velocityAction := risk.Outcome(cfg.VelocityAction)
+	if velocityAction != risk.Deny && velocityAction != risk.Review {
+		zl.Sugar().Fatalw("velocity_action", "error", "VELOCITY_ACTION must be deny or review")
+	}
+	velocityCounter := velocity.NewCounter(cfg.VelocityWindow)
+	velocityLimits := velocity.Limits{
+		Email:  velocity.Limit{Count: cfg.VelocityEmailMaxCount, Sum: cfg.VelocityEmailMaxSum},
+		IP:     velocity.Limit{Count: cfg.VelocityIPMaxCount, Sum: cfg.VelocityIPMaxSum},
+		Card:   velocity.Limit{Count: cfg.VelocityCardMaxCount, Sum: cfg.VelocityCardMaxSum},
+		Action: velocityAction,
+	}
+	velocityRules := velocity.NewRules(velocityCounter, velocityLimits)
+	cardRule := risk.CardRule{
+		BlockedBINs:      cfg.RiskBlockedBINs,
+		BlockedCountries: cfg.RiskBlockedCountries,
+		ReviewCountries:  cfg.RiskReviewCountries,
+	}
+	baseRisk := risk.NewEngine(append([]risk.Rule{
+		risk.AmountLimit{Review: cfg.RiskReviewAmount, Deny: cfg.RiskMaxAmount},
+		risk.EmailBlocklist{Emails: cfg.RiskBlockedEmails, Domains: cfg.RiskBlockedDomains},
+		cardRule,
+		risk.TimeOfDay{
+			Start: cfg.RiskNightStart, End: cfg.RiskNightEnd, Location: loc,
+			MaxAmount: cfg.RiskNightMaxAmount, Outcome: risk.Review,
+		},
+	}, velocityRules...)...)
+	var riskEngine ports.RiskEngine = baseRisk
+	var riskRules *riskrules.Engine
+	if cfg.RiskRulesFile != "" {
+		riskRules, err = riskrules.NewEngine(zl, baseRisk, velocityCounter, cfg.RiskRulesFile, cfg.RiskRulesCheckInterval)
+		if err != nil {
+			zl.Sugar().Fatalw("risk_rules", "error", err)
+		}
+		riskEngine = riskRules
+	}
+
+	paymentSaga := saga.NewPaymentSaga(zl, repo, stripeClient, riskEngine, cfg)
+	guardAction := cardtesting.Action(cfg.CardTestingAction)
+	if !guardAction.Valid() {
+		zl.Sugar().Fatalw("card_testing_action", "error", "CARD_TESTING_ACTION must be block or captcha")
+	}
+	var captchaVerifier cardtesting.Captcha
+	if guardAction == cardtesting.ActionCaptcha {
+		if cfg.CaptchaSecret == "" {
+			zl.Sugar().Fatalw("card_testing_action", "error", "CARD_TESTING_ACTION=captcha requires CAPTCHA_SECRET")
+		}
+		captchaVerifier = captcha.NewVerifier(&http.Client{Timeout: 5 * time.Second}, cfg.CaptchaVerifyURL, cfg.CaptchaSecret)
+	}
+	guard := cardtesting.NewGuard(zl, qs, cardtesting.Config{
+		Window:         cfg.CardTestingWindow,
+		MinAttempts:    cfg.CardTestingMinAttempts,
+		DeclineRatio:   cfg.CardTestingDeclineRatio,
+		LowAmount:      cfg.CardTestingLowAmount,
+		LowAmountBurst: cfg.CardTestingLowAmountBurst,
+		Quarantine:     cfg.CardTestingQuarantine,
+		Action:         guardAction,
+	}, captchaVerifier)
+	paymentSvc := service.NewPaymentService(zl, repo, paymentSaga, customers, guard)
+	customerSvc := service.NewCustomerService(zl, customers, stripeClient, repo)
+	disputeSvc := service.NewDisputeService(zl, disputes, repo, stripeClient)
+	reviewSvc := service.NewReviewService(zl, repo, paymentSaga, cfg.ReviewSLA)
+
+	bg, stopBG := context.WithCancel(context.Background())
+	defer stopBG()
+
+	dispatcher := notifier.NewDispatcher(zl, notices, &http.Client{Timeout: cfg.MerchantWebhookTimeout}, cfg)
+	notificationSvc := service.NewNotificationService(zl, notices, dispatcher)
+	go dispatcher.Run(bg)
+
+	relay := outbox.NewRelay(zl, ob, publisher.Multi{publisher.NewLog(zl), dispatcher}, cfg)
+	go relay.Run(bg)
+
+	// cartão confirmado no frontend: só conhecido depois da autorização
+	cardChecks := []webhook.CardCheck{risk.RuleCheck{Rule: cardRule}, velocity.NewCardCheck(velocityCounter, velocityLimits)}
+	stripeWebhook := webhook.NewStripeWebhook(zl, stripeClient, repo, disputeSvc,
+		stripeClient, cardChecks, guard, ib, cfg)
+	go stripeWebhook.Run(bg)
+
+	go jobs.NewDisputeDeadlines(zl, disputeSvc, cfg).Run(bg)
+
+	authExpiry, err := jobs.NewAuthorizationExpiry(zl, repo, paymentSaga, cfg)
+	if err != nil {
+		zl.Sugar().Fatalw("auth_expiry_config", "error", err)
+	}
+	go authExpiry.Run(bg)
+
+	reviewSLA, err := jobs.NewReviewSLA(zl, repo, paymentSaga, cfg)
+	if err != nil {
+		zl.Sugar().Fatalw("review_sla_config", "error", err)
+	}
+	go reviewSLA.Run(bg)
+
+	if riskRules != nil {
+		go riskRules.Run(bg)
+	}
 
-	engine := router.Build(zl, cfg, paymentSvc, stripeClient, repo)
+	engine := router.Build(zl, cfg, paymentSvc, notificationSvc, customerSvc, disputeSvc, reviewSvc, stripeWebhook, ob, idem, ib, guard)
 
 	srv := &http.Server{
 		Addr:              ":" + cfg.HTTPPort,
@@ -49,5 +211,6 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	_ = srv.Shutdown(ctx)
+	stopBG()
 	zl.Sugar().Info("server_stopped")
 }
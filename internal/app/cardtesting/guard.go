@@ -0,0 +1,241 @@
+package cardtesting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/pkg/ulidx"
+	"go.uber.org/zap"
+)
+
+// Config são os limiares de detecção; valores na unidade menor de cada moeda,
+// com "*" valendo para as demais.
+type Config struct {
+	Window         time.Duration
+	MinAttempts    int     // tentativas mínimas para avaliar a taxa de recusa
+	DeclineRatio   float64 // recusadas / tentativas
+	LowAmount      map[string]int64
+	LowAmountBurst int // recusas de valor baixo por IP na janela
+	Quarantine     time.Duration
+	Action         Action
+}
+
+type attempt struct {
+	at       time.Time
+	declined bool
+	low      bool
+}
+
+// Captcha confirma o desafio resolvido por quem está numa quarentena com
+// ActionCaptcha.
+type Captcha interface {
+	Verify(ctx context.Context, token, remoteIP string) (bool, error)
+}
+
+// Guard acompanha o resultado das autorizações por IP e por e-mail e põe em
+// quarentena as origens com padrão de teste de cartões: taxa de recusa
+// anormal ou, por IP, rajada de recusas de valor baixo.
+type Guard struct {
+	zl      *zap.Logger
+	store   Store
+	cfg     Config
+	captcha Captcha // nil: nenhum desafio é aceito
+
+	mu        sync.Mutex
+	attempts  map[string][]attempt // por kind:value, em ordem de chegada
+	lastPrune time.Time
+}
+
+func NewGuard(zl *zap.Logger, store Store, cfg Config, captcha Captcha) *Guard {
+	return &Guard{zl: zl, store: store, cfg: cfg, captcha: captcha, attempts: make(map[string][]attempt)}
+}
+
+// Source é a origem de uma tentativa de pagamento.
+type Source struct {
+	IP    string
+	Email string
+}
+
+func (s Source) keys() map[Kind]string {
+	out := make(map[Kind]string, 2)
+	if s.IP != "" {
+		out[KindIP] = s.IP
+	}
+	if e := strings.ToLower(s.Email); e != "" {
+		out[KindEmail] = e
+	}
+	return out
+}
+
+// Check devolve *QuarantinedError se o IP ou o e-mail estiver em quarentena.
+// Se todas as quarentenas da origem forem ActionCaptcha, a tentativa que traz
+// em captchaToken um desafio resolvido passa; o resultado dela continua
+// contando nos limiares.
+func (g *Guard) Check(ctx context.Context, src Source, captchaToken string) error {
+	now := time.Now().UTC()
+	var captcha *Quarantine
+	for kind, v := range src.keys() {
+		q, err := g.store.Active(kind, v, now)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if q.Action != ActionCaptcha {
+			return &QuarantinedError{Quarantine: q}
+		}
+		captcha = q
+	}
+	// o token é de uso único: verificado uma vez para as duas origens
+	if captcha != nil && (captchaToken == "" || !g.solved(ctx, captcha, captchaToken, src.IP)) {
+		return &QuarantinedError{Quarantine: captcha}
+	}
+	return nil
+}
+
+// solved confirma o desafio com o provedor. Erros dele não liberam a
+// tentativa.
+func (g *Guard) solved(ctx context.Context, q *Quarantine, token, ip string) bool {
+	if g.captcha == nil {
+		return false
+	}
+	ok, err := g.captcha.Verify(ctx, token, ip)
+	if err != nil {
+		g.zl.Warn("card_testing_captcha_verify_failed",
+			zap.String("quarantine_id", q.ID),
+			zap.String("err", err.Error()))
+		return false
+	}
+	if ok {
+		g.zl.Info("card_testing_captcha_passed", zap.String("quarantine_id", q.ID))
+	}
+	return ok
+}
+
+// Record registra o resultado de uma autorização e, se a origem passar dos
+// limiares, a põe em quarentena.
+func (g *Guard) Record(ctx context.Context, src Source, currency string, amount int64, declined bool) {
+	now := time.Now().UTC()
+	low := declined && amount <= g.lowAmount(currency)
+	for kind, v := range src.keys() {
+		// a rajada de valor baixo só conta recusas, e só por IP: um cliente
+		// legítimo faz várias compras pequenas com o mesmo e-mail
+		a := attempt{at: now, declined: declined, low: low && kind == KindIP}
+		reason, n, d := g.observe(string(kind)+":"+v, a)
+		if reason == "" {
+			continue
+		}
+		q := &Quarantine{
+			ID:        ulidx.New(),
+			Kind:      kind,
+			Value:     v,
+			Action:    g.cfg.Action,
+			Reason:    reason,
+			Attempts:  n,
+			Declines:  d,
+			CreatedAt: now,
+			ExpiresAt: now.Add(g.cfg.Quarantine),
+		}
+		if err := g.store.Create(q); err != nil {
+			g.zl.Error("card_testing_quarantine_failed",
+				zap.String("kind", string(kind)),
+				zap.String("err", err.Error()))
+			continue
+		}
+		g.zl.Warn("card_testing_quarantine",
+			zap.String("quarantine_id", q.ID),
+			zap.String("kind", string(kind)),
+			zap.String("value", v),
+			zap.String("reason", reason),
+			zap.Time("expires_at", q.ExpiresAt))
+	}
+}
+
+// observe acrescenta a tentativa à janela da chave e devolve o motivo da
+// quarentena, se houver, com as contagens da janela. Ao detectar, a janela
+// recomeça para que a origem não volte à quarentena logo após liberada.
+func (g *Guard) observe(key string, a attempt) (reason string, attempts, declines int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	since := a.at.Add(-g.cfg.Window)
+	as := g.attempts[key]
+	i := 0
+	for i < len(as) && as[i].at.Before(since) {
+		i++
+	}
+	as = append(as[i:], a)
+
+	var lows int
+	for _, x := range as {
+		if x.declined {
+			declines++
+		}
+		if x.low {
+			lows++
+		}
+	}
+	attempts = len(as)
+	ratio := float64(declines) / float64(attempts)
+	switch {
+	case g.cfg.MinAttempts > 0 && attempts >= g.cfg.MinAttempts && ratio >= g.cfg.DeclineRatio:
+		reason = fmt.Sprintf("%d of %d authorizations declined in %s", declines, attempts, g.cfg.Window)
+	case g.cfg.LowAmountBurst > 0 && lows >= g.cfg.LowAmountBurst:
+		reason = fmt.Sprintf("%d declined low-amount authorizations in %s", lows, g.cfg.Window)
+	}
+	if reason != "" {
+		delete(g.attempts, key)
+	} else {
+		g.attempts[key] = as
+	}
+	if a.at.Sub(g.lastPrune) >= g.cfg.Window {
+		g.prune(since)
+		g.lastPrune = a.at
+	}
+	return reason, attempts, declines
+}
+
+// prune remove as chaves cuja última tentativa saiu da janela.
+func (g *Guard) prune(since time.Time) {
+	for k, as := range g.attempts {
+		if as[len(as)-1].at.Before(since) {
+			delete(g.attempts, k)
+		}
+	}
+}
+
+func (g *Guard) lowAmount(currency string) int64 {
+	if v, ok := g.cfg.LowAmount[strings.ToLower(currency)]; ok {
+		return v
+	}
+	return g.cfg.LowAmount["*"]
+}
+
+// Release libera a quarentena id antes de expirar, registrando quem liberou.
+func (g *Guard) Release(ctx context.Context, id, by, note string) (*Quarantine, error) {
+	q, err := g.store.Release(id, by, note, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	delete(g.attempts, string(q.Kind)+":"+q.Value)
+	g.mu.Unlock()
+	g.zl.Info("card_testing_release",
+		zap.String("quarantine_id", q.ID),
+		zap.String("kind", string(q.Kind)),
+		zap.String("value", q.Value),
+		zap.String("released_by", by))
+	return q, nil
+}
+
+func (g *Guard) Get(ctx context.Context, id string) (*Quarantine, error) {
+	return g.store.Get(id)
+}
+
+func (g *Guard) List(ctx context.Context, q Query) ([]*Quarantine, error) {
+	return g.store.List(q)
+}
@@ -0,0 +1,80 @@
+package cardtesting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// singleUseCaptcha aceita "solved" uma única vez, como os provedores de
+// captcha, e conta as verificações.
+type singleUseCaptcha struct {
+	used  bool
+	calls int
+}
+
+func (c *singleUseCaptcha) Verify(_ context.Context, token, _ string) (bool, error) {
+	c.calls++
+	if token != "solved" || c.used {
+		return false, nil
+	}
+	c.used = true
+	return true, nil
+}
+
+func quarantine(t *testing.T, s Store, kind Kind, value string, action Action) {
+	t.Helper()
+	now := time.Now().UTC()
+	q := &Quarantine{ID: string(kind) + "-" + value, Kind: kind, Value: value, Action: action, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	if err := s.Create(q); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckPassesSolvedCaptcha(t *testing.T) {
+	store := NewMemoryStore()
+	quarantine(t, store, KindIP, "203.0.113.7", ActionCaptcha)
+	quarantine(t, store, KindEmail, "bot@example.com", ActionCaptcha)
+	c := &singleUseCaptcha{}
+	g := NewGuard(zap.NewNop(), store, Config{Action: ActionCaptcha}, c)
+	src := Source{IP: "203.0.113.7", Email: "bot@example.com"}
+
+	var qe *QuarantinedError
+	if err := g.Check(context.Background(), src, ""); !errors.As(err, &qe) {
+		t.Fatalf("without token: err = %v, want QuarantinedError", err)
+	}
+	if err := g.Check(context.Background(), src, "forged"); !errors.As(err, &qe) {
+		t.Fatalf("forged token: err = %v, want QuarantinedError", err)
+	}
+	// IP e e-mail em quarentena: o token de uso único é verificado uma vez
+	c.calls = 0
+	if err := g.Check(context.Background(), src, "solved"); err != nil {
+		t.Fatalf("solved token: err = %v, want nil", err)
+	}
+	if c.calls != 1 {
+		t.Fatalf("verify calls = %d, want 1", c.calls)
+	}
+	if err := g.Check(context.Background(), src, "solved"); !errors.As(err, &qe) {
+		t.Fatalf("reused token: err = %v, want QuarantinedError", err)
+	}
+}
+
+func TestCheckBlockIgnoresCaptcha(t *testing.T) {
+	store := NewMemoryStore()
+	quarantine(t, store, KindIP, "203.0.113.7", ActionCaptcha)
+	quarantine(t, store, KindEmail, "bot@example.com", ActionBlock)
+	c := &singleUseCaptcha{}
+	g := NewGuard(zap.NewNop(), store, Config{Action: ActionCaptcha}, c)
+
+	var qe *QuarantinedError
+	err := g.Check(context.Background(), Source{IP: "203.0.113.7", Email: "bot@example.com"}, "solved")
+	if !errors.As(err, &qe) || qe.Quarantine.Action != ActionBlock {
+		t.Fatalf("err = %v, want the block quarantine", err)
+	}
+	if c.calls != 0 {
+		t.Fatalf("verify calls = %d, want none for a blocked source", c.calls)
+	}
+}
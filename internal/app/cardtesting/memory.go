@@ -0,0 +1,79 @@
+package cardtesting
+
+import (
+	"sync"
+	"time"
+)
+
+type MemoryStore struct {
+	mu    sync.Mutex
+	items map[string]*Quarantine
+	order []string // IDs em ordem de criação
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: make(map[string]*Quarantine)}
+}
+
+func (s *MemoryStore) Create(q *Quarantine) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp := *q
+	s.items[q.ID] = &cp
+	s.order = append(s.order, q.ID)
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (*Quarantine, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *q
+	return &cp, nil
+}
+
+func (s *MemoryStore) Active(kind Kind, value string, now time.Time) (*Quarantine, error) {
+	out, _ := s.List(Query{ActiveAt: now, Kind: kind, Value: value, Limit: 1})
+	if len(out) == 0 {
+		return nil, ErrNotFound
+	}
+	return out[0], nil
+}
+
+func (s *MemoryStore) Release(id, by, note string, at time.Time) (*Quarantine, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if q.ReleasedAt != nil {
+		return nil, ErrReleased
+	}
+	q.ReleasedAt = &at
+	q.ReleasedBy = by
+	q.ReleaseNote = note
+	cp := *q
+	return &cp, nil
+}
+
+func (s *MemoryStore) List(q Query) ([]*Quarantine, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []*Quarantine{}
+	for i := len(s.order) - 1; i >= 0; i-- {
+		x := s.items[s.order[i]]
+		if !q.Matches(x) {
+			continue
+		}
+		cp := *x
+		out = append(out, &cp)
+		if q.Limit > 0 && len(out) == q.Limit {
+			break
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,93 @@
+package cardtesting
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("quarantine not found")
+	ErrReleased = errors.New("quarantine already released")
+)
+
+// Kind é o tipo de origem observada.
+type Kind string
+
+const (
+	KindIP    Kind = "ip"
+	KindEmail Kind = "email"
+)
+
+// Action é a resposta dada a uma origem em quarentena.
+type Action string
+
+const (
+	ActionBlock   Action = "block"   // 403
+	ActionCaptcha Action = "captcha" // 403 com captcha_required
+)
+
+func (a Action) Valid() bool { return a == ActionBlock || a == ActionCaptcha }
+
+// Quarantine é o bloqueio temporário de uma origem. Os registros não são
+// apagados ao expirar ou ao serem liberados e servem de auditoria.
+type Quarantine struct {
+	ID          string     `json:"id"`
+	Kind        Kind       `json:"kind"`
+	Value       string     `json:"value"`
+	Action      Action     `json:"action"`
+	Reason      string     `json:"reason"`
+	Attempts    int        `json:"attempts"`
+	Declines    int        `json:"declines"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	ReleasedAt  *time.Time `json:"released_at,omitempty"`
+	ReleasedBy  string     `json:"released_by,omitempty"`
+	ReleaseNote string     `json:"release_note,omitempty"`
+}
+
+// Active indica se a quarentena ainda bloqueia em now.
+func (q *Quarantine) Active(now time.Time) bool {
+	return q.ReleasedAt == nil && now.Before(q.ExpiresAt)
+}
+
+// QuarantinedError é devolvido a quem tenta pagar a partir de uma origem
+// em quarentena.
+type QuarantinedError struct {
+	Quarantine *Quarantine
+}
+
+func (e *QuarantinedError) Error() string {
+	if e.Quarantine.Action == ActionCaptcha {
+		return "captcha required"
+	}
+	return fmt.Sprintf("%s is temporarily blocked", e.Quarantine.Kind)
+}
+
+// Query filtra a listagem; campos zero não filtram.
+type Query struct {
+	ActiveAt time.Time // só quarentenas ativas nesse instante
+	Kind     Kind
+	Value    string
+	Limit    int
+}
+
+func (q Query) Matches(x *Quarantine) bool {
+	if !q.ActiveAt.IsZero() && !x.Active(q.ActiveAt) {
+		return false
+	}
+	if q.Kind != "" && x.Kind != q.Kind {
+		return false
+	}
+	return q.Value == "" || x.Value == q.Value
+}
+
+type Store interface {
+	Create(q *Quarantine) error
+	Get(id string) (*Quarantine, error)
+	// Active devolve a quarentena ativa mais recente da origem, ou ErrNotFound.
+	Active(kind Kind, value string, now time.Time) (*Quarantine, error)
+	Release(id, by, note string, at time.Time) (*Quarantine, error)
+	// List devolve as quarentenas mais recentes primeiro.
+	List(q Query) ([]*Quarantine, error)
+}
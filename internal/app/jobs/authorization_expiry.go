@@ -0,0 +1,130 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/app/saga"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/config"
+	"go.uber.org/zap"
+)
+
+// ExpiryPolicy é o que fazer com uma autorização perto de expirar.
+type ExpiryPolicy string
+
+const (
+	ExpiryCapture ExpiryPolicy = "capture" // captura o valor autorizado
+	ExpiryCancel  ExpiryPolicy = "cancel"  // libera a autorização
+	ExpiryFlag    ExpiryPolicy = "flag"    // só sinaliza (payment.authorization_expiring)
+)
+
+func (p ExpiryPolicy) Valid() bool {
+	switch p {
+	case ExpiryCapture, ExpiryCancel, ExpiryFlag:
+		return true
+	}
+	return false
+}
+
+// AuthorizationExpiry varre os pagamentos authorized cuja autorização vence
+// em menos de AUTH_EXPIRY_MARGIN e aplica a política configurada pela saga.
+type AuthorizationExpiry struct {
+	zl       *zap.Logger
+	repo     payment.Repository
+	saga     *saga.PaymentSaga
+	policy   ExpiryPolicy
+	validity time.Duration
+	margin   time.Duration
+	interval time.Duration
+}
+
+func NewAuthorizationExpiry(zl *zap.Logger, repo payment.Repository, s *saga.PaymentSaga, cfg *config.Config) (*AuthorizationExpiry, error) {
+	policy := ExpiryPolicy(cfg.AuthExpiryPolicy)
+	if !policy.Valid() {
+		return nil, fmt.Errorf("invalid AUTH_EXPIRY_POLICY %q", cfg.AuthExpiryPolicy)
+	}
+	if cfg.AuthExpiryMargin >= cfg.AuthExpiryValidity {
+		return nil, errors.New("AUTH_EXPIRY_MARGIN must be shorter than AUTH_EXPIRY_VALIDITY")
+	}
+	return &AuthorizationExpiry{
+		zl:       zl,
+		repo:     repo,
+		saga:     s,
+		policy:   policy,
+		validity: cfg.AuthExpiryValidity,
+		margin:   cfg.AuthExpiryMargin,
+		interval: cfg.AuthExpiryCheckInterval,
+	}, nil
+}
+
+func (j *AuthorizationExpiry) Run(ctx context.Context) {
+	t := time.NewTicker(j.interval)
+	defer t.Stop()
+	for {
+		if err := j.Sweep(ctx); err != nil {
+			j.zl.Error("auth_expiry_sweep_failed", zap.String("err", err.Error()))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Sweep aplica a política a todas as autorizações que vencem dentro da
+// margem. Falhas num pagamento são logadas e não interrompem a varredura.
+func (j *AuthorizationExpiry) Sweep(ctx context.Context) error {
+	q := payment.Query{
+		Statuses:         []payment.Status{payment.StatusAuthorized},
+		AuthorizedBefore: time.Now().UTC().Add(j.margin - j.validity),
+		Limit:            payment.MaxPageSize,
+	}
+	ctx = payment.WithOrigin(ctx, payment.Origin{Source: payment.SourceJob})
+	for {
+		page, err := j.repo.List(q)
+		if err != nil {
+			return err
+		}
+		for _, p := range page.Items {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			j.act(ctx, p)
+		}
+		if page.NextCursor == "" {
+			return nil
+		}
+		q.Cursor = page.NextCursor
+	}
+}
+
+func (j *AuthorizationExpiry) act(ctx context.Context, p *payment.Payment) {
+	expiresAt := p.AuthorizedAt.Add(j.validity)
+	if j.policy == ExpiryFlag && p.ExpiryFlagged() {
+		return
+	}
+	var err error
+	switch j.policy {
+	case ExpiryCapture:
+		_, err = j.saga.Capture(ctx, p, 0)
+	case ExpiryCancel:
+		_, err = j.saga.Cancel(ctx, p)
+	case ExpiryFlag:
+		_, err = j.saga.FlagExpiring(ctx, p, expiresAt)
+	}
+	fields := []zap.Field{
+		zap.String("payment_id", p.ID),
+		zap.String("policy", string(j.policy)),
+		zap.Time("authorized_at", p.AuthorizedAt),
+		zap.Time("expires_at", expiresAt),
+	}
+	if err != nil {
+		j.zl.Error("auth_expiry_action_failed", append(fields, zap.String("err", err.Error()))...)
+		return
+	}
+	j.zl.Warn("auth_expiry_"+string(j.policy), fields...)
+}
@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/app/service"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/config"
+	"go.uber.org/zap"
+)
+
+// DisputeDeadlines avisa, uma vez por prazo, das disputas cujo
+// evidence_due_by vence dentro de DISPUTE_DEADLINE_WARNING.
+type DisputeDeadlines struct {
+	zl       *zap.Logger
+	svc      *service.DisputeService
+	within   time.Duration
+	interval time.Duration
+}
+
+func NewDisputeDeadlines(zl *zap.Logger, svc *service.DisputeService, cfg *config.Config) *DisputeDeadlines {
+	return &DisputeDeadlines{
+		zl:       zl,
+		svc:      svc,
+		within:   cfg.DisputeDeadlineWarning,
+		interval: cfg.DisputeDeadlineCheckInterval,
+	}
+}
+
+func (j *DisputeDeadlines) Run(ctx context.Context) {
+	t := time.NewTicker(j.interval)
+	defer t.Stop()
+	for {
+		if err := j.svc.WarnDeadlines(ctx, j.within); err != nil {
+			j.zl.Error("dispute_deadlines_failed", zap.String("err", err.Error()))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/app/saga"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/config"
+	"go.uber.org/zap"
+)
+
+// ReviewSLAReviewer é o revisor registrado nas rejeições automáticas.
+const ReviewSLAReviewer = "system:review_sla"
+
+// ReviewSLA rejeita os pagamentos que ficaram em in_review por mais de
+// REVIEW_SLA, cancelando a autorização pela saga.
+type ReviewSLA struct {
+	zl       *zap.Logger
+	repo     payment.Repository
+	saga     *saga.PaymentSaga
+	sla      time.Duration
+	interval time.Duration
+}
+
+// NewReviewSLA exige que o SLA vença antes da ação sobre autorizações a
+// expirar, senão a autorização poderia expirar ainda em revisão.
+func NewReviewSLA(zl *zap.Logger, repo payment.Repository, s *saga.PaymentSaga, cfg *config.Config) (*ReviewSLA, error) {
+	if cfg.ReviewSLA <= 0 {
+		return nil, errors.New("REVIEW_SLA must be positive")
+	}
+	if cfg.ReviewSLA >= cfg.AuthExpiryValidity-cfg.AuthExpiryMargin {
+		return nil, errors.New("REVIEW_SLA must be shorter than AUTH_EXPIRY_VALIDITY minus AUTH_EXPIRY_MARGIN")
+	}
+	return &ReviewSLA{
+		zl:       zl,
+		repo:     repo,
+		saga:     s,
+		sla:      cfg.ReviewSLA,
+		interval: cfg.ReviewCheckInterval,
+	}, nil
+}
+
+func (j *ReviewSLA) Run(ctx context.Context) {
+	t := time.NewTicker(j.interval)
+	defer t.Stop()
+	for {
+		if err := j.Sweep(ctx); err != nil {
+			j.zl.Error("review_sla_sweep_failed", zap.String("err", err.Error()))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Sweep rejeita as revisões pedidas há mais de REVIEW_SLA, incluindo as já
+// rejeitadas cujo cancelamento falhou. Falhas num pagamento são logadas e
+// não interrompem a varredura.
+func (j *ReviewSLA) Sweep(ctx context.Context) error {
+	q := payment.Query{
+		Statuses:              []payment.Status{payment.StatusInReview},
+		ReviewRequestedBefore: time.Now().UTC().Add(-j.sla),
+		Limit:                 payment.MaxPageSize,
+	}
+	ctx = payment.WithOrigin(ctx, payment.Origin{Source: payment.SourceJob})
+	for {
+		page, err := j.repo.List(q)
+		if err != nil {
+			return err
+		}
+		for _, p := range page.Items {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fields := []zap.Field{
+				zap.String("payment_id", p.ID),
+				zap.Time("review_requested_at", p.Review.RequestedAt),
+			}
+			if p.ReviewRejected() {
+				// rejeitada antes (pelo operador ou pelo SLA): só falta cancelar
+				if _, err := j.saga.CompleteRejection(ctx, p); err != nil {
+					j.zl.Error("review_sla_cancel_failed", append(fields, zap.String("err", err.Error()))...)
+					continue
+				}
+				j.zl.Warn("review_sla_cancel_retried", fields...)
+				continue
+			}
+			if _, err := j.saga.RejectReview(ctx, p, ReviewSLAReviewer, "review SLA of "+j.sla.String()+" exceeded", true); err != nil {
+				j.zl.Error("review_sla_reject_failed", append(fields, zap.String("err", err.Error()))...)
+				continue
+			}
+			j.zl.Warn("review_sla_rejected", fields...)
+		}
+		if page.NextCursor == "" {
+			return nil
+		}
+		q.Cursor = page.NextCursor
+	}
+}
@@ -2,18 +2,143 @@ package ports
 
 import (
 	"context"
+	"errors"
+	"io"
 
 	"github.com/stripe/stripe-go/v76"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/risk"
 )
 
+// ErrIncrementalAuthUnsupported indica que o cartão não aceita autorização incremental.
+var ErrIncrementalAuthUnsupported = errors.New("incremental authorization not supported")
+
+// ErrCardDeclined indica que o emissor recusou o cartão na autorização.
+var ErrCardDeclined = errors.New("card declined")
+
+// ErrGatewayFailed e ErrGatewayUnavailable marcam falhas transitórias do
+// gateway: rede, timeout e 5xx no primeiro; rate limit e circuit breaker
+// aberto no segundo. Uma nova tentativa pode ter outro resultado.
+var (
+	ErrGatewayFailed      = errors.New("payment gateway error")
+	ErrGatewayUnavailable = errors.New("payment gateway unavailable")
+)
+
+// Rejected indica que o Stripe recusou a operação de forma definitiva: cartão
+// recusado ou requisição inválida (4xx). Em qualquer outro erro (rede,
+// timeout, 5xx, prazo do contexto) não se sabe se a operação foi executada, e
+// o pagamento não pode ser dado como falho.
+func Rejected(err error) bool {
+	switch {
+	case errors.Is(err, ErrCardDeclined):
+		return true
+	case errors.Is(err, ErrGatewayFailed), errors.Is(err, ErrGatewayUnavailable):
+		return false
+	}
+	var se *stripe.Error
+	if !errors.As(err, &se) || se.Type == stripe.ErrorTypeIdempotency {
+		return false // chave reusada com outros parâmetros: a primeira pode ter passado
+	}
+	return se.HTTPStatusCode >= 400 && se.HTTPStatusCode < 500
+}
+
+// AuthorizeInput descreve o PaymentIntent de captura manual a ser criado.
+// Com Confirm, a API confirma o PaymentIntent na criação; sem ele, o
+// PaymentIntent fica aguardando a confirmação do frontend via client_secret.
+// PaymentMethod e OffSession cobram um método já usado sem o cliente
+// presente (reautorização).
+type AuthorizeInput struct {
+	IdemKey       string
+	Confirm       bool
+	Amount        int64
+	Currency      string
+	Email         string
+	Customer      string // ID do Customer no Stripe; opcional
+	Description   string
+	Metadata      map[string]string
+	PaymentMethod string
+	OffSession    bool
+	UseTestPM     bool
+	TestPM        string
+}
+
+// PaymentMethodRef é o método de pagamento confirmado num PaymentIntent e o
+// Customer ao qual o PaymentIntent pertence.
+type PaymentMethodRef struct {
+	PaymentMethodID string
+	CustomerID      string
+}
+
+// IntentStatus é o status do PaymentIntent no Stripe.
+type IntentStatus string
+
+const (
+	IntentRequiresPaymentMethod IntentStatus = "requires_payment_method"
+	IntentRequiresConfirmation  IntentStatus = "requires_confirmation"
+	IntentRequiresAction        IntentStatus = "requires_action"
+	IntentProcessing            IntentStatus = "processing"
+	IntentRequiresCapture       IntentStatus = "requires_capture"
+	IntentCanceled              IntentStatus = "canceled"
+	IntentSucceeded             IntentStatus = "succeeded"
+)
+
+type AuthorizeResult struct {
+	PaymentIntentID string
+	ClientSecret    string
+	Status          IntentStatus
+}
+
 type PaymentGateway interface {
-	AuthorizeManual(ctx context.Context, idemKey string, amount int64, current, email string, useTest bool, testPM string) (piID, clientSecret string, err error)
-	Capture(ctx context.Context, paymentIntendID string) error
-	Cancel(ctx context.Context, paymentIntendID string) error
-	Refund(ctx context.Context, paymentIntendID string) error
+	AuthorizeManual(ctx context.Context, in AuthorizeInput) (AuthorizeResult, error)
+	IncrementAuthorization(ctx context.Context, idemKey, paymentIntendID string, amount int64) error
+	Capture(ctx context.Context, idemKey, paymentIntendID string, amount int64) error
+	// Cancel cancela o PaymentIntent; já cancelado não é erro.
+	Cancel(ctx context.Context, idemKey, paymentIntendID string) error
+	Refund(ctx context.Context, idemKey, paymentIntendID string, amount int64, reason string) (refundID string, err error)
+	// PaymentMethodOf devolve o método de pagamento e o Customer do
+	// PaymentIntent; PaymentMethodID vazio se ele ainda não foi confirmado.
+	PaymentMethodOf(ctx context.Context, paymentIntentID string) (PaymentMethodRef, error)
+	// Card lê o cartão do PaymentIntent ou, sem ele, do PaymentMethod;
+	// vazio se não houver cartão.
+	Card(ctx context.Context, paymentIntentID, paymentMethodID string) (payment.Card, error)
 	VerifyWebhookSignature(payload []byte, sigHEader string) (stripe.Event, error)
 }
 
+// CustomerInput são os dados sincronizados com o Customer do Stripe.
+type CustomerInput struct {
+	IdemKey  string
+	Email    string
+	Name     string
+	Phone    string
+	Metadata map[string]string
+}
+
+type CustomerGateway interface {
+	CreateCustomer(ctx context.Context, in CustomerInput) (stripeCustomerID string, err error)
+	UpdateCustomer(ctx context.Context, stripeCustomerID string, in CustomerInput) error
+	DeleteCustomer(ctx context.Context, stripeCustomerID string) error
+}
+
+type DisputeGateway interface {
+	// UploadDisputeFile envia o arquivo ao Stripe com purpose dispute_evidence.
+	UploadDisputeFile(ctx context.Context, filename string, r io.Reader) (stripeFileID string, err error)
+	// UpdateDisputeEvidence grava os campos de evidence da disputa; com
+	// submit, as evidências são enviadas ao emissor e não podem mais mudar.
+	UpdateDisputeEvidence(ctx context.Context, stripeDisputeID string, evidence map[string]string, submit bool) error
+}
+
+// Gateway reúne as portas implementadas pelo cliente do Stripe.
+type Gateway interface {
+	PaymentGateway
+	CustomerGateway
+	DisputeGateway
+}
+
+// RiskEngine decide se um pagamento pode ser autorizado.
+type RiskEngine interface {
+	Evaluate(ctx context.Context, in risk.Input) risk.Decision
+}
+
 type EventPublisher interface {
 	Publish(ctx context.Context, topic string, payload any) error
 }
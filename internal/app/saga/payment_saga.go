@@ -2,17 +2,28 @@ package saga
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/williamkoller/golang-payment-stripe/internal/app/ports"
 	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/risk"
 	"github.com/williamkoller/golang-payment-stripe/internal/infra/config"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/idempotency"
+	"github.com/williamkoller/golang-payment-stripe/pkg/ulidx"
 	"go.uber.org/zap"
 )
 
+// maxConflictAttempts limita as regravações de um pagamento alterado por
+// outro escritor (webhook, outra requisição) entre a leitura e o Update.
+const maxConflictAttempts = 3
+
 type report interface {
+	Get(id string) (*payment.Payment, error)
 	Update(p *payment.Payment) error
 }
 
@@ -20,17 +31,20 @@ type PaymentSaga struct {
 	zl   *zap.Logger
 	repo report
 	pg   ports.PaymentGateway
+	risk ports.RiskEngine
 	cfg  *config.Config
 }
 
 func NewPaymentSaga(zl *zap.Logger,
 	repo report,
 	pg ports.PaymentGateway,
+	re ports.RiskEngine,
 	cfg *config.Config) *PaymentSaga {
 	return &PaymentSaga{
 		zl,
 		repo,
 		pg,
+		re,
 		cfg,
 	}
 }
@@ -40,66 +54,482 @@ func (s *PaymentSaga) Authorize(ctx context.Context, p *payment.Payment) (*payme
 		return nil, errors.New("invalid status for authorize")
 	}
 
-	if p.Amount >= 10_000_000 {
-		p.MarkFailed()
-		_ = s.repo.Update(p)
-		return nil, errors.New("risk: amount too high")
+	p, err := s.assessRisk(ctx, p)
+	if err != nil {
+		return nil, err
 	}
 
-	idem := fmt.Sprintf("auth-%s", p.ID)
-	piID, clientSecret, err := s.pg.AuthorizeManual(ctx, idem, p.Amount, p.Currency, p.Email, s.cfg.StripeEnableTestPM, s.cfg.StripeTestPaymentPM)
+	res, err := s.pg.AuthorizeManual(ctx, s.authorizeInput(p, "auth-"+p.ID, p.Amount))
 	if err != nil {
-		p.MarkFailed()
-		_ = s.repo.Update(p)
+		// sem resposta definitiva o PaymentIntent pode existir: o pagamento
+		// fica created e uma nova chamada (mesma chave auth-<id>) recebe do
+		// Stripe o mesmo PaymentIntent
+		if ports.Rejected(err) {
+			s.fail(ctx, p, payment.StatusCreated, payment.StatusFailed)
+		}
 		return nil, err
 	}
 
-	_ = p.MarkAuthorized(piID, clientSecret)
-	if err := s.repo.Update(p); err != nil {
+	if res.Status != ports.IntentRequiresCapture {
+		// confirmação no frontend, 3-D Secure ou processamento: o webhook
+		// payment_intent.requires_capture conclui a autorização
+		pending, ok := pendingStatus(res.Status)
+		if !ok {
+			// só um PaymentIntent cancelado encerra a tentativa; nos demais
+			// status o webhook do PaymentIntent decide
+			if res.Status == ports.IntentCanceled {
+				s.fail(ctx, p, payment.StatusCreated, payment.StatusFailed)
+			}
+			return nil, fmt.Errorf("unexpected payment intent status %q", res.Status)
+		}
+		p, err = s.save(p, payment.OriginFrom(ctx), func(q *payment.Payment) error {
+			if q.StripePaymentIntentID == res.PaymentIntentID && (q.Status == pending || q.HoldsAuthorization()) {
+				return nil // webhook chegou antes
+			}
+			return q.MarkPending(pending, res.PaymentIntentID)
+		})
+	} else {
+		p, err = s.save(p, payment.OriginFrom(ctx), func(q *payment.Payment) error {
+			if q.HoldsAuthorization() && q.StripePaymentIntentID == res.PaymentIntentID {
+				return nil // webhook requires_capture chegou antes
+			}
+			return q.MarkAuthorized(res.PaymentIntentID)
+		})
+	}
+	if err != nil {
 		return nil, err
 	}
+	// o client_secret só volta nesta resposta; não é gravado
+	p.ClientSecret = res.ClientSecret
+	return p, nil
+}
+
+// assessRisk avalia p no motor de risco e grava a decisão no pagamento.
+// Recusado, o pagamento vai para failed; em revisão, segue para a
+// autorização com a decisão registrada.
+func (s *PaymentSaga) assessRisk(ctx context.Context, p *payment.Payment) (*payment.Payment, error) {
+	card := payment.Card{Fingerprint: p.CardFingerprint, BIN: p.CardBIN, Country: p.CardCountry}
+	if card.Fingerprint == "" {
+		card = s.card(ctx, p)
+	}
+	d := s.risk.Evaluate(ctx, risk.Input{
+		PaymentID:       p.ID,
+		Amount:          p.Amount,
+		Currency:        p.Currency,
+		Email:           p.Email,
+		CardBIN:         card.BIN,
+		CardCountry:     card.Country,
+		ClientIP:        p.ClientIP,
+		CardFingerprint: card.Fingerprint,
+		Metadata:        p.Metadata,
+		At:              time.Now().UTC(),
+	})
+	p, err := s.save(p, sagaOrigin(ctx), func(q *payment.Payment) error {
+		return q.RecordRisk(d, card)
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch d.Outcome {
+	case risk.Deny:
+		s.zl.Warn("risk_denied", zap.String("payment_id", p.ID), zap.Any("reasons", d.Reasons))
+		s.fail(ctx, p, payment.StatusCreated, payment.StatusFailed)
+		return nil, &risk.DeniedError{PaymentID: p.ID, Reasons: d.Reasons}
+	case risk.Review:
+		s.zl.Warn("risk_review", zap.String("payment_id", p.ID), zap.Any("reasons", d.Reasons))
+	}
 	return p, nil
 }
 
-func (s *PaymentSaga) Capture(ctx context.Context, p *payment.Payment) (*payment.Payment, error) {
+// card busca no Stripe o cartão que será cobrado: o do PaymentIntent de uma
+// tentativa anterior ou o PaymentMethod confirmado pela API. Com confirmação
+// no frontend o cartão só é conhecido depois (ver o webhook), e a avaliação
+// segue sem ele.
+func (s *PaymentSaga) card(ctx context.Context, p *payment.Payment) payment.Card {
+	var pm string
+	if !p.ClientConfirmation && s.cfg.StripeEnableTestPM {
+		pm = s.cfg.StripeTestPaymentPM
+	}
+	if p.StripePaymentIntentID == "" && pm == "" {
+		return payment.Card{}
+	}
+	card, err := s.pg.Card(ctx, p.StripePaymentIntentID, pm)
+	if err != nil {
+		s.zl.Warn("risk_card_lookup_failed",
+			zap.String("payment_id", p.ID),
+			zap.String("err", err.Error()))
+		return payment.Card{}
+	}
+	return card
+}
+
+// pendingStatus traduz o status de um PaymentIntent ainda não autorizado.
+func pendingStatus(st ports.IntentStatus) (payment.Status, bool) {
+	switch st {
+	case ports.IntentRequiresPaymentMethod:
+		return payment.StatusRequiresPaymentMethod, true
+	case ports.IntentRequiresAction, ports.IntentRequiresConfirmation:
+		return payment.StatusRequiresAction, true
+	case ports.IntentProcessing:
+		return payment.StatusProcessing, true
+	}
+	return "", false
+}
+
+// UpdateAmount altera o valor autorizado antes da captura. Aumentos usam
+// autorização incremental quando o cartão suporta e, caso contrário, criam um
+// novo PaymentIntent e cancelam o anterior. Reduções só são registradas: a
+// diferença é liberada na captura, que sempre envia o valor atual.
+func (s *PaymentSaga) UpdateAmount(ctx context.Context, p *payment.Payment, amount int64) (*payment.Payment, error) {
 	if p.Status != payment.StatusAuthorized {
 		return nil, errors.New("payment is not authorized")
 	}
-
-	if err := s.pg.Capture(ctx, p.StripePaymentIntentID); err != nil {
-		p.MarkFailed()
-		_ = s.repo.Update(p)
+	if amount == p.Amount {
+		return p, nil
+	}
+	if err := (payment.Money{Amount: amount, Currency: payment.Currency(p.Currency)}).Validate(); err != nil {
 		return nil, err
 	}
 
-	select {
-	case <-ctx.Done():
-		_ = s.pg.Refund(context.Background(), p.StripePaymentIntentID)
-		p.MarkFailed()
-		_ = s.repo.Update(p)
-		return nil, ctx.Err()
-	case <-time.After(50 * time.Millisecond):
+	method := payment.AmountChangeReduction
+	if amount > p.Amount {
+		// como no refund, a chave vem da chamada da API e não do número de
+		// alterações já gravadas
+		op := operationKey(ctx)
+		err := s.pg.IncrementAuthorization(ctx, fmt.Sprintf("incr-%s-%s", p.ID, op), p.StripePaymentIntentID, amount)
+		switch {
+		case err == nil:
+			method = payment.AmountChangeIncrement
+		case errors.Is(err, ports.ErrIncrementalAuthUnsupported):
+			return s.reauthorize(ctx, p, amount, op)
+		default:
+			return nil, err
+		}
 	}
 
-	_ = p.MarkCaptured()
+	return s.save(p, payment.OriginFrom(ctx), func(q *payment.Payment) error {
+		if q.Amount == amount {
+			return nil
+		}
+		return q.ChangeAmount(amount, method, "")
+	})
+}
+
+// reauthorize autoriza amount num novo PaymentIntent e só então cancela o
+// anterior; se a nova autorização falhar, a antiga continua válida. O novo
+// PaymentIntent cobra off_session o método e o Customer do anterior, já que o
+// cliente não está presente para confirmar de novo.
+func (s *PaymentSaga) reauthorize(ctx context.Context, p *payment.Payment, amount int64, op string) (*payment.Payment, error) {
+	src, err := s.pg.PaymentMethodOf(ctx, p.StripePaymentIntentID)
+	if err != nil {
+		return nil, err
+	}
+	idem := fmt.Sprintf("reauth-%s-%s", p.ID, op)
+	in := s.authorizeInput(p, idem, amount)
+	in.Confirm = true
+	in.OffSession = true
+	if src.CustomerID != "" {
+		in.Customer = src.CustomerID
+	}
+	switch {
+	case src.PaymentMethodID != "" && (in.Customer != "" || !s.cfg.StripeEnableTestPM):
+		in.PaymentMethod = src.PaymentMethodID
+	case s.cfg.StripeEnableTestPM:
+		// em teste, sem Customer, o método já usado não pode ser reaproveitado
+	default:
+		return nil, errors.New("reauthorization requires the payment method of the current payment intent")
+	}
+	res, err := s.pg.AuthorizeManual(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	piID, paymentID := res.PaymentIntentID, p.ID
+	if res.Status != ports.IntentRequiresCapture {
+		s.cancelOrphan(ctx, paymentID, piID)
+		return nil, fmt.Errorf("reauthorization not approved: payment intent is %s", res.Status)
+	}
 
-	if err := s.repo.Update(p); err != nil {
+	oldPI := p.StripePaymentIntentID
+	p, err = s.save(p, payment.OriginFrom(ctx), func(q *payment.Payment) error {
+		if q.StripePaymentIntentID == piID {
+			return nil
+		}
+		return q.ChangeAmount(amount, payment.AmountChangeReauthorization, piID)
+	})
+	if err != nil {
+		s.cancelOrphan(ctx, paymentID, piID)
 		return nil, err
 	}
 
+	if err := s.pg.Cancel(ctx, "cancel-"+oldPI, oldPI); err != nil {
+		s.zl.Warn("reauth_cancel_old_pi_failed",
+			zap.String("payment_id", p.ID),
+			zap.String("pi", oldPI),
+			zap.String("err", err.Error()))
+	}
 	return p, nil
 }
 
+// cancelOrphan cancela o PaymentIntent piID de uma reautorização que não
+// será usada. O prazo é próprio, já que ctx pode ter expirado; se o
+// cancelamento falhar, a retenção fica no cartão até expirar e o erro precisa
+// chegar ao operador.
+func (s *PaymentSaga) cancelOrphan(ctx context.Context, paymentID, piID string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 15*time.Second)
+	defer cancel()
+	if err := s.pg.Cancel(ctx, "cancel-"+piID, piID); err != nil {
+		s.zl.Error("reauth_cancel_new_pi_failed",
+			zap.String("payment_id", paymentID),
+			zap.String("pi", piID),
+			zap.String("err", err.Error()))
+	}
+}
+
+// Capture captura amount do valor autorizado; amount == 0 captura tudo.
+func (s *PaymentSaga) Capture(ctx context.Context, p *payment.Payment, amount int64) (*payment.Payment, error) {
+	if p.Status == payment.StatusInReview {
+		return nil, errors.New("payment is held for manual review")
+	}
+	if p.Status != payment.StatusAuthorized {
+		return nil, errors.New("payment is not authorized")
+	}
+	if amount == 0 {
+		amount = p.Amount
+	}
+	if amount > p.Amount {
+		return nil, errors.New("capture amount exceeds authorized amount")
+	}
+
+	if err := s.pg.Capture(ctx, "capture-"+p.StripePaymentIntentID, p.StripePaymentIntentID, amount); err != nil {
+		// numa falha transitória a captura pode ter ocorrido: o pagamento
+		// continua authorized, e uma nova chamada (mesma chave) ou o webhook
+		// payment_intent.succeeded conclui
+		if ports.Rejected(err) {
+			s.fail(ctx, p, payment.StatusAuthorized)
+		}
+		return nil, err
+	}
+
+	// o Stripe já capturou: a captura é gravada mesmo que ctx tenha expirado
+	return s.save(p, payment.OriginFrom(ctx), func(q *payment.Payment) error {
+		if q.Status == payment.StatusCaptured {
+			return nil // webhook payment_intent.succeeded chegou antes
+		}
+		return q.MarkCaptured(amount)
+	})
+}
+
+// Cancel cancela o PaymentIntent no Stripe e só então marca o pagamento como
+// canceled. Se o Stripe não confirmar, o erro volta e o pagamento fica como
+// estava, com a retenção ainda aberta no cartão.
 func (s *PaymentSaga) Cancel(ctx context.Context, p *payment.Payment) (*payment.Payment, error) {
-	if p.Status != payment.StatusAuthorized && p.Status != payment.StatusCreated {
+	if !p.HoldsAuthorization() && p.Status != payment.StatusCreated && !p.AwaitingCustomer() {
 		return nil, errors.New("invalid status for cancel")
 	}
 	if p.StripePaymentIntentID != "" {
-		_ = s.pg.Cancel(ctx, p.StripePaymentIntentID)
+		if err := s.pg.Cancel(ctx, "cancel-"+p.StripePaymentIntentID, p.StripePaymentIntentID); err != nil {
+			return nil, err
+		}
 	}
-	_ = p.MarkCanceled()
-	if err := s.repo.Update(p); err != nil {
+	return s.save(p, payment.OriginFrom(ctx), func(q *payment.Payment) error {
+		if q.Status == payment.StatusCanceled {
+			return nil
+		}
+		return q.MarkCanceled()
+	})
+}
+
+// ApproveReview libera para captura o pagamento em revisão e, com capture,
+// já captura o valor autorizado.
+func (s *PaymentSaga) ApproveReview(ctx context.Context, p *payment.Payment, reviewer, note string, capture bool) (*payment.Payment, error) {
+	p, err := s.save(p, payment.OriginFrom(ctx), func(q *payment.Payment) error {
+		if q.Status == payment.StatusAuthorized && q.Review != nil && q.Review.Outcome == payment.ReviewApproved {
+			return nil // já aprovado
+		}
+		return q.ApproveReview(reviewer, note)
+	})
+	if err != nil {
 		return nil, err
 	}
-	return p, nil
+	if !capture {
+		return p, nil
+	}
+	return s.Capture(ctx, p, 0)
+}
+
+// RejectReview registra a rejeição e cancela a autorização por Cancel. Se o
+// cancelamento falhar, o pagamento continua em in_review já rejeitado e só o
+// cancelamento é refeito, por uma nova chamada ou por CompleteRejection.
+func (s *PaymentSaga) RejectReview(ctx context.Context, p *payment.Payment, reviewer, note string, auto bool) (*payment.Payment, error) {
+	p, err := s.save(p, payment.OriginFrom(ctx), func(q *payment.Payment) error {
+		if q.ReviewRejected() {
+			return nil
+		}
+		return q.RejectReview(reviewer, note, auto)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != payment.StatusInReview {
+		return p, nil // já cancelado
+	}
+	return s.CompleteRejection(ctx, p)
+}
+
+// CompleteRejection refaz só o cancelamento de uma revisão já rejeitada que
+// continua em in_review, sem registrar outra decisão.
+func (s *PaymentSaga) CompleteRejection(ctx context.Context, p *payment.Payment) (*payment.Payment, error) {
+	if p.Status != payment.StatusInReview || !p.ReviewRejected() {
+		return nil, payment.ErrNotInReview
+	}
+	return s.Cancel(ctx, p)
+}
+
+// FlagExpiring sinaliza que a autorização de p expira em expiresAt sem ter
+// sido capturada; não faz nada se ela já foi sinalizada ou não está mais
+// autorizada.
+func (s *PaymentSaga) FlagExpiring(ctx context.Context, p *payment.Payment, expiresAt time.Time) (*payment.Payment, error) {
+	if p.Status != payment.StatusAuthorized {
+		return nil, errors.New("payment is not authorized")
+	}
+	return s.save(p, payment.OriginFrom(ctx), func(q *payment.Payment) error {
+		if q.Status != payment.StatusAuthorized || q.ExpiryFlagged() {
+			return nil
+		}
+		return q.FlagExpiring(expiresAt)
+	})
+}
+
+// Refund devolve amount do valor capturado; amount == 0 reembolsa o saldo restante.
+// Cada chamada gera um registro próprio em p.Refunds. A chave de idempotência
+// vem da chamada da API (ver operationKey), e não do estado do pagamento:
+// refeita após um conflito de versão, a chamada recebe do Stripe o mesmo
+// refund em vez de criar outro.
+func (s *PaymentSaga) Refund(ctx context.Context, p *payment.Payment, amount int64, reason string) (*payment.Payment, error) {
+	refundable := p.RefundableAmount()
+	if refundable == 0 {
+		return nil, errors.New("payment is not refundable")
+	}
+	if amount == 0 {
+		amount = refundable
+	}
+	if amount > refundable {
+		return nil, errors.New("refund amount exceeds refundable amount")
+	}
+
+	idem := fmt.Sprintf("refund-%s-%s", p.ID, operationKey(ctx))
+	stripeRefundID, err := s.pg.Refund(ctx, idem, p.StripePaymentIntentID, amount, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	r := payment.Refund{
+		ID:             ulidx.New(),
+		Amount:         amount,
+		Reason:         reason,
+		StripeRefundID: stripeRefundID,
+		CreatedAt:      time.Now().UTC(),
+	}
+	return s.save(p, payment.OriginFrom(ctx), func(q *payment.Payment) error {
+		if q.HasRefund(stripeRefundID) {
+			return nil
+		}
+		return q.AddRefund(r)
+	})
+}
+
+// operationKey identifica a chamada da API que pediu a operação: a
+// Idempotency-Key do cliente ou, sem ela, o ID gerado pelo servidor para a
+// chamada. O X-Request-ID não serve: vem do cliente e pode se repetir entre
+// chamadas diferentes. Fora da API (jobs), cada chamada recebe um ID novo. O
+// hash mantém a chave do Stripe dentro do limite de 255 caracteres.
+func operationKey(ctx context.Context) string {
+	k := idempotency.KeyFrom(ctx)
+	if k == "" {
+		k = idempotency.OperationFrom(ctx)
+	}
+	if k == "" {
+		k = ulidx.New()
+	}
+	sum := sha256.Sum256([]byte(k))
+	return hex.EncodeToString(sum[:16])
+}
+
+// authorizeInput monta o PaymentIntent de p. O metadata do integrador segue
+// junto com payment_id e order_reference, que prevalecem sobre chaves iguais.
+func (s *PaymentSaga) authorizeInput(p *payment.Payment, idem string, amount int64) ports.AuthorizeInput {
+	md := make(map[string]string, len(p.Metadata)+2)
+	for k, v := range p.Metadata {
+		md[k] = v
+	}
+	md["payment_id"] = p.ID
+	if p.OrderReference != "" {
+		md["order_reference"] = p.OrderReference
+	}
+	return ports.AuthorizeInput{
+		IdemKey:     idem,
+		Confirm:     !p.ClientConfirmation,
+		Amount:      amount,
+		Currency:    p.Currency,
+		Email:       p.Email,
+		Customer:    p.StripeCustomerID,
+		Description: p.Description,
+		Metadata:    md,
+		UseTestPM:   s.cfg.StripeEnableTestPM,
+		TestPM:      s.cfg.StripeTestPaymentPM,
+	}
+}
+
+// save aplica mutate e grava o pagamento. Se outro escritor alterou o
+// pagamento desde a leitura, recarrega o estado atual e reaplica mutate, que
+// deve ser convergente: quando o estado desejado já foi alcançado, não muda
+// nada e nada é gravado.
+func (s *PaymentSaga) save(p *payment.Payment, o payment.Origin, mutate func(q *payment.Payment) error) (*payment.Payment, error) {
+	for attempt := 1; ; attempt++ {
+		p.SetOrigin(o)
+		if err := mutate(p); err != nil {
+			return nil, err
+		}
+		if len(p.PendingEvents()) == 0 {
+			return p, nil
+		}
+		err := s.repo.Update(p)
+		if err == nil {
+			return p, nil
+		}
+		if !errors.Is(err, payment.ErrConflict) || attempt == maxConflictAttempts {
+			return nil, err
+		}
+		s.zl.Warn("payment_version_conflict",
+			zap.String("payment_id", p.ID),
+			zap.Int("attempt", attempt),
+			zap.String("err", err.Error()))
+		if p, err = s.repo.Get(p.ID); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// fail marca o pagamento como failed se ele ainda estiver num dos status
+// informados; se outro escritor já o moveu adiante, nada muda.
+func (s *PaymentSaga) fail(ctx context.Context, p *payment.Payment, from ...payment.Status) {
+	_, err := s.save(p, sagaOrigin(ctx), func(q *payment.Payment) error {
+		if slices.Contains(from, q.Status) {
+			q.MarkFailed()
+		}
+		return nil
+	})
+	if err != nil {
+		s.zl.Warn("payment_mark_failed_error",
+			zap.String("payment_id", p.ID),
+			zap.String("err", err.Error()))
+	}
+}
+
+// sagaOrigin marca transições decididas pela própria saga (risco, falhas e
+// compensações), preservando o request ID da chamada original.
+func sagaOrigin(ctx context.Context) payment.Origin {
+	o := payment.OriginFrom(ctx)
+	o.Source = payment.SourceSaga
+	return o
 }
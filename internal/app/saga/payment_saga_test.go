@@ -0,0 +1,428 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v76"
+	"github.com/williamkoller/golang-payment-stripe/internal/app/ports"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/config"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/idempotency"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/outbox"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/repo/memory"
+	"go.uber.org/zap"
+)
+
+// gatewayCall é uma chamada recebida pelo stubGateway.
+type gatewayCall struct {
+	op      string
+	idemKey string
+	piID    string
+	amount  int64
+}
+
+// stubGateway registra as chamadas ao Stripe e responde com sucesso, salvo
+// nos campos configurados pelo teste.
+type stubGateway struct {
+	mu        sync.Mutex
+	calls     []gatewayCall
+	authorize ports.AuthorizeResult
+	incrErr   error
+	method    ports.PaymentMethodRef
+}
+
+func (g *stubGateway) record(c gatewayCall) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.calls = append(g.calls, c)
+}
+
+// called devolve as chamadas da operação op, em ordem.
+func (g *stubGateway) called(op string) []gatewayCall {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var out []gatewayCall
+	for _, c := range g.calls {
+		if c.op == op {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (g *stubGateway) AuthorizeManual(_ context.Context, in ports.AuthorizeInput) (ports.AuthorizeResult, error) {
+	g.record(gatewayCall{op: "authorize", idemKey: in.IdemKey, amount: in.Amount})
+	return g.authorize, nil
+}
+
+func (g *stubGateway) IncrementAuthorization(_ context.Context, idemKey, piID string, amount int64) error {
+	g.record(gatewayCall{op: "increment", idemKey: idemKey, piID: piID, amount: amount})
+	return g.incrErr
+}
+
+func (g *stubGateway) Capture(_ context.Context, idemKey, piID string, amount int64) error {
+	g.record(gatewayCall{op: "capture", idemKey: idemKey, piID: piID, amount: amount})
+	return nil
+}
+
+func (g *stubGateway) Cancel(_ context.Context, idemKey, piID string) error {
+	g.record(gatewayCall{op: "cancel", idemKey: idemKey, piID: piID})
+	return nil
+}
+
+// Refund devolve o mesmo refund para a mesma chave, como o Stripe.
+func (g *stubGateway) Refund(_ context.Context, idemKey, piID string, amount int64, _ string) (string, error) {
+	for _, c := range g.called("refund") {
+		if c.idemKey == idemKey {
+			return "re_" + c.idemKey, nil
+		}
+	}
+	g.record(gatewayCall{op: "refund", idemKey: idemKey, piID: piID, amount: amount})
+	return "re_" + idemKey, nil
+}
+
+func (g *stubGateway) PaymentMethodOf(context.Context, string) (ports.PaymentMethodRef, error) {
+	return g.method, nil
+}
+
+func (g *stubGateway) Card(context.Context, string, string) (payment.Card, error) {
+	return payment.Card{}, nil
+}
+
+func (g *stubGateway) VerifyWebhookSignature([]byte, string) (stripe.Event, error) {
+	return stripe.Event{}, errors.New("not implemented")
+}
+
+func newSaga(t *testing.T) (*PaymentSaga, *memory.PaymentRepo, *stubGateway) {
+	t.Helper()
+	repo := memory.NewPaymentRepo(outbox.NewMemoryStore())
+	pg := &stubGateway{}
+	return NewPaymentSaga(zap.NewNop(), repo, pg, nil, &config.Config{}), repo, pg
+}
+
+// authorized grava um pagamento de amount autorizado no PaymentIntent pi_1.
+func authorized(t *testing.T, repo *memory.PaymentRepo, amount int64) *payment.Payment {
+	t.Helper()
+	p, err := payment.New("pay_1", payment.Money{Amount: amount, Currency: "brl"}, "buyer@example.com",
+		payment.Details{}, payment.Origin{Source: payment.SourceAPI})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Create(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.MarkAuthorized("pi_1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Update(p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// captured grava um pagamento de amount autorizado e capturado por inteiro.
+func captured(t *testing.T, repo *memory.PaymentRepo, amount int64) *payment.Payment {
+	t.Helper()
+	p := authorized(t, repo, amount)
+	if err := p.MarkCaptured(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Update(p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestRefundAllowsMultiplePartialRefunds(t *testing.T) {
+	s, repo, pg := newSaga(t)
+	p := captured(t, repo, 5000)
+	ctx := context.Background()
+
+	p, err := s.Refund(ctx, p, 1000, "requested_by_customer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = s.Refund(ctx, p, 1500, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != payment.StatusPartiallyRefunded || p.RefundedAmount != 2500 || p.RefundableAmount() != 2500 {
+		t.Fatalf("status = %s, refunded = %d, refundable = %d", p.Status, p.RefundedAmount, p.RefundableAmount())
+	}
+
+	// amount zero devolve o saldo restante
+	p, err = s.Refund(ctx, p, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != payment.StatusRefunded || p.RefundedAmount != 5000 || len(p.Refunds) != 3 {
+		t.Fatalf("status = %s, refunded = %d, refunds = %d", p.Status, p.RefundedAmount, len(p.Refunds))
+	}
+	calls := pg.called("refund")
+	if len(calls) != 3 || calls[2].amount != 2500 || calls[0].idemKey == calls[1].idemKey {
+		t.Fatalf("refund calls = %+v, want three with distinct keys", calls)
+	}
+
+	if _, err := s.Refund(ctx, p, 0, ""); err == nil {
+		t.Fatal("refund of a fully refunded payment must fail")
+	}
+	stored, _ := repo.Get(p.ID)
+	if stored.RefundedAmount != 5000 || len(stored.Refunds) != 3 {
+		t.Fatalf("stored refunded = %d, refunds = %d", stored.RefundedAmount, len(stored.Refunds))
+	}
+}
+
+func TestRefundRejectsAmountAboveRefundable(t *testing.T) {
+	s, repo, pg := newSaga(t)
+	p := captured(t, repo, 5000)
+
+	p, err := s.Refund(context.Background(), p, 4000, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Refund(context.Background(), p, 1001, ""); err == nil {
+		t.Fatal("refund above the refundable amount must fail")
+	}
+	if n := len(pg.called("refund")); n != 1 {
+		t.Fatalf("refund calls = %d, want the rejected one not sent to the gateway", n)
+	}
+}
+
+func TestRefundRetryWithSameKeyIsRecordedOnce(t *testing.T) {
+	s, repo, pg := newSaga(t)
+	p := captured(t, repo, 5000)
+	ctx := idempotency.WithKey(context.Background(), "key-1")
+	stale := p.Clone()
+
+	if _, err := s.Refund(ctx, p, 1000, ""); err != nil {
+		t.Fatal(err)
+	}
+	// a mesma chamada refeita sobre a cópia lida antes do primeiro refund
+	got, err := s.Refund(ctx, stale, 1000, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pg.called("refund")) != 1 {
+		t.Fatalf("refund calls = %d, want the same Stripe refund reused", len(pg.called("refund")))
+	}
+	if got.RefundedAmount != 1000 || len(got.Refunds) != 1 {
+		t.Fatalf("refunded = %d, refunds = %d, want a single refund recorded", got.RefundedAmount, len(got.Refunds))
+	}
+}
+
+func TestPartialCaptureTracksCapturedAmount(t *testing.T) {
+	s, repo, pg := newSaga(t)
+	p := authorized(t, repo, 5000)
+
+	p, err := s.Capture(context.Background(), p, 3000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != payment.StatusCaptured || p.CapturedAmount != 3000 || p.Amount != 5000 {
+		t.Fatalf("status = %s, captured = %d, amount = %d", p.Status, p.CapturedAmount, p.Amount)
+	}
+	if calls := pg.called("capture"); len(calls) != 1 || calls[0].amount != 3000 || calls[0].piID != "pi_1" {
+		t.Fatalf("capture calls = %+v, want 3000 on pi_1", calls)
+	}
+
+	// só o valor capturado pode ser devolvido
+	if p.RefundableAmount() != 3000 {
+		t.Fatalf("refundable = %d, want 3000", p.RefundableAmount())
+	}
+	if _, err := s.Refund(context.Background(), p, 3001, ""); err == nil {
+		t.Fatal("refund above the captured amount must fail")
+	}
+}
+
+func TestCaptureWithoutAmountCapturesAuthorizedAmount(t *testing.T) {
+	s, repo, pg := newSaga(t)
+	p := authorized(t, repo, 5000)
+
+	p, err := s.Capture(context.Background(), p, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.CapturedAmount != 5000 || pg.called("capture")[0].amount != 5000 {
+		t.Fatalf("captured = %d, want the authorized 5000", p.CapturedAmount)
+	}
+}
+
+func TestCaptureRejectsAmountAboveAuthorized(t *testing.T) {
+	s, repo, pg := newSaga(t)
+	p := authorized(t, repo, 5000)
+
+	if _, err := s.Capture(context.Background(), p, 5001); err == nil {
+		t.Fatal("capture above the authorized amount must fail")
+	}
+	if len(pg.called("capture")) != 0 {
+		t.Fatal("rejected capture must not reach the gateway")
+	}
+	stored, _ := repo.Get(p.ID)
+	if stored.Status != payment.StatusAuthorized || stored.CapturedAmount != 0 {
+		t.Fatalf("stored status = %s, captured = %d", stored.Status, stored.CapturedAmount)
+	}
+}
+
+func TestUpdateAmountIncrementsAuthorization(t *testing.T) {
+	s, repo, pg := newSaga(t)
+	p := authorized(t, repo, 5000)
+
+	p, err := s.UpdateAmount(context.Background(), p, 7000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Amount != 7000 || p.StripePaymentIntentID != "pi_1" {
+		t.Fatalf("amount = %d, pi = %s, want 7000 on pi_1", p.Amount, p.StripePaymentIntentID)
+	}
+	if calls := pg.called("increment"); len(calls) != 1 || calls[0].amount != 7000 || calls[0].piID != "pi_1" {
+		t.Fatalf("increment calls = %+v", calls)
+	}
+	last := p.AmountChanges[len(p.AmountChanges)-1]
+	if last.Method != payment.AmountChangeIncrement || last.From != 5000 || last.To != 7000 {
+		t.Fatalf("amount change = %+v", last)
+	}
+}
+
+func TestUpdateAmountReducesWithoutGateway(t *testing.T) {
+	s, repo, pg := newSaga(t)
+	p := authorized(t, repo, 5000)
+
+	p, err := s.UpdateAmount(context.Background(), p, 3000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Amount != 3000 || len(pg.calls) != 0 {
+		t.Fatalf("amount = %d, gateway calls = %+v, want a local reduction", p.Amount, pg.calls)
+	}
+	// a captura fica limitada ao novo valor
+	if _, err := s.Capture(context.Background(), p, 4000); err == nil {
+		t.Fatal("capture above the reduced amount must fail")
+	}
+}
+
+func TestUpdateAmountReauthorizesWhenIncrementUnsupported(t *testing.T) {
+	s, repo, pg := newSaga(t)
+	pg.incrErr = ports.ErrIncrementalAuthUnsupported
+	pg.method = ports.PaymentMethodRef{PaymentMethodID: "pm_1", CustomerID: "cus_1"}
+	pg.authorize = ports.AuthorizeResult{PaymentIntentID: "pi_2", Status: ports.IntentRequiresCapture}
+	p := authorized(t, repo, 5000)
+
+	p, err := s.UpdateAmount(context.Background(), p, 7000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Amount != 7000 || p.StripePaymentIntentID != "pi_2" {
+		t.Fatalf("amount = %d, pi = %s, want 7000 on pi_2", p.Amount, p.StripePaymentIntentID)
+	}
+	if calls := pg.called("authorize"); len(calls) != 1 || calls[0].amount != 7000 {
+		t.Fatalf("authorize calls = %+v", calls)
+	}
+	// a autorização anterior só é cancelada depois da nova
+	if calls := pg.called("cancel"); len(calls) != 1 || calls[0].piID != "pi_1" {
+		t.Fatalf("cancel calls = %+v, want pi_1 canceled", calls)
+	}
+	if old, err := repo.GetByPaymentIntent("pi_1"); err != nil || old.ID != p.ID {
+		t.Fatalf("GetByPaymentIntent(pi_1) = %v, %v", old, err)
+	}
+}
+
+func TestUpdateAmountKeepsAuthorizationWhenReauthorizationFails(t *testing.T) {
+	s, repo, pg := newSaga(t)
+	pg.incrErr = ports.ErrIncrementalAuthUnsupported
+	pg.method = ports.PaymentMethodRef{PaymentMethodID: "pm_1", CustomerID: "cus_1"}
+	pg.authorize = ports.AuthorizeResult{PaymentIntentID: "pi_2", Status: ports.IntentRequiresAction}
+	p := authorized(t, repo, 5000)
+
+	if _, err := s.UpdateAmount(context.Background(), p, 7000); err == nil {
+		t.Fatal("reauthorization that needs the customer must fail")
+	}
+	// o novo PaymentIntent é cancelado e o anterior continua valendo
+	if calls := pg.called("cancel"); len(calls) != 1 || calls[0].piID != "pi_2" {
+		t.Fatalf("cancel calls = %+v, want only pi_2 canceled", calls)
+	}
+	stored, _ := repo.Get(p.ID)
+	if stored.Amount != 5000 || stored.StripePaymentIntentID != "pi_1" || stored.Status != payment.StatusAuthorized {
+		t.Fatalf("stored amount = %d, pi = %s, status = %s", stored.Amount, stored.StripePaymentIntentID, stored.Status)
+	}
+}
+
+// conflictingRepo falha todo Update com conflito de versão.
+type conflictingRepo struct {
+	*memory.PaymentRepo
+	updates int
+}
+
+func (r *conflictingRepo) Update(p *payment.Payment) error {
+	r.updates++
+	return &payment.ConflictError{ID: p.ID, Expected: p.Version, Actual: p.Version + 1}
+}
+
+func TestSaveReappliesChangeAfterConflict(t *testing.T) {
+	s, repo, _ := newSaga(t)
+	p := authorized(t, repo, 5000)
+	stale := p.Clone()
+
+	// outro escritor grava o pagamento entre a leitura e a captura
+	if err := p.FlagExpiring(time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Update(p); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Capture(context.Background(), stale, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != payment.StatusCaptured || !got.ExpiryFlagged() {
+		t.Fatalf("status = %s, flagged = %v, want the capture over the other write", got.Status, got.ExpiryFlagged())
+	}
+	if got.Version != p.Version+1 {
+		t.Fatalf("version = %d, want %d", got.Version, p.Version+1)
+	}
+}
+
+func TestSaveSkipsWriteWhenOtherWriterConverged(t *testing.T) {
+	s, repo, pg := newSaga(t)
+	p := authorized(t, repo, 5000)
+	stale := p.Clone()
+
+	// o webhook payment_intent.succeeded grava a captura antes da saga
+	if err := p.MarkCaptured(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Update(p); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Capture(context.Background(), stale, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pg.called("capture")) != 1 {
+		t.Fatal("capture must still reach the gateway")
+	}
+	stored, _ := repo.Get(p.ID)
+	if got.Status != payment.StatusCaptured || stored.Version != p.Version {
+		t.Fatalf("status = %s, version = %d, want no second write (%d)", got.Status, stored.Version, p.Version)
+	}
+}
+
+func TestSaveGivesUpAfterMaxConflictAttempts(t *testing.T) {
+	_, mem, pg := newSaga(t)
+	p := authorized(t, mem, 5000)
+	repo := &conflictingRepo{PaymentRepo: mem}
+	s := NewPaymentSaga(zap.NewNop(), repo, pg, nil, &config.Config{})
+
+	_, err := s.Capture(context.Background(), p, 0)
+	if !errors.Is(err, payment.ErrConflict) {
+		t.Fatalf("err = %v, want ErrConflict", err)
+	}
+	if repo.updates != maxConflictAttempts {
+		t.Fatalf("updates = %d, want %d", repo.updates, maxConflictAttempts)
+	}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/williamkoller/golang-payment-stripe/internal/app/ports"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/customer"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/pkg/ulidx"
+	"go.uber.org/zap"
+)
+
+// CustomerService mantém os clientes locais sincronizados com os Customers do
+// Stripe: toda escrita vai primeiro ao Stripe e só então ao repositório.
+type CustomerService struct {
+	zl       *zap.Logger
+	repo     customer.Repository
+	gw       ports.CustomerGateway
+	payments payment.Repository
+	val      *validator.Validate
+}
+
+func NewCustomerService(zl *zap.Logger, repo customer.Repository, gw ports.CustomerGateway, payments payment.Repository) *CustomerService {
+	return &CustomerService{
+		zl:       zl,
+		repo:     repo,
+		gw:       gw,
+		payments: payments,
+		val:      validator.New(validator.WithRequiredStructEnabled()),
+	}
+}
+
+type CustomerInput struct {
+	Email    string            `json:"email" validate:"required,email"`
+	Name     string            `json:"name" validate:"max=255"`
+	Phone    string            `json:"phone" validate:"max=32"`
+	Metadata map[string]string `json:"metadata" validate:"max=50,dive,keys,min=1,max=40,endkeys,max=500"`
+}
+
+func (s *CustomerService) Create(ctx context.Context, in CustomerInput) (*customer.Customer, error) {
+	if err := s.val.Struct(in); err != nil {
+		return nil, err
+	}
+	c, err := customer.New(ulidx.New(), payment.Email(in.Email), in.Name, in.Phone, in.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.GetByEmail(c.Email); err == nil {
+		return nil, customer.ErrEmailInUse
+	}
+
+	stripeID, err := s.gw.CreateCustomer(ctx, stripeCustomerInput(c, "cus-"+c.ID))
+	if err != nil {
+		return nil, err
+	}
+	c.StripeCustomerID = stripeID
+	if err := s.repo.Create(c); err != nil {
+		// desfaz o Customer criado no Stripe para não deixar órfão
+		if derr := s.gw.DeleteCustomer(context.Background(), stripeID); derr != nil {
+			s.zl.Warn("stripe_customer_orphaned",
+				zap.String("customer_id", c.ID),
+				zap.String("stripe_customer_id", stripeID),
+				zap.String("err", derr.Error()))
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *CustomerService) Get(ctx context.Context, id string) (*customer.Customer, error) {
+	return s.repo.Get(id)
+}
+
+func (s *CustomerService) List(ctx context.Context) ([]*customer.Customer, error) {
+	return s.repo.List()
+}
+
+type CustomerUpdateInput struct {
+	Email    *string           `json:"email" validate:"omitempty,email"`
+	Name     *string           `json:"name" validate:"omitempty,max=255"`
+	Phone    *string           `json:"phone" validate:"omitempty,max=32"`
+	Metadata map[string]string `json:"metadata" validate:"max=50,dive,keys,min=1,max=40,endkeys,max=500"`
+}
+
+func (s *CustomerService) Update(ctx context.Context, id string, in CustomerUpdateInput) (*customer.Customer, error) {
+	if err := s.val.Struct(in); err != nil {
+		return nil, err
+	}
+	c, err := s.repo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Apply(customer.Changes{Email: in.Email, Name: in.Name, Phone: in.Phone, Metadata: in.Metadata}); err != nil {
+		return nil, err
+	}
+	if other, err := s.repo.GetByEmail(c.Email); err == nil && other.ID != c.ID {
+		return nil, customer.ErrEmailInUse
+	}
+	if c.StripeCustomerID != "" {
+		if err := s.gw.UpdateCustomer(ctx, c.StripeCustomerID, stripeCustomerInput(c, "")); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.repo.Update(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Delete remove o Customer do Stripe e o registro local. Os pagamentos
+// mantêm o customer_id para consulta.
+func (s *CustomerService) Delete(ctx context.Context, id string) error {
+	c, err := s.repo.Get(id)
+	if err != nil {
+		return err
+	}
+	if c.StripeCustomerID != "" {
+		if err := s.gw.DeleteCustomer(ctx, c.StripeCustomerID); err != nil {
+			return err
+		}
+	}
+	return s.repo.Delete(id)
+}
+
+func (s *CustomerService) Payments(ctx context.Context, id, cursor string, limit int) (payment.Page, error) {
+	if _, err := s.repo.Get(id); err != nil {
+		return payment.Page{}, err
+	}
+	if err := s.val.Var(cursor, "omitempty,ulid"); err != nil {
+		return payment.Page{}, errors.New("invalid cursor")
+	}
+	return s.payments.List(payment.Query{CustomerID: id, Cursor: cursor, Limit: limit})
+}
+
+func stripeCustomerInput(c *customer.Customer, idem string) ports.CustomerInput {
+	md := make(map[string]string, len(c.Metadata)+1)
+	for k, v := range c.Metadata {
+		md[k] = v
+	}
+	md["customer_id"] = c.ID
+	return ports.CustomerInput{
+		IdemKey:  idem,
+		Email:    c.Email,
+		Name:     c.Name,
+		Phone:    c.Phone,
+		Metadata: md,
+	}
+}
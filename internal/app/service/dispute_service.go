@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/app/ports"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/dispute"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/pkg/ulidx"
+	"go.uber.org/zap"
+)
+
+// MaxEvidenceFileSize é o limite do Stripe para arquivos de evidência.
+const MaxEvidenceFileSize = 5 << 20
+
+// DisputeService mantém as disputas sincronizadas com o Stripe e reflete a
+// abertura e o encerramento delas no pagamento.
+type DisputeService struct {
+	zl       *zap.Logger
+	repo     dispute.Repository
+	payments payment.Repository
+	gw       ports.DisputeGateway
+}
+
+func NewDisputeService(zl *zap.Logger, repo dispute.Repository, payments payment.Repository, gw ports.DisputeGateway) *DisputeService {
+	return &DisputeService{zl: zl, repo: repo, payments: payments, gw: gw}
+}
+
+// Sync cria ou atualiza a disputa a partir do snapshot recebido no webhook e
+// aplica a transição correspondente ao pagamento. Devolve false se o
+// snapshot for mais antigo que o já aplicado.
+func (s *DisputeService) Sync(ctx context.Context, snap dispute.Snapshot) (bool, error) {
+	if !snap.Status.Valid() {
+		return false, fmt.Errorf("unknown dispute status %q", snap.Status)
+	}
+	p, err := s.payments.GetByPaymentIntent(snap.PaymentIntentID)
+	if err != nil {
+		return false, fmt.Errorf("payment for %s: %w", snap.PaymentIntentID, err)
+	}
+	d, err := s.repo.GetByStripeID(snap.StripeDisputeID)
+	created := errors.Is(err, dispute.ErrNotFound)
+	changed := true
+	switch {
+	case created:
+		d = dispute.New(ulidx.New(), p.ID, snap)
+		err = s.repo.Create(d)
+	case err != nil:
+		return false, err
+	case d.Sync(snap):
+		err = s.repo.Update(d)
+	default:
+		changed = false
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// a disputa é gravada antes do pagamento: se syncPayment falhar, a
+	// reentrega do evento encontra a disputa e completa o pagamento
+	if err := s.syncPayment(ctx, p.ID, d); err != nil {
+		return false, err
+	}
+	if !changed {
+		return false, nil
+	}
+	if created {
+		s.zl.Warn("dispute_opened",
+			zap.String("dispute_id", d.ID),
+			zap.String("payment_id", d.PaymentID),
+			zap.String("reason", d.Reason),
+			zap.Int64("amount", d.Amount),
+			zap.Time("evidence_due_by", d.EvidenceDueBy))
+	}
+	return true, nil
+}
+
+// syncPayment abre, atualiza ou encerra a disputa no pagamento, refazendo a
+// operação em conflito de versão.
+func (s *DisputeService) syncPayment(ctx context.Context, paymentID string, d *dispute.Dispute) error {
+	data := payment.DisputeData{DisputeID: d.ID, Status: string(d.Status), Reason: d.Reason, Amount: d.Amount}
+	for attempt := 1; ; attempt++ {
+		p, err := s.payments.Get(paymentID)
+		if err != nil {
+			return err
+		}
+		p.SetOrigin(payment.OriginFrom(ctx))
+
+		open := p.Status == payment.StatusDisputed && p.DisputeID == d.ID
+		switch {
+		case open && p.DisputeStatus == string(d.Status):
+		case open && d.Status.Closed():
+			err = p.CloseDispute(data, d.Status != dispute.StatusLost)
+		case open:
+			err = p.UpdateDispute(data)
+		case p.DisputeID == d.ID || d.Status.Closed():
+			// já encerrada no pagamento
+		default:
+			if oerr := p.OpenDispute(data); oerr != nil {
+				s.zl.Warn("dispute_payment_not_disputable",
+					zap.String("dispute_id", d.ID),
+					zap.String("payment_id", p.ID),
+					zap.String("status", string(p.Status)))
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if len(p.PendingEvents()) == 0 {
+			return nil
+		}
+		err = s.payments.Update(p)
+		if !errors.Is(err, payment.ErrConflict) || attempt == maxConflictAttempts {
+			return err
+		}
+		s.zl.Warn("payment_operation_conflict_retry",
+			zap.String("payment_id", paymentID),
+			zap.Int("attempt", attempt))
+	}
+}
+
+func (s *DisputeService) Get(ctx context.Context, id string) (*dispute.Dispute, error) {
+	return s.repo.Get(id)
+}
+
+type DisputeListInput struct {
+	PaymentID string
+	Status    string
+	DueWithin time.Duration // só disputas aguardando evidências com prazo dentro do intervalo
+}
+
+func (s *DisputeService) List(ctx context.Context, in DisputeListInput) ([]*dispute.Dispute, error) {
+	q := dispute.Query{PaymentID: in.PaymentID, Status: dispute.Status(in.Status)}
+	if q.Status != "" && !q.Status.Valid() {
+		return nil, fmt.Errorf("invalid status %q", in.Status)
+	}
+	if in.DueWithin < 0 {
+		return nil, errors.New("due_within must be positive")
+	}
+	if in.DueWithin > 0 {
+		q.DueBefore = time.Now().UTC().Add(in.DueWithin)
+	}
+	return s.repo.List(q)
+}
+
+type EvidenceInput struct {
+	Evidence map[string]string `json:"evidence"`
+	Submit   bool              `json:"submit"` // envia ao emissor; depois disso as evidências não mudam
+}
+
+// SubmitEvidence junta os campos às evidências da disputa e os grava no
+// Stripe; campo com valor vazio é apagado.
+func (s *DisputeService) SubmitEvidence(ctx context.Context, id string, in EvidenceInput) (*dispute.Dispute, error) {
+	d, err := s.repo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.AddEvidence(in.Evidence); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string, len(d.Evidence)+len(in.Evidence))
+	for k, v := range in.Evidence {
+		fields[k] = v
+	}
+	for k, v := range d.Evidence {
+		fields[k] = v
+	}
+	if err := s.gw.UpdateDisputeEvidence(ctx, d.StripeDisputeID, fields, in.Submit); err != nil {
+		return nil, err
+	}
+	if in.Submit {
+		d.MarkSubmitted()
+	}
+	if err := s.repo.Update(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// UploadFile envia o arquivo ao Stripe e o referencia no campo field das
+// evidências da disputa.
+func (s *DisputeService) UploadFile(ctx context.Context, id, field, filename string, size int64, r io.Reader) (*dispute.Dispute, error) {
+	if !dispute.FileFields[field] {
+		return nil, fmt.Errorf("unknown evidence file field %q", field)
+	}
+	if size > MaxEvidenceFileSize {
+		return nil, fmt.Errorf("file exceeds %d bytes", MaxEvidenceFileSize)
+	}
+	d, err := s.repo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !d.AcceptsEvidence() {
+		return nil, dispute.ErrClosed
+	}
+	fileID, err := s.gw.UploadDisputeFile(ctx, filename, r)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.AddFile(dispute.File{
+		StripeFileID: fileID,
+		Field:        field,
+		Filename:     filename,
+		Size:         size,
+		UploadedAt:   time.Now().UTC(),
+	}); err != nil {
+		return nil, err
+	}
+	if err := s.gw.UpdateDisputeEvidence(ctx, d.StripeDisputeID, map[string]string{field: fileID}, false); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// WarnDeadlines emite um aviso para cada disputa cujo prazo de evidências
+// vence em até within e marca o aviso como emitido.
+func (s *DisputeService) WarnDeadlines(ctx context.Context, within time.Duration) error {
+	now := time.Now().UTC()
+	ds, err := s.repo.List(dispute.Query{DueBefore: now.Add(within)})
+	if err != nil {
+		return err
+	}
+	for _, d := range ds {
+		if !d.DeadlineNear(now, within) {
+			continue
+		}
+		s.zl.Warn("dispute_evidence_due_soon",
+			zap.String("dispute_id", d.ID),
+			zap.String("payment_id", d.PaymentID),
+			zap.String("status", string(d.Status)),
+			zap.Int64("amount", d.Amount),
+			zap.Time("evidence_due_by", d.EvidenceDueBy),
+			zap.Duration("remaining", d.EvidenceDueBy.Sub(now)))
+		d.MarkDeadlineWarned(now)
+		if err := s.repo.Update(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/notification"
+	"github.com/williamkoller/golang-payment-stripe/pkg/ulidx"
+	"go.uber.org/zap"
+)
+
+type Redeliverer interface {
+	Redeliver(ctx context.Context, deliveryID string) (*notification.Delivery, error)
+}
+
+type NotificationService struct {
+	zl   *zap.Logger
+	repo notification.Repository
+	rd   Redeliverer
+	val  *validator.Validate
+}
+
+func NewNotificationService(zl *zap.Logger, repo notification.Repository, rd Redeliverer) *NotificationService {
+	return &NotificationService{
+		zl:   zl,
+		repo: repo,
+		rd:   rd,
+		val:  validator.New(validator.WithRequiredStructEnabled()),
+	}
+}
+
+type EndpointInput struct {
+	URL         string   `json:"url" validate:"required,url"`
+	Events      []string `json:"events" validate:"omitempty,dive,required,max=64"`
+	Description string   `json:"description" validate:"max=255"`
+}
+
+// RegisterEndpoint cria a inscrição e gera o segredo usado no X-Signature.
+func (s *NotificationService) RegisterEndpoint(ctx context.Context, in EndpointInput) (*notification.Endpoint, error) {
+	if err := s.val.Struct(in); err != nil {
+		return nil, err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	ep, err := notification.NewEndpoint(ulidx.New(), in.URL, secret, in.Description, in.Events)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateEndpoint(ep); err != nil {
+		return nil, err
+	}
+	return ep, nil
+}
+
+func (s *NotificationService) GetEndpoint(ctx context.Context, id string) (*notification.Endpoint, error) {
+	return s.repo.GetEndpoint(id)
+}
+
+func (s *NotificationService) ListEndpoints(ctx context.Context) ([]*notification.Endpoint, error) {
+	return s.repo.ListEndpoints()
+}
+
+func (s *NotificationService) DeleteEndpoint(ctx context.Context, id string) error {
+	return s.repo.DeleteEndpoint(id)
+}
+
+func (s *NotificationService) ListDeliveries(ctx context.Context, endpointID string) ([]*notification.Delivery, error) {
+	if _, err := s.repo.GetEndpoint(endpointID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListDeliveries(endpointID)
+}
+
+func (s *NotificationService) GetDelivery(ctx context.Context, id string) (*notification.Delivery, error) {
+	return s.repo.GetDelivery(id)
+}
+
+func (s *NotificationService) Redeliver(ctx context.Context, id string) (*notification.Delivery, error) {
+	return s.rd.Redeliver(ctx, id)
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
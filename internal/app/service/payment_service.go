@@ -3,84 +3,251 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/williamkoller/golang-payment-stripe/internal/app/cardtesting"
+	"github.com/williamkoller/golang-payment-stripe/internal/app/ports"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/customer"
 	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/risk"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/idempotency"
 	"github.com/williamkoller/golang-payment-stripe/pkg/ulidx"
 
 	"go.uber.org/zap"
 )
 
+// maxConflictAttempts limita quantas vezes uma operação é refeita depois de
+// um conflito de versão do pagamento.
+const maxConflictAttempts = 3
+
 type Repo interface {
 	payment.Repository
 }
 type Saga interface {
 	Authorize(ctx context.Context, p *payment.Payment) (*payment.Payment, error)
-	Capture(ctx context.Context, p *payment.Payment) (*payment.Payment, error)
+	Capture(ctx context.Context, p *payment.Payment, amount int64) (*payment.Payment, error)
 	Cancel(ctx context.Context, p *payment.Payment) (*payment.Payment, error)
+	UpdateAmount(ctx context.Context, p *payment.Payment, amount int64) (*payment.Payment, error)
+	Refund(ctx context.Context, p *payment.Payment, amount int64, reason string) (*payment.Payment, error)
+}
+
+type CustomerFinder interface {
+	Get(id string) (*customer.Customer, error)
+}
+
+// CardTestingGuard bloqueia origens em quarentena e acompanha o resultado
+// das autorizações para detectar teste de cartões.
+type CardTestingGuard interface {
+	Check(ctx context.Context, src cardtesting.Source, captchaToken string) error
+	Record(ctx context.Context, src cardtesting.Source, currency string, amount int64, declined bool)
 }
 
 type PaymentService struct {
-	zl   *zap.Logger
-	repo Repo
-	saga Saga
-	val  *validator.Validate
+	zl        *zap.Logger
+	repo      Repo
+	saga      Saga
+	customers CustomerFinder
+	guard     CardTestingGuard
+	val       *validator.Validate
 }
 
-func NewPaymentService(zl *zap.Logger, repo Repo, saga Saga) *PaymentService {
+func NewPaymentService(zl *zap.Logger, repo Repo, saga Saga, customers CustomerFinder, guard CardTestingGuard) *PaymentService {
 	return &PaymentService{
-		zl:   zl,
-		repo: repo,
-		saga: saga,
-		val:  validator.New(validator.WithRequiredStructEnabled()),
+		zl:        zl,
+		repo:      repo,
+		saga:      saga,
+		customers: customers,
+		guard:     guard,
+		val:       validator.New(validator.WithRequiredStructEnabled()),
 	}
 }
 
 type CreateInput struct {
-	Amount   int64  `json:"amount" validate:"required,gt=0"`
-	Currency string `json:"currency" validate:"required,alpha,len=3"`
-	Email    string `json:"email" validate:"required,email"`
+	Amount     int64  `json:"amount" validate:"required,gt=0"`
+	Currency   string `json:"currency" validate:"required,alpha,len=3"`
+	Email      string `json:"email" validate:"required_without=CustomerID,omitempty,email"`
+	CustomerID string `json:"customer_id" validate:"omitempty,max=64"`
+	// ClientConfirmation cria o PaymentIntent sem confirmar; o frontend
+	// confirma com o client_secret (3-D Secure, redirects).
+	ClientConfirmation bool              `json:"client_confirmation"`
+	Description        string            `json:"description" validate:"max=1000"`
+	OrderReference     string            `json:"order_reference" validate:"max=255"`
+	Metadata           map[string]string `json:"metadata" validate:"max=50,dive,keys,min=1,max=40,endkeys,max=500"`
+	ClientIP           string            `json:"-" validate:"omitempty,ip"`
+	// CaptchaToken é o desafio resolvido por uma origem em quarentena com
+	// CARD_TESTING_ACTION=captcha (header Captcha-Token).
+	CaptchaToken string `json:"-"`
 }
 
+// CreateAndAuthorize cria o pagamento e o autoriza. Com Idempotency-Key, o
+// pagamento é associado à chave antes da autorização: se ela terminar num
+// erro ambíguo do gateway, a nova tentativa com a mesma chave retoma o mesmo
+// pagamento (ver resume) em vez de autorizar outro.
 func (s *PaymentService) CreateAndAuthorize(ctx context.Context, in CreateInput) (*payment.Payment, error) {
 	if err := s.val.Struct(in); err != nil {
 		return nil, err
 	}
+	if id := idempotency.ResourceFrom(ctx); id != "" {
+		return s.resume(ctx, id)
+	}
 	id := ulidx.New()
 	m := payment.Money{Amount: in.Amount, Currency: payment.Currency(strings.ToLower(in.Currency))}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
 	e := payment.Email(in.Email)
-	p, err := payment.New(id, m, e)
+	d := payment.Details{
+		Description:    in.Description,
+		OrderReference: in.OrderReference,
+		Metadata:       in.Metadata,
+
+		ClientConfirmation: in.ClientConfirmation,
+		ClientIP:           in.ClientIP,
+	}
+	if in.CustomerID != "" {
+		c, err := s.customers.Get(in.CustomerID)
+		if err != nil {
+			return nil, err
+		}
+		d.CustomerID = c.ID
+		d.StripeCustomerID = c.StripeCustomerID
+		if e == "" {
+			e = payment.Email(c.Email)
+		}
+	}
+	src := cardtesting.Source{IP: in.ClientIP, Email: string(e)}
+	if err := s.guard.Check(ctx, src, in.CaptchaToken); err != nil {
+		return nil, err
+	}
+	p, err := payment.New(id, m, e, d, payment.OriginFrom(ctx))
 	if err != nil {
 		return nil, err
 	}
 	if err := s.repo.Create(p); err != nil {
 		return nil, err
 	}
-	ctx, cancel := context.WithTimeout(ctx, 25*time.Second)
-	defer cancel()
-	return s.saga.Authorize(ctx, p)
+	if err := idempotency.Attach(ctx, p.ID); err != nil {
+		return nil, err
+	}
+	return s.authorize(ctx, p, src)
 }
 
-func (s *PaymentService) Capture(ctx context.Context, id string) (*payment.Payment, error) {
+// resume retoma o pagamento id, criado por uma tentativa anterior com a mesma
+// Idempotency-Key. Se ele ainda não foi autorizado, a saga autoriza de novo
+// com a mesma chave auth-<id>, e o Stripe devolve o PaymentIntent da primeira
+// tentativa em vez de criar outro; se já avançou (inclusive pelo webhook),
+// devolve o estado atual.
+func (s *PaymentService) resume(ctx context.Context, id string) (*payment.Payment, error) {
 	p, err := s.repo.Get(id)
 	if err != nil {
 		return nil, err
 	}
+	if p.Status != payment.StatusCreated {
+		return p, nil
+	}
+	return s.authorize(ctx, p, cardtesting.Source{IP: p.ClientIP, Email: p.Email})
+}
+
+func (s *PaymentService) authorize(ctx context.Context, p *payment.Payment, src cardtesting.Source) (*payment.Payment, error) {
 	ctx, cancel := context.WithTimeout(ctx, 25*time.Second)
 	defer cancel()
-	return s.saga.Capture(ctx, p)
+	out, err := s.saga.Authorize(ctx, p)
+	// aguardando o frontend ou o 3-D Secure, o resultado chega pelo webhook,
+	// que o registra no guard
+	if err != nil || !out.AwaitingCustomer() || out.LastFailure != nil {
+		s.guard.Record(ctx, src, p.Currency, p.Amount, declined(out, err))
+	}
+	return out, err
 }
 
-func (s *PaymentService) Cancel(ctx context.Context, id string) (*payment.Payment, error) {
-	p, err := s.repo.Get(id)
-	if err != nil {
+// declined indica se a autorização foi recusada pelo emissor ou pelo motor
+// de risco; falhas de infraestrutura não contam.
+func declined(p *payment.Payment, err error) bool {
+	var denied *risk.DeniedError
+	switch {
+	case errors.Is(err, ports.ErrCardDeclined), errors.As(err, &denied):
+		return true
+	case err != nil:
+		return false
+	}
+	return p.Status == payment.StatusRequiresPaymentMethod && p.LastFailure != nil
+}
+
+type CaptureInput struct {
+	Amount int64 `json:"amount" validate:"gte=0"`
+}
+
+func (s *PaymentService) Capture(ctx context.Context, id string, in CaptureInput) (*payment.Payment, error) {
+	if err := s.val.Struct(in); err != nil {
 		return nil, err
 	}
+	ctx, cancel := context.WithTimeout(ctx, 25*time.Second)
+	defer cancel()
+	return s.retryOnConflict(id, func(p *payment.Payment) (*payment.Payment, error) {
+		return s.saga.Capture(ctx, p, in.Amount)
+	})
+}
+
+func (s *PaymentService) Cancel(ctx context.Context, id string) (*payment.Payment, error) {
 	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
-	return s.saga.Cancel(ctx, p)
+	return s.retryOnConflict(id, func(p *payment.Payment) (*payment.Payment, error) {
+		return s.saga.Cancel(ctx, p)
+	})
+}
+
+type UpdateAmountInput struct {
+	Amount int64 `json:"amount" validate:"required,gt=0"`
+}
+
+func (s *PaymentService) UpdateAmount(ctx context.Context, id string, in UpdateAmountInput) (*payment.Payment, error) {
+	if err := s.val.Struct(in); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 25*time.Second)
+	defer cancel()
+	return s.retryOnConflict(id, func(p *payment.Payment) (*payment.Payment, error) {
+		return s.saga.UpdateAmount(ctx, p, in.Amount)
+	})
+}
+
+type RefundInput struct {
+	Amount int64  `json:"amount" validate:"gte=0"`
+	Reason string `json:"reason" validate:"omitempty,oneof=duplicate fraudulent requested_by_customer"`
+}
+
+func (s *PaymentService) Refund(ctx context.Context, id string, in RefundInput) (*payment.Payment, error) {
+	if err := s.val.Struct(in); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 25*time.Second)
+	defer cancel()
+	return s.retryOnConflict(id, func(p *payment.Payment) (*payment.Payment, error) {
+		return s.saga.Refund(ctx, p, in.Amount, in.Reason)
+	})
+}
+
+// retryOnConflict carrega o pagamento e executa op; se a saga desistir por
+// conflito de versão, recarrega e executa op de novo. As chamadas ao Stripe
+// usam chaves de idempotência derivadas do PaymentIntent ou da própria
+// requisição, então repetir op não duplica capturas, cancelamentos ou refunds.
+func (s *PaymentService) retryOnConflict(id string, op func(p *payment.Payment) (*payment.Payment, error)) (*payment.Payment, error) {
+	for attempt := 1; ; attempt++ {
+		p, err := s.repo.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		out, err := op(p)
+		if !errors.Is(err, payment.ErrConflict) || attempt == maxConflictAttempts {
+			return out, err
+		}
+		s.zl.Warn("payment_operation_conflict_retry",
+			zap.String("payment_id", id),
+			zap.Int("attempt", attempt))
+	}
 }
 
 func (s *PaymentService) Get(ctx context.Context, id string) (*payment.Payment, error) {
@@ -89,3 +256,55 @@ func (s *PaymentService) Get(ctx context.Context, id string) (*payment.Payment,
 	}
 	return s.repo.Get(id)
 }
+
+type ListInput struct {
+	Statuses       []string          `json:"status"`
+	Email          string            `json:"email" validate:"omitempty,email"`
+	Currency       string            `json:"currency" validate:"omitempty,alpha,len=3"`
+	OrderReference string            `json:"order_reference"`
+	Metadata       map[string]string `json:"metadata"`
+	AmountMin      int64             `json:"amount_min" validate:"gte=0"`
+	AmountMax      int64             `json:"amount_max" validate:"gte=0"`
+	CreatedFrom    time.Time         `json:"created_from"`
+	CreatedTo      time.Time         `json:"created_to"`
+	Cursor         string            `json:"cursor" validate:"omitempty,ulid"`
+	Limit          int               `json:"limit" validate:"gte=0,lte=200"`
+}
+
+func (s *PaymentService) List(ctx context.Context, in ListInput) (payment.Page, error) {
+	if err := s.val.Struct(in); err != nil {
+		return payment.Page{}, err
+	}
+	if in.AmountMax > 0 && in.AmountMax < in.AmountMin {
+		return payment.Page{}, errors.New("amount_max must be >= amount_min")
+	}
+	if !in.CreatedFrom.IsZero() && !in.CreatedTo.IsZero() && !in.CreatedTo.After(in.CreatedFrom) {
+		return payment.Page{}, errors.New("created_to must be after created_from")
+	}
+	q := payment.Query{
+		Email:          strings.ToLower(in.Email),
+		Currency:       strings.ToLower(in.Currency),
+		OrderReference: in.OrderReference,
+		Metadata:       in.Metadata,
+		MinAmount:      in.AmountMin,
+		MaxAmount:      in.AmountMax,
+		CreatedFrom:    in.CreatedFrom,
+		CreatedTo:      in.CreatedTo,
+		Cursor:         in.Cursor,
+		Limit:          in.Limit,
+	}
+	for _, st := range in.Statuses {
+		if !payment.Status(st).Valid() {
+			return payment.Page{}, fmt.Errorf("invalid status %q", st)
+		}
+		q.Statuses = append(q.Statuses, payment.Status(st))
+	}
+	return s.repo.List(q)
+}
+
+func (s *PaymentService) History(ctx context.Context, id string) ([]payment.Transition, error) {
+	if id == "" {
+		return nil, errors.New("id required")
+	}
+	return s.repo.History(id)
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"go.uber.org/zap"
+)
+
+type ReviewSaga interface {
+	ApproveReview(ctx context.Context, p *payment.Payment, reviewer, note string, capture bool) (*payment.Payment, error)
+	RejectReview(ctx context.Context, p *payment.Payment, reviewer, note string, auto bool) (*payment.Payment, error)
+}
+
+// ReviewService é a fila de revisão manual: pagamentos autorizados que o
+// motor de risco reteve em in_review até a decisão de um operador.
+type ReviewService struct {
+	zl   *zap.Logger
+	repo Repo
+	saga ReviewSaga
+	sla  time.Duration
+	val  *validator.Validate
+}
+
+func NewReviewService(zl *zap.Logger, repo Repo, saga ReviewSaga, sla time.Duration) *ReviewService {
+	return &ReviewService{
+		zl:   zl,
+		repo: repo,
+		saga: saga,
+		sla:  sla,
+		val:  validator.New(validator.WithRequiredStructEnabled()),
+	}
+}
+
+// ReviewItem é um pagamento da fila com o prazo da revisão.
+type ReviewItem struct {
+	*payment.Payment
+	ReviewDueAt time.Time `json:"review_due_at"`
+}
+
+type ReviewQueue struct {
+	Items      []ReviewItem `json:"items"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+type ReviewQueueInput struct {
+	Cursor string `json:"cursor" validate:"omitempty,ulid"`
+	Limit  int    `json:"limit" validate:"gte=0,lte=200"`
+}
+
+// Queue lista os pagamentos em revisão, do mais novo para o mais antigo.
+func (s *ReviewService) Queue(ctx context.Context, in ReviewQueueInput) (ReviewQueue, error) {
+	if err := s.val.Struct(in); err != nil {
+		return ReviewQueue{}, err
+	}
+	page, err := s.repo.List(payment.Query{
+		Statuses: []payment.Status{payment.StatusInReview},
+		Cursor:   in.Cursor,
+		Limit:    in.Limit,
+	})
+	if err != nil {
+		return ReviewQueue{}, err
+	}
+	out := ReviewQueue{Items: make([]ReviewItem, 0, len(page.Items)), NextCursor: page.NextCursor}
+	for _, p := range page.Items {
+		item := ReviewItem{Payment: p}
+		if p.Review != nil {
+			item.ReviewDueAt = p.Review.RequestedAt.Add(s.sla)
+		}
+		out.Items = append(out.Items, item)
+	}
+	return out, nil
+}
+
+type ReviewDecisionInput struct {
+	Reviewer string `json:"reviewer" validate:"required,max=255"`
+	Note     string `json:"note" validate:"max=1000"`
+}
+
+type ApproveReviewInput struct {
+	ReviewDecisionInput
+	// Capture captura o valor autorizado logo após a aprovação.
+	Capture bool `json:"capture"`
+}
+
+// Approve libera o pagamento para captura e, com Capture, já o captura.
+func (s *ReviewService) Approve(ctx context.Context, id string, in ApproveReviewInput) (*payment.Payment, error) {
+	if err := s.val.Struct(in); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 25*time.Second)
+	defer cancel()
+	p, err := s.repo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	out, err := s.saga.ApproveReview(ctx, p, in.Reviewer, in.Note, in.Capture)
+	if err != nil {
+		return nil, err
+	}
+	s.zl.Info("review_approved", zap.String("payment_id", id), zap.String("reviewer", in.Reviewer), zap.Bool("capture", in.Capture))
+	return out, nil
+}
+
+// Reject cancela a autorização do pagamento em revisão.
+func (s *ReviewService) Reject(ctx context.Context, id string, in ReviewDecisionInput) (*payment.Payment, error) {
+	if err := s.val.Struct(in); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	p, err := s.repo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	out, err := s.saga.RejectReview(ctx, p, in.Reviewer, in.Note, false)
+	if err != nil {
+		return nil, err
+	}
+	s.zl.Info("review_rejected", zap.String("payment_id", id), zap.String("reviewer", in.Reviewer))
+	return out, nil
+}
@@ -0,0 +1,93 @@
+package customer
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+)
+
+var (
+	ErrNotFound       = errors.New("customer not found")
+	ErrEmailInUse     = errors.New("customer email already in use")
+	ErrCustomerExists = errors.New("customer already exists")
+)
+
+// Customer agrupa os pagamentos de um comprador e espelha um Customer do Stripe.
+type Customer struct {
+	ID               string           `json:"id"`
+	Email            string           `json:"email"`
+	Name             string           `json:"name,omitempty"`
+	Phone            string           `json:"phone,omitempty"`
+	Metadata         payment.Metadata `json:"metadata,omitempty"`
+	StripeCustomerID string           `json:"stripe_customer_id,omitempty"`
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+}
+
+func New(id string, email payment.Email, name, phone string, md payment.Metadata) (*Customer, error) {
+	if err := email.Validate(); err != nil {
+		return nil, err
+	}
+	if err := md.Validate(); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	return &Customer{
+		ID:        id,
+		Email:     string(email.Normalize()),
+		Name:      strings.TrimSpace(name),
+		Phone:     strings.TrimSpace(phone),
+		Metadata:  md,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// Changes traz os campos a alterar; nil mantém o valor atual.
+type Changes struct {
+	Email    *string
+	Name     *string
+	Phone    *string
+	Metadata payment.Metadata
+}
+
+func (c *Customer) Apply(ch Changes) error {
+	if ch.Email != nil {
+		e := payment.Email(*ch.Email)
+		if err := e.Validate(); err != nil {
+			return err
+		}
+		c.Email = string(e.Normalize())
+	}
+	if ch.Name != nil {
+		c.Name = strings.TrimSpace(*ch.Name)
+	}
+	if ch.Phone != nil {
+		c.Phone = strings.TrimSpace(*ch.Phone)
+	}
+	if ch.Metadata != nil {
+		if err := ch.Metadata.Validate(); err != nil {
+			return err
+		}
+		c.Metadata = ch.Metadata
+	}
+	c.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+func (c *Customer) Clone() *Customer {
+	cp := *c
+	cp.Metadata = c.Metadata.Clone()
+	return &cp
+}
+
+type Repository interface {
+	Create(c *Customer) error
+	Get(id string) (*Customer, error)
+	GetByEmail(email string) (*Customer, error)
+	Update(c *Customer) error
+	Delete(id string) error
+	List() ([]*Customer, error)
+}
@@ -0,0 +1,281 @@
+package dispute
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("dispute not found")
+	ErrClosed   = errors.New("dispute does not accept evidence")
+	ErrExists   = errors.New("dispute already exists")
+)
+
+// Status espelha o status da disputa no Stripe. Os warning_* são consultas
+// do emissor (inquiries), ainda sem estorno dos fundos.
+type Status string
+
+const (
+	StatusWarningNeedsResponse Status = "warning_needs_response"
+	StatusWarningUnderReview   Status = "warning_under_review"
+	StatusWarningClosed        Status = "warning_closed"
+	StatusNeedsResponse        Status = "needs_response"
+	StatusUnderReview          Status = "under_review"
+	StatusWon                  Status = "won"
+	StatusLost                 Status = "lost"
+)
+
+func (s Status) Valid() bool {
+	switch s {
+	case StatusWarningNeedsResponse, StatusWarningUnderReview, StatusWarningClosed,
+		StatusNeedsResponse, StatusUnderReview, StatusWon, StatusLost:
+		return true
+	}
+	return false
+}
+
+// Closed indica que a disputa foi encerrada; só lost perde os fundos.
+func (s Status) Closed() bool {
+	return s == StatusWon || s == StatusLost || s == StatusWarningClosed
+}
+
+// NeedsResponse indica que o Stripe aguarda evidências até EvidenceDueBy.
+func (s Status) NeedsResponse() bool {
+	return s == StatusNeedsResponse || s == StatusWarningNeedsResponse
+}
+
+// TextFields são os campos de texto de evidence aceitos pelo Stripe.
+var TextFields = map[string]bool{
+	"access_activity_log":            true,
+	"billing_address":                true,
+	"cancellation_policy_disclosure": true,
+	"cancellation_rebuttal":          true,
+	"customer_email_address":         true,
+	"customer_name":                  true,
+	"customer_purchase_ip":           true,
+	"duplicate_charge_explanation":   true,
+	"duplicate_charge_id":            true,
+	"product_description":            true,
+	"refund_policy_disclosure":       true,
+	"refund_refusal_explanation":     true,
+	"service_date":                   true,
+	"shipping_address":               true,
+	"shipping_carrier":               true,
+	"shipping_date":                  true,
+	"shipping_tracking_number":       true,
+	"uncategorized_text":             true,
+}
+
+// FileFields são os campos de evidence que recebem o ID de um arquivo
+// enviado ao Stripe (purpose dispute_evidence).
+var FileFields = map[string]bool{
+	"cancellation_policy":            true,
+	"customer_communication":         true,
+	"customer_signature":             true,
+	"duplicate_charge_documentation": true,
+	"receipt":                        true,
+	"refund_policy":                  true,
+	"service_documentation":          true,
+	"shipping_documentation":         true,
+	"uncategorized_file":             true,
+}
+
+// MaxTextLength é o limite do Stripe para cada campo de texto.
+const MaxTextLength = 20000
+
+// Evidence são os campos de evidence do Stripe: texto, ou o ID do arquivo
+// nos campos de FileFields.
+type Evidence map[string]string
+
+func (e Evidence) Validate() error {
+	for k, v := range e {
+		switch {
+		case FileFields[k]:
+		case TextFields[k]:
+			if len(v) > MaxTextLength {
+				return fmt.Errorf("evidence %s exceeds %d characters", k, MaxTextLength)
+			}
+		default:
+			return fmt.Errorf("unknown evidence field %q", k)
+		}
+	}
+	return nil
+}
+
+// File é um arquivo de evidência já enviado ao Stripe.
+type File struct {
+	StripeFileID string    `json:"stripe_file_id"`
+	Field        string    `json:"field"` // campo de FileFields que referencia o arquivo
+	Filename     string    `json:"filename"`
+	Size         int64     `json:"size"`
+	UploadedAt   time.Time `json:"uploaded_at"`
+}
+
+// Dispute é a contestação (chargeback) de um pagamento, sincronizada com a
+// disputa do Stripe pelos webhooks charge.dispute.*.
+type Dispute struct {
+	ID              string `json:"id"`
+	StripeDisputeID string `json:"stripe_dispute_id"`
+	PaymentID       string `json:"payment_id"`
+	PaymentIntentID string `json:"payment_intent_id,omitempty"`
+	ChargeID        string `json:"charge_id,omitempty"`
+	Amount          int64  `json:"amount"`
+	Currency        string `json:"currency"`
+	Reason          string `json:"reason"`
+	Status          Status `json:"status"`
+
+	EvidenceDueBy time.Time `json:"evidence_due_by,omitzero"`
+	Evidence      Evidence  `json:"evidence,omitempty"` // enviado (ou preparado) ao Stripe
+	Files         []File    `json:"files,omitempty"`
+	SubmittedAt   time.Time `json:"submitted_at,omitzero"`
+
+	// DeadlineWarnedAt marca o aviso de prazo já emitido para EvidenceDueBy.
+	DeadlineWarnedAt time.Time `json:"deadline_warned_at,omitzero"`
+	// GatewayEventAt é o created do último evento do Stripe aplicado.
+	GatewayEventAt time.Time `json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Snapshot é o estado da disputa recebido do Stripe em um evento criado em At.
+type Snapshot struct {
+	StripeDisputeID string
+	PaymentIntentID string
+	ChargeID        string
+	Amount          int64
+	Currency        string
+	Reason          string
+	Status          Status
+	EvidenceDueBy   time.Time
+	At              time.Time
+}
+
+func New(id, paymentID string, s Snapshot) *Dispute {
+	now := time.Now().UTC()
+	d := &Dispute{ID: id, PaymentID: paymentID, StripeDisputeID: s.StripeDisputeID, CreatedAt: now}
+	d.Sync(s)
+	return d
+}
+
+// Sync aplica o snapshot; devolve false se ele for mais antigo que o último
+// aplicado. Um novo prazo de evidências libera um novo aviso.
+func (d *Dispute) Sync(s Snapshot) bool {
+	if s.At.Before(d.GatewayEventAt) {
+		return false
+	}
+	if !s.EvidenceDueBy.Equal(d.EvidenceDueBy) {
+		d.DeadlineWarnedAt = time.Time{}
+	}
+	d.PaymentIntentID = s.PaymentIntentID
+	d.ChargeID = s.ChargeID
+	d.Amount = s.Amount
+	d.Currency = s.Currency
+	d.Reason = s.Reason
+	d.Status = s.Status
+	d.EvidenceDueBy = s.EvidenceDueBy
+	d.GatewayEventAt = s.At
+	d.UpdatedAt = time.Now().UTC()
+	return true
+}
+
+// AcceptsEvidence indica se ainda dá para preparar ou enviar evidências.
+func (d *Dispute) AcceptsEvidence() bool {
+	return d.Status.NeedsResponse() && d.SubmittedAt.IsZero()
+}
+
+// AddEvidence junta ev às evidências já preparadas; valor vazio remove o campo.
+func (d *Dispute) AddEvidence(ev Evidence) error {
+	if !d.AcceptsEvidence() {
+		return ErrClosed
+	}
+	if err := ev.Validate(); err != nil {
+		return err
+	}
+	if d.Evidence == nil {
+		d.Evidence = Evidence{}
+	}
+	for k, v := range ev {
+		if v == "" {
+			delete(d.Evidence, k)
+			continue
+		}
+		d.Evidence[k] = v
+	}
+	d.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+// AddFile registra o arquivo enviado ao Stripe e o referencia em f.Field.
+func (d *Dispute) AddFile(f File) error {
+	if !FileFields[f.Field] {
+		return fmt.Errorf("unknown evidence file field %q", f.Field)
+	}
+	if err := d.AddEvidence(Evidence{f.Field: f.StripeFileID}); err != nil {
+		return err
+	}
+	d.Files = append(d.Files, f)
+	return nil
+}
+
+// MarkSubmitted registra o envio final das evidências; o Stripe passa a
+// disputa para under_review.
+func (d *Dispute) MarkSubmitted() {
+	now := time.Now().UTC()
+	d.SubmittedAt = now
+	d.UpdatedAt = now
+}
+
+// DeadlineNear indica se o prazo de evidências vence em até within a partir
+// de now e o aviso ainda não foi emitido.
+func (d *Dispute) DeadlineNear(now time.Time, within time.Duration) bool {
+	return d.AcceptsEvidence() && !d.EvidenceDueBy.IsZero() && d.DeadlineWarnedAt.IsZero() &&
+		!d.EvidenceDueBy.After(now.Add(within))
+}
+
+func (d *Dispute) MarkDeadlineWarned(now time.Time) {
+	d.DeadlineWarnedAt = now
+}
+
+func (d *Dispute) Clone() *Dispute {
+	cp := *d
+	if d.Evidence != nil {
+		cp.Evidence = make(Evidence, len(d.Evidence))
+		for k, v := range d.Evidence {
+			cp.Evidence[k] = v
+		}
+	}
+	cp.Files = append([]File(nil), d.Files...)
+	return &cp
+}
+
+// Query filtra a listagem; campos vazios não filtram. DueBefore seleciona
+// disputas aguardando evidências com prazo até o instante informado.
+type Query struct {
+	PaymentID string
+	Status    Status
+	DueBefore time.Time
+}
+
+func (q Query) Matches(d *Dispute) bool {
+	if q.PaymentID != "" && d.PaymentID != q.PaymentID {
+		return false
+	}
+	if q.Status != "" && d.Status != q.Status {
+		return false
+	}
+	if !q.DueBefore.IsZero() && (!d.Status.NeedsResponse() || d.EvidenceDueBy.IsZero() || d.EvidenceDueBy.After(q.DueBefore)) {
+		return false
+	}
+	return true
+}
+
+type Repository interface {
+	Create(d *Dispute) error
+	Get(id string) (*Dispute, error)
+	GetByStripeID(stripeDisputeID string) (*Dispute, error)
+	Update(d *Dispute) error
+	// List devolve as disputas mais recentes primeiro.
+	List(q Query) ([]*Dispute, error)
+}
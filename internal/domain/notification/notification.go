@@ -0,0 +1,131 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrDuplicateDelivery = errors.New("delivery already exists")
+)
+
+// Endpoint é uma inscrição de um serviço interno para receber eventos de pagamento.
+type Endpoint struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"` // vazio = todos; aceita curinga "payment.*"
+	Description string    `json:"description,omitempty"`
+	Secret      string    `json:"-"` // chave do HMAC; só é devolvida na criação
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func NewEndpoint(id, rawURL, secret, description string, events []string) (*Endpoint, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("url must be an absolute http(s) url")
+	}
+	if secret == "" {
+		return nil, errors.New("secret required")
+	}
+	return &Endpoint{
+		ID:          id,
+		URL:         u.String(),
+		Events:      events,
+		Description: description,
+		Secret:      secret,
+		CreatedAt:   time.Now().UTC(),
+	}, nil
+}
+
+func (e *Endpoint) Matches(eventType string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, pat := range e.Events {
+		if pat == "*" || pat == eventType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pat, "*"); ok && strings.HasPrefix(eventType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"   // aguardando (primeira tentativa ou retentativa)
+	DeliverySucceeded DeliveryStatus = "succeeded" // receptor respondeu 2xx
+	DeliveryFailed    DeliveryStatus = "failed"    // tentativas esgotadas
+)
+
+type Attempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	Manual     bool      `json:"manual,omitempty"`
+}
+
+// Delivery é o envio de um evento para um endpoint, com o log de tentativas.
+type Delivery struct {
+	ID            string          `json:"id"`
+	EndpointID    string          `json:"endpoint_id"`
+	EventID       string          `json:"event_id"`
+	EventType     string          `json:"event_type"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        DeliveryStatus  `json:"status"`
+	Attempts      []Attempt       `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// Record registra o resultado de uma tentativa. next zero significa que não
+// haverá nova tentativa automática.
+func (d *Delivery) Record(a Attempt, next time.Time) {
+	d.Attempts = append(d.Attempts, a)
+	d.UpdatedAt = a.At
+	switch {
+	case a.Error == "" && a.StatusCode >= 200 && a.StatusCode < 300:
+		d.Status = DeliverySucceeded
+		d.NextAttemptAt = time.Time{}
+	case next.IsZero():
+		d.Status = DeliveryFailed
+		d.NextAttemptAt = time.Time{}
+	default:
+		d.Status = DeliveryPending
+		d.NextAttemptAt = next
+	}
+}
+
+// AutoAttempts conta as tentativas agendadas, sem os reenvios manuais.
+func (d *Delivery) AutoAttempts() int {
+	n := 0
+	for _, a := range d.Attempts {
+		if !a.Manual {
+			n++
+		}
+	}
+	return n
+}
+
+type Repository interface {
+	CreateEndpoint(e *Endpoint) error
+	GetEndpoint(id string) (*Endpoint, error)
+	ListEndpoints() ([]*Endpoint, error)
+	DeleteEndpoint(id string) error
+
+	// CreateDelivery retorna ErrDuplicateDelivery se o evento já foi
+	// agendado para o endpoint.
+	CreateDelivery(d *Delivery) error
+	UpdateDelivery(d *Delivery) error
+	GetDelivery(id string) (*Delivery, error)
+	ListDeliveries(endpointID string) ([]*Delivery, error)
+	DueDeliveries(now time.Time, limit int) ([]*Delivery, error)
+}
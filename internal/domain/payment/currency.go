@@ -0,0 +1,112 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// CurrencyInfo descreve uma moeda ISO 4217. Os valores são sempre na unidade
+// menor da moeda: centavos em BRL, ienes em JPY (expoente 0), milésimos de
+// dinar em KWD (expoente 3).
+type CurrencyInfo struct {
+	Code     Currency // minúsculo, como no Stripe
+	Exponent int      // casas decimais da unidade menor
+	// Stripe indica se o Stripe aceita cobranças na moeda.
+	Stripe bool
+	// Limites de uma cobrança na unidade menor; Step é o múltiplo exigido
+	// (o Stripe só aceita valores terminados em 0 nas moedas de três casas).
+	MinAmount int64
+	MaxAmount int64
+	Step      int64
+}
+
+// maxStripeAmount é o maior valor aceito pelo Stripe (8 dígitos).
+const maxStripeAmount = 99_999_999
+
+// currencies é o catálogo de moedas aceitas por este serviço, um subconjunto
+// das que o Stripe suporta. Os mínimos são os publicados pelo
+// Stripe; nas moedas de três casas, sem mínimo publicado, o equivalente a
+// cerca de US$ 0,50.
+var currencies = func() map[Currency]CurrencyInfo {
+	m := make(map[Currency]CurrencyInfo)
+	add := func(code string, exp int, stripe bool, min int64) {
+		step := int64(1)
+		if exp == 3 {
+			step = 10
+		}
+		m[Currency(code)] = CurrencyInfo{Code: Currency(code), Exponent: exp, Stripe: stripe, MinAmount: min, MaxAmount: maxStripeAmount, Step: step}
+	}
+	add("aed", 2, true, 200)
+	add("aud", 2, true, 50)
+	add("bgn", 2, true, 100)
+	add("brl", 2, true, 50)
+	add("cad", 2, true, 50)
+	add("chf", 2, true, 50)
+	add("czk", 2, true, 1500)
+	add("dkk", 2, true, 250)
+	add("eur", 2, true, 50)
+	add("gbp", 2, true, 30)
+	add("hkd", 2, true, 400)
+	add("huf", 2, true, 17500)
+	add("inr", 2, true, 50)
+	add("jpy", 0, true, 50)
+	add("mxn", 2, true, 1000)
+	add("myr", 2, true, 200)
+	add("nok", 2, true, 300)
+	add("nzd", 2, true, 50)
+	add("pln", 2, true, 200)
+	add("ron", 2, true, 200)
+	add("sek", 2, true, 300)
+	add("sgd", 2, true, 50)
+	add("thb", 2, true, 1000)
+	add("usd", 2, true, 50)
+
+	add("bhd", 3, true, 200)
+	add("jod", 3, true, 360)
+	add("kwd", 3, true, 160)
+	add("omr", 3, true, 200)
+	add("tnd", 3, true, 1600)
+
+	// ISO 4217 sem suporte do Stripe
+	add("cuc", 2, false, 0)
+	add("irr", 2, false, 0)
+	add("kpw", 2, false, 0)
+	add("syp", 2, false, 0)
+	return m
+}()
+
+// LookupCurrency devolve a moeda do catálogo; o código não diferencia
+// maiúsculas.
+func LookupCurrency(c Currency) (CurrencyInfo, bool) {
+	info, ok := currencies[Currency(strings.ToLower(string(c)))]
+	return info, ok
+}
+
+// SupportedCurrencies lista, em ordem, as moedas aceitas por este serviço.
+func SupportedCurrencies() []Currency {
+	out := make([]Currency, 0, len(currencies))
+	for c, info := range currencies {
+		if info.Stripe {
+			out = append(out, c)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// Validate verifica se a moeda está no catálogo e é cobrável no Stripe. Uma
+// moeda fora do catálogo pode ser válida no Stripe; só não é aceita aqui.
+func (c Currency) Validate() error {
+	info, ok := LookupCurrency(c)
+	switch {
+	case !ok:
+		return fmt.Errorf("%w: %q is not supported by this service", ErrUnsupportedCurrency, string(c))
+	case !info.Stripe:
+		return fmt.Errorf("%w: %s is not supported by Stripe", ErrUnsupportedCurrency, strings.ToUpper(string(c)))
+	}
+	return nil
+}
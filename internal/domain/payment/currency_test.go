@@ -0,0 +1,86 @@
+package payment
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{Money{Amount: 5500, Currency: "brl"}, "55.00 BRL"},
+		{Money{Amount: 1234, Currency: "usd"}, "12.34 USD"},
+		{Money{Amount: 5, Currency: "eur"}, "0.05 EUR"},
+		{Money{Amount: -1050, Currency: "gbp"}, "-10.50 GBP"},
+		{Money{Amount: 5500, Currency: "jpy"}, "5500 JPY"},
+		{Money{Amount: 1250, Currency: "kwd"}, "1.250 KWD"},
+		{Money{Amount: 5, Currency: "bhd"}, "0.005 BHD"},
+		{Money{Amount: 5500, Currency: "USD"}, "55.00 USD"},
+		// fora do catálogo: sem casas decimais, na unidade menor
+		{Money{Amount: 5500, Currency: "xyz"}, "5500 XYZ"},
+	}
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.want {
+			t.Errorf("Money{%d, %s}.String() = %q, want %q", tt.money.Amount, tt.money.Currency, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		money Money
+		want  string // "" = válido
+	}{
+		{"minimum brl", Money{Amount: 50, Currency: "brl"}, ""},
+		{"below minimum", Money{Amount: 49, Currency: "brl"}, "below the minimum of 0.50 BRL"},
+		{"minimum jpy", Money{Amount: 50, Currency: "jpy"}, ""},
+		{"above maximum", Money{Amount: maxStripeAmount + 1, Currency: "usd"}, "exceeds the maximum of 999999.99 USD"},
+		{"three decimals multiple of 10", Money{Amount: 1250, Currency: "kwd"}, ""},
+		{"three decimals not multiple of 10", Money{Amount: 1255, Currency: "kwd"}, "multiple of 10 minor units"},
+		{"zero", Money{Amount: 0, Currency: "brl"}, "amount must be > 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.money.Validate()
+			switch {
+			case tt.want == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Fatalf("error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrencyValidate(t *testing.T) {
+	if err := Currency("BRL").Validate(); err != nil {
+		t.Fatalf("BRL: %v", err)
+	}
+	for _, c := range []Currency{"ugx", "xyz", "irr"} {
+		err := c.Validate()
+		if !errors.Is(err, ErrUnsupportedCurrency) {
+			t.Fatalf("%s: error = %v, want ErrUnsupportedCurrency", c, err)
+		}
+	}
+	if err := Currency("ugx").Validate(); !strings.Contains(err.Error(), "not supported by this service") {
+		t.Fatalf("ugx: error = %q", err)
+	}
+}
+
+func TestSupportedCurrencies(t *testing.T) {
+	got := SupportedCurrencies()
+	if !slices.IsSorted(got) {
+		t.Fatalf("not sorted: %v", got)
+	}
+	if !slices.Contains(got, "brl") || !slices.Contains(got, "kwd") {
+		t.Fatalf("missing catalogue currencies: %v", got)
+	}
+	if slices.Contains(got, "irr") {
+		t.Fatal("currencies without Stripe support must not be listed")
+	}
+}
@@ -1,16 +1,387 @@
 package payment
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/risk"
+)
+
 type EventType string
 
 const (
-	EvtPaymentAuthorized EventType = "payment.authorized"
-	EvtPaymentCaptured   EventType = "payment.captured"
-	EvtPaymentFailed     EventType = "payment.failed"
-	EvtPaymentCanceled   EventType = "payment.canceled"
+	EvtPaymentCreated       EventType = "payment.created"
+	EvtPaymentAuthorized    EventType = "payment.authorized"
+	EvtPaymentCaptured      EventType = "payment.captured"
+	EvtPaymentFailed        EventType = "payment.failed"
+	EvtPaymentCanceled      EventType = "payment.canceled"
+	EvtPaymentRefunded      EventType = "payment.refunded"
+	EvtPaymentAmountChanged EventType = "payment.amount_changed"
+	EvtPaymentPending       EventType = "payment.pending"
+
+	EvtPaymentAuthorizationExpiring EventType = "payment.authorization_expiring"
+	EvtPaymentRiskAssessed          EventType = "payment.risk_assessed"
+
+	EvtPaymentReviewRequested EventType = "payment.review_requested"
+	EvtPaymentReviewApproved  EventType = "payment.review_approved"
+	EvtPaymentReviewRejected  EventType = "payment.review_rejected"
+
+	EvtPaymentDisputed       EventType = "payment.disputed"
+	EvtPaymentDisputeUpdated EventType = "payment.dispute_updated"
+	EvtPaymentDisputeClosed  EventType = "payment.dispute_closed"
 )
 
 type Event struct {
-	Type      EventType
-	PaymentID string
-	Meta      map[string]string
+	ID         string            `json:"id"`
+	Type       EventType         `json:"type"`
+	PaymentID  string            `json:"payment_id"`
+	Seq        int64             `json:"seq"` // posição no stream do pagamento, a partir de 1
+	OccurredAt time.Time         `json:"occurred_at"`
+	Origin     Origin            `json:"origin"`
+	Data       json.RawMessage   `json:"data,omitempty"`
+	Meta       map[string]string `json:"meta,omitempty"`
+
+	// Sensitive guarda dados pessoais do evento (ver CreatedSensitiveData).
+	// Fica fora do JSON, então não vai para o outbox, os logs nem os
+	// webhooks dos lojistas; só o event store o mantém.
+	Sensitive json.RawMessage `json:"-"`
+}
+
+type CreatedData struct {
+	Amount         int64    `json:"amount"`
+	Currency       string   `json:"currency"`
+	Description    string   `json:"description,omitempty"`
+	OrderReference string   `json:"order_reference,omitempty"`
+	Metadata       Metadata `json:"metadata,omitempty"`
+	CustomerID     string   `json:"customer_id,omitempty"`
+	StripeCustomer string   `json:"stripe_customer_id,omitempty"`
+	ClientConfirm  bool     `json:"client_confirmation,omitempty"`
+	// informados pelo cliente da API em eventos antigos; hoje vêm do Stripe
+	// em RiskAssessedData
+	CardBIN     string `json:"card_bin,omitempty"`
+	CardCountry string `json:"card_country,omitempty"`
+}
+
+// CreatedSensitiveData são os dados pessoais de EvtPaymentCreated, gravados
+// em Event.Sensitive.
+type CreatedSensitiveData struct {
+	Email    string `json:"email"`
+	ClientIP string `json:"client_ip,omitempty"`
+}
+
+type AuthorizedData struct {
+	PaymentIntentID string `json:"payment_intent_id"`
+}
+
+// PendingData traz o status de espera (requires_payment_method,
+// requires_action ou processing) do PaymentIntent.
+type PendingData struct {
+	Status          Status `json:"status"`
+	PaymentIntentID string `json:"payment_intent_id"`
+}
+
+// FailedData traz a recusa do Stripe quando ela é conhecida; sem Status o
+// pagamento vai para failed.
+type FailedData struct {
+	Status          Status   `json:"status,omitempty"`
+	PaymentIntentID string   `json:"payment_intent_id,omitempty"`
+	Failure         *Failure `json:"failure,omitempty"`
+}
+
+// DisputeData resume a disputa do Stripe; Status é o status dela no Stripe.
+type DisputeData struct {
+	DisputeID string `json:"dispute_id"`
+	Status    string `json:"status"`
+	Reason    string `json:"reason,omitempty"`
+	Amount    int64  `json:"amount"`
+	Won       bool   `json:"won,omitempty"` // só em EvtPaymentDisputeClosed
+}
+
+type RiskAssessedData struct {
+	Decision        risk.Decision `json:"decision"`
+	CardFingerprint string        `json:"card_fingerprint,omitempty"`
+	CardBIN         string        `json:"card_bin,omitempty"`
+	CardCountry     string        `json:"card_country,omitempty"`
+}
+
+func riskAssessed(d risk.Decision, card Card) RiskAssessedData {
+	return RiskAssessedData{Decision: d, CardFingerprint: card.Fingerprint, CardBIN: card.BIN, CardCountry: card.Country}
+}
+
+// ReviewRequestedData traz os motivos do risco que pediram a revisão.
+type ReviewRequestedData struct {
+	Reasons []risk.Reason `json:"reasons,omitempty"`
+}
+
+// ReviewDecidedData é a decisão do operador; Auto marca a rejeição pelo SLA.
+type ReviewDecidedData struct {
+	Reviewer string `json:"reviewer"`
+	Note     string `json:"note,omitempty"`
+	Auto     bool   `json:"auto,omitempty"`
+}
+
+// ExpiringData traz o prazo da autorização sinalizada.
+type ExpiringData struct {
+	AuthorizedAt time.Time `json:"authorized_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+type CapturedData struct {
+	Amount int64 `json:"amount"`
+}
+
+// RefundedData traz o registro do refund quando ele existe; MarkRefunded
+// devolve o saldo sem registro próprio.
+type RefundedData struct {
+	Amount int64   `json:"amount"`
+	Refund *Refund `json:"refund,omitempty"`
+}
+
+type AmountChangedData struct {
+	From            int64              `json:"from"`
+	To              int64              `json:"to"`
+	Method          AmountChangeMethod `json:"method"`
+	PaymentIntentID string             `json:"payment_intent_id,omitempty"`
+}
+
+// Rehydrate reconstrói um pagamento reaplicando seu stream de eventos.
+func Rehydrate(evts []Event) (*Payment, error) {
+	if len(evts) == 0 {
+		return nil, errors.New("empty event stream")
+	}
+	p := &Payment{}
+	if err := p.Replay(evts...); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Replay aplica eventos já persistidos, sem registrá-los como pendentes.
+func (p *Payment) Replay(evts ...Event) error {
+	for _, e := range evts {
+		if e.Seq != p.EventSeq+1 {
+			return fmt.Errorf("event %s out of sequence: got %d, want %d", e.ID, e.Seq, p.EventSeq+1)
+		}
+		if err := p.apply(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// raise registra um novo evento e o aplica ao agregado. Os payloads são
+// structs deste pacote, então marshal e apply não falham.
+func (p *Payment) raise(t EventType, data any) {
+	p.raiseWith(t, data, nil)
+}
+
+// raiseWith é raise com dados pessoais em Event.Sensitive.
+func (p *Payment) raiseWith(t EventType, data, sensitive any) {
+	raw, _ := json.Marshal(data)
+	var priv json.RawMessage
+	if sensitive != nil {
+		priv, _ = json.Marshal(sensitive)
+	}
+	seq := p.EventSeq + 1
+	e := Event{
+		ID:         fmt.Sprintf("%s-%d", p.ID, seq),
+		Type:       t,
+		PaymentID:  p.ID,
+		Seq:        seq,
+		OccurredAt: time.Now().UTC(),
+		Origin:     p.origin,
+		Data:       raw,
+		Sensitive:  priv,
+	}
+	_ = p.apply(e)
+	p.pending = append(p.pending, e)
+}
+
+func (p *Payment) apply(e Event) error {
+	switch e.Type {
+	case EvtPaymentCreated:
+		var d CreatedData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		p.ID = e.PaymentID
+		p.Amount = d.Amount
+		p.Currency = d.Currency
+		p.Description = d.Description
+		p.OrderReference = d.OrderReference
+		p.Metadata = d.Metadata
+		p.CustomerID = d.CustomerID
+		p.StripeCustomerID = d.StripeCustomer
+		p.ClientConfirmation = d.ClientConfirm
+		p.CardBIN = d.CardBIN
+		p.CardCountry = d.CardCountry
+		if len(e.Sensitive) > 0 {
+			var s CreatedSensitiveData
+			if err := json.Unmarshal(e.Sensitive, &s); err != nil {
+				return err
+			}
+			p.Email = s.Email
+			p.ClientIP = s.ClientIP
+		}
+		p.CreatedAt = e.OccurredAt
+		p.transition(e, StatusCreated, "")
+
+	case EvtPaymentAuthorized:
+		var d AuthorizedData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		p.StripePaymentIntentID = d.PaymentIntentID
+		p.AuthorizedAt = e.OccurredAt
+		p.transition(e, StatusAuthorized, d.PaymentIntentID)
+
+	case EvtPaymentPending:
+		var d PendingData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		p.StripePaymentIntentID = d.PaymentIntentID
+		p.transition(e, d.Status, d.PaymentIntentID)
+
+	case EvtPaymentCaptured:
+		var d CapturedData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		p.CapturedAmount = d.Amount
+		p.ReleasedAmount = p.Amount - d.Amount
+		p.transition(e, StatusCaptured, p.StripePaymentIntentID)
+
+	case EvtPaymentAmountChanged:
+		var d AmountChangedData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		if d.PaymentIntentID != "" {
+			p.StripePaymentIntentID = d.PaymentIntentID
+			p.AuthorizedAt = e.OccurredAt
+		}
+		p.AmountChanges = append(p.AmountChanges, AmountChange{
+			From:                  d.From,
+			To:                    d.To,
+			Method:                d.Method,
+			StripePaymentIntentID: p.StripePaymentIntentID,
+			At:                    e.OccurredAt,
+		})
+		p.Amount = d.To
+		p.UpdatedAt = e.OccurredAt
+
+	case EvtPaymentRiskAssessed:
+		var d RiskAssessedData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		p.Risk = &d.Decision
+		if d.CardFingerprint != "" {
+			p.CardFingerprint = d.CardFingerprint
+		}
+		if d.CardBIN != "" || d.CardCountry != "" {
+			p.CardBIN, p.CardCountry = d.CardBIN, d.CardCountry
+		}
+		p.UpdatedAt = e.OccurredAt
+
+	case EvtPaymentReviewRequested:
+		var d ReviewRequestedData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		p.Review = &Review{Reasons: d.Reasons, RequestedAt: e.OccurredAt}
+		p.transition(e, StatusInReview, p.StripePaymentIntentID)
+
+	case EvtPaymentReviewApproved, EvtPaymentReviewRejected:
+		var d ReviewDecidedData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		r := Review{}
+		if p.Review != nil {
+			r = *p.Review
+		}
+		r.Reviewer, r.Note, r.Auto, r.DecidedAt = d.Reviewer, d.Note, d.Auto, e.OccurredAt
+		r.Outcome = ReviewRejected
+		if e.Type == EvtPaymentReviewApproved {
+			r.Outcome = ReviewApproved
+		}
+		p.Review = &r
+		if r.Outcome == ReviewApproved {
+			p.transition(e, StatusAuthorized, p.StripePaymentIntentID)
+		} else {
+			// o pagamento segue em in_review até o cancelamento pela saga
+			p.UpdatedAt = e.OccurredAt
+		}
+
+	case EvtPaymentAuthorizationExpiring:
+		p.ExpiryFlaggedAt = e.OccurredAt
+		p.UpdatedAt = e.OccurredAt
+
+	case EvtPaymentCanceled:
+		p.transition(e, StatusCanceled, p.StripePaymentIntentID)
+
+	case EvtPaymentFailed:
+		var d FailedData
+		if len(e.Data) > 0 {
+			if err := json.Unmarshal(e.Data, &d); err != nil {
+				return err
+			}
+		}
+		if d.PaymentIntentID != "" {
+			p.StripePaymentIntentID = d.PaymentIntentID
+		}
+		if d.Failure != nil {
+			p.LastFailure = d.Failure
+		}
+		to := d.Status
+		if to == "" {
+			to = StatusFailed
+		}
+		p.transition(e, to, p.StripePaymentIntentID)
+
+	case EvtPaymentDisputed, EvtPaymentDisputeUpdated, EvtPaymentDisputeClosed:
+		var d DisputeData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		p.DisputeID = d.DisputeID
+		p.DisputeStatus = d.Status
+		switch {
+		case e.Type == EvtPaymentDisputed:
+			p.transition(e, StatusDisputed, d.DisputeID)
+		case e.Type == EvtPaymentDisputeClosed && d.Won:
+			p.transition(e, p.settledStatus(), d.DisputeID)
+		default:
+			p.UpdatedAt = e.OccurredAt
+		}
+
+	case EvtPaymentRefunded:
+		var d RefundedData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		ref := p.StripePaymentIntentID
+		if d.Refund != nil {
+			p.Refunds = append(p.Refunds, *d.Refund)
+			ref = d.Refund.StripeRefundID
+		}
+		p.RefundedAmount += d.Amount
+		to := StatusPartiallyRefunded
+		if p.RefundedAmount >= p.CapturedAmount {
+			to = StatusRefunded
+		}
+		p.transition(e, to, ref)
+
+	default:
+		return fmt.Errorf("unknown event type %q", e.Type)
+	}
+	if e.Origin.GatewayEventAt.After(p.GatewayEventAt) {
+		p.GatewayEventAt = e.Origin.GatewayEventAt
+	}
+	p.EventSeq = e.Seq
+	return nil
 }
@@ -0,0 +1,69 @@
+package payment
+
+import (
+	"context"
+	"time"
+)
+
+type Source string
+
+const (
+	SourceAPI     Source = "api"     // requisição HTTP
+	SourceSaga    Source = "saga"    // decisão/compensação da saga
+	SourceWebhook Source = "webhook" // evento recebido do Stripe
+	SourceJob     Source = "job"     // rotina em background
+)
+
+// Origin identifica quem disparou uma transição. Nas transições vindas do
+// webhook, GatewayEventID/GatewayEventAt são o ID e o created do evento do Stripe.
+type Origin struct {
+	Source         Source    `json:"source"`
+	RequestID      string    `json:"request_id,omitempty"`
+	GatewayEventID string    `json:"gateway_event_id,omitempty"`
+	GatewayEventAt time.Time `json:"gateway_event_at,omitzero"`
+}
+
+type Transition struct {
+	From       Status    `json:"from"`
+	To         Status    `json:"to"`
+	At         time.Time `json:"at"`
+	Source     Source    `json:"source"`
+	RequestID  string    `json:"request_id,omitempty"`
+	GatewayRef string    `json:"gateway_ref,omitempty"`
+
+	GatewayEventID string `json:"gateway_event_id,omitempty"`
+}
+
+type originKey struct{}
+
+func WithOrigin(ctx context.Context, o Origin) context.Context {
+	return context.WithValue(ctx, originKey{}, o)
+}
+
+// OriginFrom devolve a origem gravada no contexto; sem origem, assume a API.
+func OriginFrom(ctx context.Context) Origin {
+	if o, ok := ctx.Value(originKey{}).(Origin); ok {
+		return o
+	}
+	return Origin{Source: SourceAPI}
+}
+
+// SetOrigin define a origem usada pelas próximas transições do pagamento.
+func (p *Payment) SetOrigin(o Origin) {
+	p.origin = o
+}
+
+func (p *Payment) transition(e Event, to Status, gatewayRef string) {
+	p.History = append(p.History, Transition{
+		From:       p.Status,
+		To:         to,
+		At:         e.OccurredAt,
+		Source:     e.Origin.Source,
+		RequestID:  e.Origin.RequestID,
+		GatewayRef: gatewayRef,
+
+		GatewayEventID: e.Origin.GatewayEventID,
+	})
+	p.Status = to
+	p.UpdatedAt = e.OccurredAt
+}
@@ -3,6 +3,8 @@ package payment
 import (
 	"errors"
 	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/risk"
 )
 
 type Status string
@@ -14,8 +16,55 @@ const (
 	StatusCanceled   Status = "canceled"   // autorização cancelada
 	StatusFailed     Status = "failed"     // falha
 	StatusRefunded   Status = "refunded"   // reembolsado
+
+	StatusPartiallyRefunded Status = "partially_refunded" // reembolsado parcialmente
+
+	// Aguardando o cliente (confirmação no frontend, 3-D Secure) ou o banco.
+	StatusRequiresPaymentMethod Status = "requires_payment_method" // sem método de pagamento ou recusado
+	StatusRequiresAction        Status = "requires_action"         // autenticação pendente (3-D Secure)
+	StatusProcessing            Status = "processing"              // em processamento no Stripe
+
+	StatusDisputed Status = "disputed" // contestado pelo portador do cartão (chargeback)
+
+	StatusInReview Status = "in_review" // autorizado no Stripe e retido para revisão manual antes da captura
 )
 
+// Valid indica se s é um status conhecido.
+func (s Status) Valid() bool {
+	switch s {
+	case StatusCreated, StatusAuthorized, StatusCaptured, StatusCanceled,
+		StatusFailed, StatusRefunded, StatusPartiallyRefunded,
+		StatusRequiresPaymentMethod, StatusRequiresAction, StatusProcessing,
+		StatusDisputed, StatusInReview:
+		return true
+	}
+	return false
+}
+
+type Refund struct {
+	ID             string    `json:"id"`
+	Amount         int64     `json:"amount"`
+	Reason         string    `json:"reason,omitempty"`
+	StripeRefundID string    `json:"stripe_refund_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type AmountChangeMethod string
+
+const (
+	AmountChangeIncrement       AmountChangeMethod = "incremental_authorization" // autorização incremental no Stripe
+	AmountChangeReauthorization AmountChangeMethod = "reauthorization"           // novo PaymentIntent, anterior cancelado
+	AmountChangeReduction       AmountChangeMethod = "reduction"                 // diferença liberada na captura
+)
+
+type AmountChange struct {
+	From                  int64              `json:"from"`
+	To                    int64              `json:"to"`
+	Method                AmountChangeMethod `json:"method"`
+	StripePaymentIntentID string             `json:"stripe_payment_intent_id,omitempty"`
+	At                    time.Time          `json:"at"`
+}
+
 type Payment struct {
 	ID        string    `json:"id"`
 	Amount    int64     `json:"amount"`
@@ -25,69 +74,370 @@ type Payment struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
+	Description    string   `json:"description,omitempty"`
+	OrderReference string   `json:"order_reference,omitempty"`
+	Metadata       Metadata `json:"metadata,omitempty"`
+	CustomerID     string   `json:"customer_id,omitempty"`
+	ClientIP       string   `json:"client_ip,omitempty"`
+	// Dados do cartão lidos do Stripe, gravados com a decisão de risco
+	// (RecordRisk) ou depois da confirmação no frontend (RecordCard).
+	CardBIN         string `json:"card_bin,omitempty"`
+	CardCountry     string `json:"card_country,omitempty"`
+	CardFingerprint string `json:"card_fingerprint,omitempty"`
+
+	// ClientConfirmation indica que o PaymentIntent é confirmado pelo
+	// frontend com o client_secret, e não pela API.
+	ClientConfirmation bool `json:"client_confirmation,omitempty"`
+
+	CapturedAmount int64    `json:"captured_amount"`
+	ReleasedAmount int64    `json:"released_amount"` // autorizado e não capturado
+	RefundedAmount int64    `json:"refunded_amount"`
+	Refunds        []Refund `json:"refunds,omitempty"`
+
+	AmountChanges []AmountChange `json:"amount_changes,omitempty"`
+
+	// AuthorizedAt é o início da autorização vigente (a reautorização num
+	// novo PaymentIntent reinicia o prazo); ExpiryFlaggedAt marca o aviso de
+	// que ela está perto de expirar sem captura.
+	AuthorizedAt    time.Time `json:"authorized_at,omitzero"`
+	ExpiryFlaggedAt time.Time `json:"expiry_flagged_at,omitzero"`
+
+	// Disputa (chargeback) mais recente; o detalhe fica no agregado dispute.
+	DisputeID     string `json:"dispute_id,omitempty"`
+	DisputeStatus string `json:"dispute_status,omitempty"`
+
+	// Risk é a última decisão do motor de risco, com os motivos.
+	Risk *risk.Decision `json:"risk,omitempty"`
+
+	// Review é a revisão manual pedida quando o risco decide review.
+	Review *Review `json:"review,omitempty"`
+
+	// LastFailure é a última recusa informada pelo Stripe.
+	LastFailure *Failure `json:"last_failure,omitempty"`
+
 	// Stripe
 	StripePaymentIntentID string `json:"stripe_payment_intent_id,omitempty"`
-	ClientSecret          string `json:"client_secret,omitempty"`
+	StripeCustomerID      string `json:"stripe_customer_id,omitempty"`
+
+	// ClientSecret só é preenchido na resposta da autorização: não entra nos
+	// eventos e os repositórios não o gravam.
+	ClientSecret string `json:"client_secret,omitempty"`
+
+	History []Transition `json:"-"` // exposto em GET /v1/payments/:id/history
+
+	// Version é controlada pelo repositório e muda a cada Update; um Update
+	// com versão desatualizada falha com *ConflictError.
+	Version int64 `json:"version"`
+
+	// GatewayEventAt é o created do evento do Stripe mais recente já aplicado;
+	// eventos anteriores a ele estão fora de ordem (ver Stale).
+	GatewayEventAt time.Time `json:"gateway_event_at,omitzero"`
+
+	// EventSeq é a posição do último evento aplicado ao agregado.
+	EventSeq int64 `json:"-"`
+
+	origin  Origin
+	pending []Event
 }
 
-func New(id string, m Money, email Email) (*Payment, error) {
+// New cria o pagamento registrando EvtPaymentCreated. Todo o estado do
+// agregado é derivado dos eventos aplicados (ver apply em events.go).
+func New(id string, m Money, email Email, d Details, o Origin) (*Payment, error) {
 	if err := m.Validate(); err != nil {
 		return nil, err
 	}
 	if err := email.Validate(); err != nil {
 		return nil, err
 	}
-	now := time.Now().UTC()
-	return &Payment{
-		ID:        id,
-		Amount:    m.Amount,
-		Currency:  string(m.Currency),
-		Email:     string(email.Normalize()),
-		Status:    StatusCreated,
-		CreatedAt: now,
-		UpdatedAt: now,
-	}, nil
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	p := &Payment{ID: id, origin: o}
+	p.raiseWith(EvtPaymentCreated, CreatedData{
+		Amount:         m.Amount,
+		Currency:       string(m.Currency),
+		Description:    d.Description,
+		OrderReference: d.OrderReference,
+		Metadata:       d.Metadata,
+		CustomerID:     d.CustomerID,
+		StripeCustomer: d.StripeCustomerID,
+		ClientConfirm:  d.ClientConfirmation,
+	}, CreatedSensitiveData{Email: string(email.Normalize()), ClientIP: d.ClientIP})
+	return p, nil
 }
 
-func (p *Payment) MarkAuthorized(piID, clientSecret string) error {
-	if p.Status != StatusCreated && p.Status != StatusFailed {
+// AwaitingCustomer indica que o PaymentIntent depende do cliente ou do banco
+// para chegar a requires_capture.
+func (p *Payment) AwaitingCustomer() bool {
+	switch p.Status {
+	case StatusRequiresPaymentMethod, StatusRequiresAction, StatusProcessing:
+		return true
+	}
+	return false
+}
+
+// HoldsAuthorization indica que o PaymentIntent vigente está autorizado e
+// ainda não foi capturado nem cancelado (authorized ou in_review).
+func (p *Payment) HoldsAuthorization() bool {
+	return p.Status == StatusAuthorized || p.Status == StatusInReview
+}
+
+// MarkAuthorized registra a autorização do PaymentIntent piID. Se o motor de
+// risco pediu revisão, o pagamento fica em in_review até um operador aprovar.
+func (p *Payment) MarkAuthorized(piID string) error {
+	if p.Status != StatusCreated && p.Status != StatusFailed && !p.AwaitingCustomer() {
 		return errors.New("invalid state for authorization")
 	}
-	p.Status = StatusAuthorized
-	p.StripePaymentIntentID = piID
-	p.ClientSecret = clientSecret
-	p.UpdatedAt = time.Now().UTC()
+	p.raise(EvtPaymentAuthorized, AuthorizedData{PaymentIntentID: piID})
+	if p.Risk != nil && p.Risk.Outcome == risk.Review {
+		p.raise(EvtPaymentReviewRequested, ReviewRequestedData{Reasons: p.Risk.Reasons})
+	}
 	return nil
 }
 
-func (p *Payment) MarkCaptured() error {
-	if p.Status != StatusAuthorized {
+// MarkPending registra que o PaymentIntent piID ainda não foi autorizado e
+// aguarda o cliente (to = requires_payment_method ou requires_action) ou o
+// processamento (to = processing).
+func (p *Payment) MarkPending(to Status, piID string) error {
+	switch to {
+	case StatusRequiresPaymentMethod, StatusRequiresAction, StatusProcessing:
+	default:
+		return errors.New("invalid pending status")
+	}
+	if p.Status != StatusCreated && p.Status != StatusFailed && !p.AwaitingCustomer() {
+		return errors.New("invalid state for pending confirmation")
+	}
+	p.raise(EvtPaymentPending, PendingData{Status: to, PaymentIntentID: piID})
+	return nil
+}
+
+// MarkCaptured registra a captura de amount; amount == 0 captura todo o valor
+// autorizado. O restante não capturado é considerado liberado. Em in_review
+// só chega pelo webhook de uma captura feita fora da API (Dashboard).
+func (p *Payment) MarkCaptured(amount int64) error {
+	if !p.HoldsAuthorization() {
 		return errors.New("invalid state for capture")
 	}
-	p.Status = StatusCaptured
-	p.UpdatedAt = time.Now().UTC()
+	if amount == 0 {
+		amount = p.Amount
+	}
+	if amount < 0 || amount > p.Amount {
+		return errors.New("capture amount exceeds authorized amount")
+	}
+	p.raise(EvtPaymentCaptured, CapturedData{Amount: amount})
+	return nil
+}
+
+// ChangeAmount altera o valor autorizado antes da captura. Na reautorização
+// piID aponta para o novo PaymentIntent.
+func (p *Payment) ChangeAmount(amount int64, method AmountChangeMethod, piID string) error {
+	if p.Status != StatusAuthorized {
+		return errors.New("invalid state for amount change")
+	}
+	if err := (Money{Amount: amount, Currency: Currency(p.Currency)}).Validate(); err != nil {
+		return err
+	}
+	if amount == p.Amount {
+		return errors.New("amount unchanged")
+	}
+	p.raise(EvtPaymentAmountChanged, AmountChangedData{
+		From:            p.Amount,
+		To:              amount,
+		Method:          method,
+		PaymentIntentID: piID,
+	})
 	return nil
 }
 
 func (p *Payment) MarkCanceled() error {
-	if p.Status != StatusAuthorized && p.Status != StatusCreated {
+	if !p.HoldsAuthorization() && p.Status != StatusCreated && !p.AwaitingCustomer() {
 		return errors.New("invalid state for cancel")
 	}
-	p.Status = StatusCanceled
-	p.UpdatedAt = time.Now().UTC()
+	p.raise(EvtPaymentCanceled, struct{}{})
 	return nil
 }
 
 func (p *Payment) MarkFailed() {
-	p.Status = StatusFailed
-	p.UpdatedAt = time.Now().UTC()
+	p.raise(EvtPaymentFailed, FailedData{})
 }
 
+// MarkDeclined registra a recusa f do PaymentIntent piID. Na confirmação pelo
+// frontend o cliente pode tentar outro método, então o pagamento volta para
+// requires_payment_method; nos demais casos fica failed.
+func (p *Payment) MarkDeclined(piID string, f Failure) error {
+	if p.Status != StatusCreated && p.Status != StatusFailed && !p.AwaitingCustomer() {
+		return errors.New("invalid state for decline")
+	}
+	to := StatusFailed
+	if p.ClientConfirmation {
+		to = StatusRequiresPaymentMethod
+	}
+	p.raise(EvtPaymentFailed, FailedData{Status: to, PaymentIntentID: piID, Failure: &f})
+	return nil
+}
+
+// MarkRefunded registra a devolução de todo o saldo restante sem um refund próprio.
 func (p *Payment) MarkRefunded() error {
-	if p.Status != StatusCaptured {
+	if p.Status != StatusCaptured && p.Status != StatusPartiallyRefunded {
+		return errors.New("invalid state for refund")
+	}
+	p.raise(EvtPaymentRefunded, RefundedData{Amount: p.RefundableAmount()})
+	return nil
+}
+
+// RecordRisk registra a decisão do motor de risco antes da autorização, com
+// o fingerprint do cartão avaliado ("" se desconhecido).
+func (p *Payment) RecordRisk(d risk.Decision, card Card) error {
+	if p.Status != StatusCreated && p.Status != StatusFailed {
+		return errors.New("invalid state for risk assessment")
+	}
+	p.raise(EvtPaymentRiskAssessed, riskAssessed(d, card))
+	return nil
+}
+
+// RecordCard registra o cartão confirmado no frontend, só conhecido depois
+// da avaliação de risco. objections são as das regras de cartão avaliadas
+// nesse momento e se somam à decisão já registrada.
+func (p *Payment) RecordCard(card Card, objections []risk.Reason) error {
+	if p.Status != StatusCreated && p.Status != StatusFailed && !p.AwaitingCustomer() {
+		return errors.New("invalid state for card assessment")
+	}
+	d := risk.Decision{Outcome: risk.Allow}
+	if p.Risk != nil {
+		d = *p.Risk
+		d.Reasons = append([]risk.Reason(nil), p.Risk.Reasons...)
+	}
+	for _, r := range objections {
+		d.Add(r)
+	}
+	p.raise(EvtPaymentRiskAssessed, riskAssessed(d, card))
+	return nil
+}
+
+// FlagExpiring registra que a autorização expira em expiresAt sem ter sido
+// capturada.
+func (p *Payment) FlagExpiring(expiresAt time.Time) error {
+	if p.Status != StatusAuthorized {
+		return errors.New("payment is not authorized")
+	}
+	p.raise(EvtPaymentAuthorizationExpiring, ExpiringData{AuthorizedAt: p.AuthorizedAt, ExpiresAt: expiresAt})
+	return nil
+}
+
+// ExpiryFlagged indica que a autorização vigente já foi sinalizada.
+func (p *Payment) ExpiryFlagged() bool {
+	return !p.ExpiryFlaggedAt.IsZero() && !p.ExpiryFlaggedAt.Before(p.AuthorizedAt)
+}
+
+// OpenDispute registra a contestação d de um pagamento já capturado.
+func (p *Payment) OpenDispute(d DisputeData) error {
+	if p.Status != StatusCaptured && p.Status != StatusPartiallyRefunded && p.Status != StatusRefunded {
+		return errors.New("invalid state for dispute")
+	}
+	p.raise(EvtPaymentDisputed, d)
+	return nil
+}
+
+// UpdateDispute registra a mudança de status da disputa aberta.
+func (p *Payment) UpdateDispute(d DisputeData) error {
+	if p.Status != StatusDisputed || p.DisputeID != d.DisputeID {
+		return errors.New("dispute not open for payment")
+	}
+	p.raise(EvtPaymentDisputeUpdated, d)
+	return nil
+}
+
+// CloseDispute encerra a disputa aberta. Ganha, o pagamento volta ao status
+// anterior à disputa; perdida, fica disputed.
+func (p *Payment) CloseDispute(d DisputeData, won bool) error {
+	if p.Status != StatusDisputed || p.DisputeID != d.DisputeID {
+		return errors.New("dispute not open for payment")
+	}
+	d.Won = won
+	p.raise(EvtPaymentDisputeClosed, d)
+	return nil
+}
+
+// settledStatus é o status do pagamento capturado, derivado dos valores.
+func (p *Payment) settledStatus() Status {
+	switch {
+	case p.RefundedAmount == 0:
+		return StatusCaptured
+	case p.RefundedAmount >= p.CapturedAmount:
+		return StatusRefunded
+	}
+	return StatusPartiallyRefunded
+}
+
+// RefundableAmount é o saldo capturado que ainda pode ser devolvido.
+func (p *Payment) RefundableAmount() int64 {
+	if p.Status != StatusCaptured && p.Status != StatusPartiallyRefunded {
+		return 0
+	}
+	return p.CapturedAmount - p.RefundedAmount
+}
+
+func (p *Payment) AddRefund(r Refund) error {
+	if p.Status != StatusCaptured && p.Status != StatusPartiallyRefunded {
 		return errors.New("invalid state for refund")
 	}
-	p.Status = StatusRefunded
-	p.UpdatedAt = time.Now().UTC()
+	if r.Amount <= 0 {
+		return errors.New("refund amount must be > 0")
+	}
+	if r.Amount > p.RefundableAmount() {
+		return errors.New("refund amount exceeds refundable amount")
+	}
+	p.raise(EvtPaymentRefunded, RefundedData{Amount: r.Amount, Refund: &r})
 	return nil
 }
+
+// HasRefund indica se o refund do Stripe já foi registrado no pagamento.
+func (p *Payment) HasRefund(stripeRefundID string) bool {
+	for _, r := range p.Refunds {
+		if r.StripeRefundID == stripeRefundID {
+			return true
+		}
+	}
+	return false
+}
+
+// Stale indica se um evento do Stripe criado em at é anterior à última
+// mudança vinda do Stripe já aplicada ao pagamento.
+func (p *Payment) Stale(at time.Time) bool {
+	return at.Before(p.GatewayEventAt)
+}
+
+// PendingEvents devolve os eventos ainda não persistidos pelo repositório.
+func (p *Payment) PendingEvents() []Event {
+	return append([]Event(nil), p.pending...)
+}
+
+// ClearPendingEvents é chamado pelo repositório após persistir os eventos.
+func (p *Payment) ClearPendingEvents() {
+	p.pending = nil
+}
+
+// Clone devolve uma cópia profunda do agregado.
+func (p *Payment) Clone() *Payment {
+	cp := *p
+	cp.Refunds = append([]Refund(nil), p.Refunds...)
+	cp.AmountChanges = append([]AmountChange(nil), p.AmountChanges...)
+	cp.History = append([]Transition(nil), p.History...)
+	cp.Metadata = p.Metadata.Clone()
+	if p.LastFailure != nil {
+		f := *p.LastFailure
+		cp.LastFailure = &f
+	}
+	if p.Risk != nil {
+		d := *p.Risk
+		d.Reasons = append([]risk.Reason(nil), p.Risk.Reasons...)
+		cp.Risk = &d
+	}
+	if p.Review != nil {
+		r := *p.Review
+		r.Reasons = append([]risk.Reason(nil), p.Review.Reasons...)
+		cp.Review = &r
+	}
+	cp.pending = append([]Event(nil), p.pending...)
+	return &cp
+}
@@ -0,0 +1,118 @@
+package payment
+
+import (
+	"slices"
+	"time"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+// Query filtra a listagem de pagamentos; campos zero não filtram. O
+// resultado é ordenado do mais novo para o mais antigo pelo ID (ULID), e
+// Cursor é o ID do último item da página anterior.
+type Query struct {
+	Statuses       []Status
+	Email          string
+	Currency       string
+	OrderReference string
+	CustomerID     string
+	Metadata       Metadata // todos os pares precisam coincidir
+	MinAmount      int64
+	MaxAmount      int64
+	CreatedFrom    time.Time // inclusivo
+	CreatedTo      time.Time // exclusivo
+	// AuthorizedBefore (exclusivo) seleciona autorizações iniciadas antes do
+	// instante; pagamentos nunca autorizados ficam de fora.
+	AuthorizedBefore time.Time
+	// ReviewRequestedBefore (exclusivo) seleciona revisões pedidas antes do
+	// instante.
+	ReviewRequestedBefore time.Time
+	Cursor                string
+	Limit                 int
+}
+
+type Page struct {
+	Items      []*Payment `json:"items"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// PageSize devolve Limit limitado a MaxPageSize, ou DefaultPageSize se zero.
+func (q Query) PageSize() int {
+	switch {
+	case q.Limit <= 0:
+		return DefaultPageSize
+	case q.Limit > MaxPageSize:
+		return MaxPageSize
+	}
+	return q.Limit
+}
+
+// Matches indica se p atende aos filtros (o cursor não é considerado).
+func (q Query) Matches(p *Payment) bool {
+	if len(q.Statuses) > 0 && !slices.Contains(q.Statuses, p.Status) {
+		return false
+	}
+	if q.Email != "" && p.Email != q.Email {
+		return false
+	}
+	if q.Currency != "" && p.Currency != q.Currency {
+		return false
+	}
+	if q.OrderReference != "" && p.OrderReference != q.OrderReference {
+		return false
+	}
+	if q.CustomerID != "" && p.CustomerID != q.CustomerID {
+		return false
+	}
+	for k, v := range q.Metadata {
+		if got, ok := p.Metadata[k]; !ok || got != v {
+			return false
+		}
+	}
+	if q.MinAmount > 0 && p.Amount < q.MinAmount {
+		return false
+	}
+	if q.MaxAmount > 0 && p.Amount > q.MaxAmount {
+		return false
+	}
+	if !q.CreatedFrom.IsZero() && p.CreatedAt.Before(q.CreatedFrom) {
+		return false
+	}
+	if !q.CreatedTo.IsZero() && !p.CreatedAt.Before(q.CreatedTo) {
+		return false
+	}
+	if !q.AuthorizedBefore.IsZero() && (p.AuthorizedAt.IsZero() || !p.AuthorizedAt.Before(q.AuthorizedBefore)) {
+		return false
+	}
+	if !q.ReviewRequestedBefore.IsZero() && (p.Review == nil || !p.Review.RequestedAt.Before(q.ReviewRequestedBefore)) {
+		return false
+	}
+	return true
+}
+
+// Paginate monta a página de q a partir de ids em ordem crescente, percorrendo
+// do mais novo para o mais antigo a partir do cursor. get devolve o pagamento
+// armazenado (ou nil); os itens da página são cópias.
+func Paginate(ids []string, get func(id string) *Payment, q Query) Page {
+	size := q.PageSize()
+	end := len(ids)
+	if q.Cursor != "" {
+		end, _ = slices.BinarySearch(ids, q.Cursor)
+	}
+	page := Page{Items: []*Payment{}}
+	for i := end - 1; i >= 0; i-- {
+		p := get(ids[i])
+		if p == nil || !q.Matches(p) {
+			continue
+		}
+		if len(page.Items) == size {
+			page.NextCursor = page.Items[size-1].ID
+			break
+		}
+		page.Items = append(page.Items, p.Clone())
+	}
+	return page
+}
@@ -0,0 +1,104 @@
+package payment
+
+import (
+	"fmt"
+	"testing"
+)
+
+// stored monta n pagamentos com IDs crescentes; os de índice par são brl e
+// os ímpares usd.
+func stored(n int) ([]string, map[string]*Payment) {
+	ids := make([]string, 0, n)
+	byID := make(map[string]*Payment, n)
+	for i := range n {
+		id := fmt.Sprintf("pay_%02d", i)
+		cur := "brl"
+		if i%2 == 1 {
+			cur = "usd"
+		}
+		ids = append(ids, id)
+		byID[id] = &Payment{ID: id, Status: StatusCreated, Amount: int64(1000 + i), Currency: cur}
+	}
+	return ids, byID
+}
+
+func TestPaginateWalksEveryPageNewestFirst(t *testing.T) {
+	ids, byID := stored(7)
+	get := func(id string) *Payment { return byID[id] }
+
+	var got []string
+	q := Query{Limit: 3}
+	for pages := 0; ; pages++ {
+		if pages > len(ids) {
+			t.Fatal("pagination did not stop")
+		}
+		page := Paginate(ids, get, q)
+		for _, p := range page.Items {
+			got = append(got, p.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		if page.NextCursor != page.Items[len(page.Items)-1].ID {
+			t.Fatalf("next cursor = %s, want the last item of the page", page.NextCursor)
+		}
+		q.Cursor = page.NextCursor
+	}
+
+	if len(got) != len(ids) {
+		t.Fatalf("items = %v, want all %d payments once", got, len(ids))
+	}
+	for i, id := range got {
+		if want := ids[len(ids)-1-i]; id != want {
+			t.Fatalf("items = %v, want newest first", got)
+		}
+	}
+}
+
+func TestPaginateAppliesFiltersAcrossPages(t *testing.T) {
+	ids, byID := stored(9)
+	get := func(id string) *Payment { return byID[id] }
+
+	first := Paginate(ids, get, Query{Currency: "usd", Limit: 2})
+	if len(first.Items) != 2 || first.Items[0].ID != "pay_07" || first.NextCursor != "pay_05" {
+		t.Fatalf("first page = %v, next = %s", pageIDs(first), first.NextCursor)
+	}
+	second := Paginate(ids, get, Query{Currency: "usd", Limit: 2, Cursor: first.NextCursor})
+	if len(second.Items) != 2 || second.Items[0].ID != "pay_03" || second.NextCursor != "" {
+		t.Fatalf("second page = %v, next = %s, want the last page", pageIDs(second), second.NextCursor)
+	}
+}
+
+func TestPaginateReturnsCopies(t *testing.T) {
+	ids, byID := stored(1)
+	page := Paginate(ids, func(id string) *Payment { return byID[id] }, Query{})
+	page.Items[0].Amount = 1
+	if byID["pay_00"].Amount == 1 {
+		t.Fatal("page items must not alias the stored payments")
+	}
+}
+
+func TestQueryPageSize(t *testing.T) {
+	tests := []struct {
+		limit int
+		want  int
+	}{
+		{0, DefaultPageSize},
+		{-1, DefaultPageSize},
+		{10, 10},
+		{MaxPageSize + 1, MaxPageSize},
+	}
+	for _, tt := range tests {
+		if got := (Query{Limit: tt.limit}).PageSize(); got != tt.want {
+			t.Errorf("PageSize(%d) = %d, want %d", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func pageIDs(p Page) []string {
+	ids := make([]string, 0, len(p.Items))
+	for _, it := range p.Items {
+		ids = append(ids, it.ID)
+	}
+	return ids
+}
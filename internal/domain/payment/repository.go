@@ -1,8 +1,34 @@
 package payment
 
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrConflict é o alvo de errors.Is para *ConflictError.
+var ErrConflict = errors.New("payment version conflict")
+
+// ConflictError indica que o pagamento foi alterado por outro escritor desde
+// que foi lido; o chamador deve recarregar e reaplicar a operação.
+type ConflictError struct {
+	ID       string
+	Expected int64
+	Actual   int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("payment %s: version conflict (expected %d, stored %d)", e.ID, e.Expected, e.Actual)
+}
+
+func (e *ConflictError) Is(target error) bool { return target == ErrConflict }
+
 type Repository interface {
 	Create(p *Payment) error
 	Get(id string) (*Payment, error)
+	// Update falha com *ConflictError se p.Version não for a versão gravada.
 	Update(p *Payment) error
 	GetByPaymentIntent(piID string) (*Payment, error)
+	History(id string) ([]Transition, error)
+	// List devolve uma página de pagamentos que atendem a q.
+	List(q Query) (Page, error)
 }
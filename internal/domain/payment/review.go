@@ -0,0 +1,54 @@
+package payment
+
+import (
+	"errors"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/risk"
+)
+
+var ErrNotInReview = errors.New("payment is not in review")
+
+type ReviewOutcome string
+
+const (
+	ReviewApproved ReviewOutcome = "approved"
+	ReviewRejected ReviewOutcome = "rejected"
+)
+
+// Review é a revisão manual de um pagamento sinalizado pelo motor de risco.
+// Até a decisão o pagamento fica em in_review: autorizado, mas sem captura.
+type Review struct {
+	Reasons     []risk.Reason `json:"reasons,omitempty"`
+	RequestedAt time.Time     `json:"requested_at"`
+	Outcome     ReviewOutcome `json:"outcome,omitempty"`
+	Reviewer    string        `json:"reviewer,omitempty"`
+	Note        string        `json:"note,omitempty"`
+	Auto        bool          `json:"auto,omitempty"` // rejeitado pelo SLA
+	DecidedAt   time.Time     `json:"decided_at,omitzero"`
+}
+
+// ApproveReview libera o pagamento em revisão para captura.
+func (p *Payment) ApproveReview(reviewer, note string) error {
+	if p.Status != StatusInReview || p.ReviewRejected() {
+		return ErrNotInReview
+	}
+	p.raise(EvtPaymentReviewApproved, ReviewDecidedData{Reviewer: reviewer, Note: note})
+	return nil
+}
+
+// RejectReview registra a rejeição; o cancelamento da autorização fica com
+// a saga, e até ele o pagamento continua em in_review.
+func (p *Payment) RejectReview(reviewer, note string, auto bool) error {
+	if p.Status != StatusInReview || p.ReviewRejected() {
+		return ErrNotInReview
+	}
+	p.raise(EvtPaymentReviewRejected, ReviewDecidedData{Reviewer: reviewer, Note: note, Auto: auto})
+	return nil
+}
+
+// ReviewRejected indica que a revisão foi rejeitada; o cancelamento pode
+// ainda estar pendente.
+func (p *Payment) ReviewRejected() bool {
+	return p.Review != nil && p.Review.Outcome == ReviewRejected
+}
@@ -2,6 +2,7 @@ package payment
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 )
 
@@ -10,20 +11,50 @@ type Currency string
 func (c Currency) String() string { return string(c) }
 
 type Money struct {
-	Amount   int64    // em centavos
-	Currency Currency // "brl", "usd"
+	Amount   int64    // na unidade menor da moeda (ver CurrencyInfo)
+	Currency Currency // "brl", "usd", "jpy"
 }
 
+// Validate verifica a moeda no catálogo e o valor contra os limites de
+// cobrança dela.
 func (m Money) Validate() error {
 	if m.Amount <= 0 {
 		return errors.New("amount must be > 0")
 	}
-	if len(m.Currency) != 3 {
-		return errors.New("currency must be 3-letter code")
+	if err := m.Currency.Validate(); err != nil {
+		return err
+	}
+	info, _ := LookupCurrency(m.Currency)
+	switch {
+	case m.Amount < info.MinAmount:
+		return fmt.Errorf("amount %s is below the minimum of %s", m, Money{Amount: info.MinAmount, Currency: m.Currency})
+	case m.Amount > info.MaxAmount:
+		return fmt.Errorf("amount %s exceeds the maximum of %s", m, Money{Amount: info.MaxAmount, Currency: m.Currency})
+	case m.Amount%info.Step != 0:
+		return fmt.Errorf("amount %s must be a multiple of %d minor units", m, info.Step)
 	}
 	return nil
 }
 
+// String formata o valor com as casas decimais da moeda: "12.34 BRL",
+// "1234 JPY", "1.250 KWD". Moedas fora do catálogo saem na unidade menor.
+func (m Money) String() string {
+	code := strings.ToUpper(string(m.Currency))
+	info, ok := LookupCurrency(m.Currency)
+	if !ok || info.Exponent == 0 {
+		return fmt.Sprintf("%d %s", m.Amount, code)
+	}
+	sign, a := "", m.Amount
+	if a < 0 {
+		sign, a = "-", -a
+	}
+	unit := int64(1)
+	for range info.Exponent {
+		unit *= 10
+	}
+	return fmt.Sprintf("%s%d.%0*d %s", sign, a/unit, info.Exponent, a%unit, code)
+}
+
 type Email string
 
 func (e Email) Normalize() Email {
@@ -37,3 +68,84 @@ func (e Email) Validate() error {
 	}
 	return nil
 }
+
+// Limites de metadata e textos livres, os mesmos do Stripe.
+const (
+	MaxMetadataKeys         = 50
+	MaxMetadataKeyLength    = 40
+	MaxMetadataValueLength  = 500
+	MaxDescriptionLength    = 1000
+	MaxOrderReferenceLength = 255
+)
+
+// Metadata são pares chave/valor livres do integrador (ID do pedido, do
+// carrinho...), repassados ao PaymentIntent.
+type Metadata map[string]string
+
+func (m Metadata) Validate() error {
+	if len(m) > MaxMetadataKeys {
+		return fmt.Errorf("metadata accepts at most %d keys", MaxMetadataKeys)
+	}
+	for k, v := range m {
+		if k == "" || len(k) > MaxMetadataKeyLength {
+			return fmt.Errorf("metadata key %q must have 1 to %d characters", k, MaxMetadataKeyLength)
+		}
+		if strings.ContainsAny(k, "[]") {
+			return fmt.Errorf("metadata key %q must not contain square brackets", k)
+		}
+		if len(v) > MaxMetadataValueLength {
+			return fmt.Errorf("metadata value for %q exceeds %d characters", k, MaxMetadataValueLength)
+		}
+	}
+	return nil
+}
+
+func (m Metadata) Clone() Metadata {
+	if m == nil {
+		return nil
+	}
+	cp := make(Metadata, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	return cp
+}
+
+// Failure é a recusa informada pelo Stripe (last_payment_error do
+// PaymentIntent). DeclineCode só vem em recusas do emissor do cartão.
+type Failure struct {
+	Code        string `json:"code,omitempty"`
+	DeclineCode string `json:"decline_code,omitempty"`
+	Message     string `json:"message,omitempty"`
+}
+
+// Card é o cartão cobrado, lido do PaymentMethod no Stripe; nunca vem de
+// quem chama a API.
+type Card struct {
+	Fingerprint string
+	BIN         string // card.iin
+	Country     string // país emissor, ISO 3166-1 alfa-2
+}
+
+// Details são os dados descritivos do pagamento informados na criação.
+type Details struct {
+	Description      string
+	OrderReference   string
+	Metadata         Metadata
+	CustomerID       string
+	StripeCustomerID string // Customer do Stripe enviado no PaymentIntent
+
+	ClientConfirmation bool // PaymentIntent confirmado pelo frontend
+
+	ClientIP string // IP de quem chamou a API, usado nos limites de velocidade
+}
+
+func (d Details) Validate() error {
+	if len(d.Description) > MaxDescriptionLength {
+		return fmt.Errorf("description exceeds %d characters", MaxDescriptionLength)
+	}
+	if len(d.OrderReference) > MaxOrderReferenceLength {
+		return fmt.Errorf("order_reference exceeds %d characters", MaxOrderReferenceLength)
+	}
+	return d.Metadata.Validate()
+}
@@ -0,0 +1,126 @@
+package risk
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Outcome é a decisão do motor de risco sobre um pagamento.
+type Outcome string
+
+const (
+	Allow  Outcome = "allow"
+	Review Outcome = "review" // autoriza, mas sinaliza para revisão
+	Deny   Outcome = "deny"
+)
+
+func (o Outcome) Valid() bool {
+	switch o {
+	case Allow, Review, Deny:
+		return true
+	}
+	return false
+}
+
+// severity ordena as decisões: a mais severa entre as regras prevalece.
+func (o Outcome) severity() int {
+	switch o {
+	case Review:
+		return 1
+	case Deny:
+		return 2
+	}
+	return 0
+}
+
+// Input são os dados do pagamento avaliados pelas regras.
+type Input struct {
+	PaymentID   string
+	Amount      int64
+	Currency    string
+	Email       string
+	CardBIN     string
+	CardCountry string // ISO 3166-1 alfa-2
+
+	ClientIP        string
+	CardFingerprint string
+	Metadata        map[string]string
+
+	At time.Time
+}
+
+// Reason explica por que uma regra pediu revisão ou recusa.
+type Reason struct {
+	Rule    string  `json:"rule"`
+	Outcome Outcome `json:"outcome"`
+	Message string  `json:"message"`
+}
+
+type Decision struct {
+	Outcome Outcome  `json:"outcome"`
+	Reasons []Reason `json:"reasons,omitempty"`
+	// Version identifica o conjunto de regras declarativas que decidiu.
+	Version string `json:"version,omitempty"`
+}
+
+// Add registra a objeção de uma regra; a decisão passa a ser a mais severa.
+func (d *Decision) Add(r Reason) {
+	if r.Outcome.severity() == 0 {
+		return
+	}
+	d.Reasons = append(d.Reasons, r)
+	if r.Outcome.severity() > d.Outcome.severity() {
+		d.Outcome = r.Outcome
+	}
+}
+
+// Rule avalia um aspecto do pagamento; sem objeção devolve Allow.
+type Rule interface {
+	Name() string
+	Evaluate(in Input) (Outcome, string)
+}
+
+// RuleCheck adapta uma Rule ao Check das verificações feitas fora do Engine,
+// como as do cartão confirmado no frontend (ver velocity.CardCheck).
+type RuleCheck struct{ Rule }
+
+func (c RuleCheck) Check(in Input) (Reason, bool) {
+	out, msg := c.Evaluate(in)
+	return Reason{Rule: c.Name(), Outcome: out, Message: msg}, out != Allow
+}
+
+// Engine combina as regras: todas são avaliadas, as objeções viram Reasons
+// e a decisão é a mais severa entre elas.
+type Engine struct {
+	rules []Rule
+}
+
+func NewEngine(rules ...Rule) *Engine {
+	return &Engine{rules: rules}
+}
+
+func (e *Engine) Evaluate(ctx context.Context, in Input) Decision {
+	d := Decision{Outcome: Allow}
+	for _, r := range e.rules {
+		out, msg := r.Evaluate(in)
+		d.Add(Reason{Rule: r.Name(), Outcome: out, Message: msg})
+	}
+	return d
+}
+
+// DeniedError é devolvido quando o motor de risco recusa o pagamento.
+type DeniedError struct {
+	PaymentID string
+	Reasons   []Reason
+}
+
+func (e *DeniedError) Error() string {
+	msgs := make([]string, 0, len(e.Reasons))
+	for _, r := range e.Reasons {
+		if r.Outcome == Deny {
+			msgs = append(msgs, r.Message)
+		}
+	}
+	return "risk: payment denied: " + strings.Join(msgs, "; ")
+}
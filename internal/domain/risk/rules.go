@@ -0,0 +1,119 @@
+package risk
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AnyCurrency é a chave dos limites que valem para moedas sem limite próprio.
+const AnyCurrency = "*"
+
+// limitFor devolve o limite da moeda, ou o de AnyCurrency.
+func limitFor(limits map[string]int64, currency string) (int64, bool) {
+	if v, ok := limits[strings.ToLower(currency)]; ok {
+		return v, true
+	}
+	v, ok := limits[AnyCurrency]
+	return v, ok
+}
+
+// AmountLimit recusa valores acima de Deny e pede revisão acima de Review,
+// por moeda (na unidade menor da moeda).
+type AmountLimit struct {
+	Review map[string]int64
+	Deny   map[string]int64
+}
+
+func (AmountLimit) Name() string { return "amount_limit" }
+
+func (r AmountLimit) Evaluate(in Input) (Outcome, string) {
+	if limit, ok := limitFor(r.Deny, in.Currency); ok && in.Amount > limit {
+		return Deny, fmt.Sprintf("amount %d exceeds %s limit %d", in.Amount, in.Currency, limit)
+	}
+	if limit, ok := limitFor(r.Review, in.Currency); ok && in.Amount > limit {
+		return Review, fmt.Sprintf("amount %d exceeds %s review threshold %d", in.Amount, in.Currency, limit)
+	}
+	return Allow, ""
+}
+
+// EmailBlocklist recusa e-mails e domínios bloqueados.
+type EmailBlocklist struct {
+	Emails  []string
+	Domains []string
+}
+
+func (EmailBlocklist) Name() string { return "email_blocklist" }
+
+func (r EmailBlocklist) Evaluate(in Input) (Outcome, string) {
+	email := strings.ToLower(in.Email)
+	if slices.Contains(r.Emails, email) {
+		return Deny, "email is blocked"
+	}
+	if _, domain, ok := strings.Cut(email, "@"); ok && slices.Contains(r.Domains, domain) {
+		return Deny, fmt.Sprintf("email domain %s is blocked", domain)
+	}
+	return Allow, ""
+}
+
+// CardRule avalia o BIN e o país emissor do cartão, quando informados.
+type CardRule struct {
+	BlockedBINs      []string // prefixos
+	BlockedCountries []string
+	ReviewCountries  []string
+}
+
+func (CardRule) Name() string { return "card" }
+
+func (r CardRule) Evaluate(in Input) (Outcome, string) {
+	if in.CardBIN != "" {
+		for _, bin := range r.BlockedBINs {
+			if strings.HasPrefix(in.CardBIN, bin) {
+				return Deny, fmt.Sprintf("card BIN %s is blocked", bin)
+			}
+		}
+	}
+	country := strings.ToUpper(in.CardCountry)
+	if country == "" {
+		return Allow, ""
+	}
+	if slices.Contains(r.BlockedCountries, country) {
+		return Deny, fmt.Sprintf("card country %s is blocked", country)
+	}
+	if slices.Contains(r.ReviewCountries, country) {
+		return Review, fmt.Sprintf("card country %s requires review", country)
+	}
+	return Allow, ""
+}
+
+// TimeOfDay aplica Outcome a valores acima de MaxAmount entre as horas
+// Start (inclusiva) e End (exclusiva) em Location; a janela pode virar a
+// meia-noite (ex.: 22 a 6).
+type TimeOfDay struct {
+	Start, End int
+	Location   *time.Location
+	MaxAmount  map[string]int64
+	Outcome    Outcome
+}
+
+func (TimeOfDay) Name() string { return "time_of_day" }
+
+func (r TimeOfDay) Evaluate(in Input) (Outcome, string) {
+	loc := r.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	h := in.At.In(loc).Hour()
+	inWindow := h >= r.Start && h < r.End
+	if r.Start > r.End {
+		inWindow = h >= r.Start || h < r.End
+	}
+	if !inWindow {
+		return Allow, ""
+	}
+	if limit, ok := limitFor(r.MaxAmount, in.Currency); ok && in.Amount > limit {
+		return r.Outcome, fmt.Sprintf("amount %d exceeds %s limit %d between %02dh and %02dh", in.Amount, in.Currency, limit, r.Start, r.End)
+	}
+	return Allow, ""
+}
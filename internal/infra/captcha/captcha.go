@@ -0,0 +1,56 @@
+// Package captcha confirma os desafios resolvidos no frontend pela API
+// siteverify, o mesmo protocolo do hCaptcha, do Cloudflare Turnstile e do
+// reCAPTCHA.
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type Verifier struct {
+	client *http.Client
+	url    string
+	secret string
+}
+
+func NewVerifier(client *http.Client, verifyURL, secret string) *Verifier {
+	return &Verifier{client: client, url: verifyURL, secret: secret}
+}
+
+type siteverifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// Verify confirma token com o provedor; false se o desafio não foi resolvido
+// ou se o token expirou ou já foi usado.
+func (v *Verifier) Verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	form := url.Values{"secret": {v.secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := v.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("captcha: siteverify responded %d", res.StatusCode)
+	}
+	var out siteverifyResponse
+	if err := json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&out); err != nil {
+		return false, fmt.Errorf("captcha: decode siteverify response: %w", err)
+	}
+	return out.Success, nil
+}
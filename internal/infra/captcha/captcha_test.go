@@ -0,0 +1,47 @@
+package captcha
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	var form map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		form = map[string]string{"secret": r.PostForm.Get("secret"), "response": r.PostForm.Get("response"), "remoteip": r.PostForm.Get("remoteip")}
+		if r.PostForm.Get("response") == "solved" {
+			_, _ = w.Write([]byte(`{"success": true}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+	}))
+	defer srv.Close()
+	v := NewVerifier(srv.Client(), srv.URL, "captcha_secret")
+
+	ok, err := v.Verify(context.Background(), "solved", "203.0.113.7")
+	if err != nil || !ok {
+		t.Fatalf("solved: ok = %v, err = %v, want verified", ok, err)
+	}
+	if form["secret"] != "captcha_secret" || form["remoteip"] != "203.0.113.7" {
+		t.Fatalf("form = %v", form)
+	}
+	ok, err = v.Verify(context.Background(), "forged", "")
+	if err != nil || ok {
+		t.Fatalf("forged: ok = %v, err = %v, want rejected", ok, err)
+	}
+}
+
+func TestVerifyProviderError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	ok, err := NewVerifier(srv.Client(), srv.URL, "captcha_secret").Verify(context.Background(), "solved", "")
+	if err == nil || ok {
+		t.Fatalf("ok = %v, err = %v, want an error", ok, err)
+	}
+}
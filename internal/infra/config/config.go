@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -15,6 +16,16 @@ type Config struct {
 	RateLimitRPS   float64
 	RateLimitBurst int
 	RequestTimeout time.Duration
+	IdempotencyTTL time.Duration
+
+	// Proxies (IPs ou CIDRs) cujo X-Forwarded-For é aceito para o IP do
+	// cliente; vazio não confia em nenhum e usa o endereço da conexão.
+	TrustedProxies []string
+
+	AdminAPIToken string // Bearer das rotas de operação
+
+	RepoDriver  string // memory | eventstore | sqlite
+	DatabaseDSN string
 
 	StripeSecretKey     string
 	StripeWebhookSecret string
@@ -24,6 +35,76 @@ type Config struct {
 	CBMaxRequests uint32
 	CBInterval    time.Duration
 	CBTimeout     time.Duration
+
+	OutboxPollInterval time.Duration
+	OutboxBatchSize    int
+	OutboxMaxAttempts  int
+	OutboxRetryBackoff time.Duration
+
+	MerchantWebhookTimeout      time.Duration
+	MerchantWebhookPollInterval time.Duration
+	MerchantWebhookMaxAttempts  int
+	MerchantWebhookRetryBackoff time.Duration
+
+	StripeWebhookWorkers      int
+	StripeWebhookPollInterval time.Duration
+	StripeWebhookBatchSize    int
+	StripeWebhookMaxAttempts  int
+	StripeWebhookRetryBackoff time.Duration
+
+	DisputeDeadlineWarning       time.Duration // antecedência do aviso de evidence_due_by
+	DisputeDeadlineCheckInterval time.Duration
+
+	AuthExpiryPolicy        string        // capture | cancel | flag
+	AuthExpiryValidity      time.Duration // validade da autorização no Stripe
+	AuthExpiryMargin        time.Duration // antecedência da ação antes de expirar
+	AuthExpiryCheckInterval time.Duration
+
+	// Revisão manual dos pagamentos sinalizados pelo risco; vencido o SLA o
+	// pagamento é rejeitado e a autorização cancelada.
+	ReviewSLA           time.Duration
+	ReviewCheckInterval time.Duration
+
+	// Motor de risco; limites por moeda na unidade menor, "*" vale para as demais.
+	RiskMaxAmount        map[string]int64 // recusa acima
+	RiskReviewAmount     map[string]int64 // revisão acima
+	RiskBlockedEmails    []string
+	RiskBlockedDomains   []string
+	RiskBlockedBINs      []string
+	RiskBlockedCountries []string
+	RiskReviewCountries  []string
+	RiskNightStart       int // hora inicial (inclusiva) da janela noturna
+	RiskNightEnd         int // hora final (exclusiva)
+	RiskNightMaxAmount   map[string]int64
+	RiskTimezone         string
+
+	// Regras declarativas somadas às do ambiente; vazio desativa.
+	RiskRulesFile          string
+	RiskRulesCheckInterval time.Duration
+
+	// Limites de velocidade por e-mail, IP e cartão numa janela deslizante;
+	// zero não limita.
+	VelocityWindow        time.Duration
+	VelocityAction        string // deny | review
+	VelocityEmailMaxCount int
+	VelocityEmailMaxSum   map[string]int64
+	VelocityIPMaxCount    int
+	VelocityIPMaxSum      map[string]int64
+	VelocityCardMaxCount  int
+	VelocityCardMaxSum    map[string]int64
+
+	// Detecção de teste de cartões por IP e e-mail
+	CardTestingWindow         time.Duration
+	CardTestingMinAttempts    int
+	CardTestingDeclineRatio   float64
+	CardTestingLowAmount      map[string]int64
+	CardTestingLowAmountBurst int
+	CardTestingQuarantine     time.Duration
+	CardTestingAction         string // block | captcha
+
+	// siteverify do provedor de captcha (hCaptcha, Turnstile, reCAPTCHA)
+	CaptchaSecret    string
+	CaptchaVerifyURL string
 }
 
 func Load() *Config {
@@ -36,6 +117,14 @@ func Load() *Config {
 		RateLimitRPS:   getEnvFloat("RATE_LIMIT_RPS", 10),
 		RateLimitBurst: getEnvInt("RATE_LIMIT_BURST", 20),
 		RequestTimeout: getEnvDuration("REQUEST_TIMEOUT", 15*time.Second),
+		IdempotencyTTL: getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+
+		TrustedProxies: getEnvList("TRUSTED_PROXIES", nil),
+
+		AdminAPIToken: getEnv("ADMIN_API_TOKEN", ""),
+
+		RepoDriver:  getEnv("REPO_DRIVER", "memory"),
+		DatabaseDSN: getEnv("DATABASE_DSN", "file:payments.db?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"),
 
 		StripeSecretKey:     getEnv("STRIPE_SECRET_KEY", ""),
 		StripeWebhookSecret: getEnv("STRIPE_WEBHOOK_SECRET", ""),
@@ -45,6 +134,68 @@ func Load() *Config {
 		CBMaxRequests: uint32(getEnvInt("CB_MAX_REQUESTS", 3)),
 		CBInterval:    getEnvDuration("CB_INTERVAL", 60*time.Second),
 		CBTimeout:     getEnvDuration("CB_TIMEOUT", 8*time.Second),
+
+		OutboxPollInterval: getEnvDuration("OUTBOX_POLL_INTERVAL", time.Second),
+		OutboxBatchSize:    getEnvInt("OUTBOX_BATCH_SIZE", 100),
+		OutboxMaxAttempts:  getEnvInt("OUTBOX_MAX_ATTEMPTS", 10),
+		OutboxRetryBackoff: getEnvDuration("OUTBOX_RETRY_BACKOFF", 2*time.Second),
+
+		MerchantWebhookTimeout:      getEnvDuration("MERCHANT_WEBHOOK_TIMEOUT", 10*time.Second),
+		MerchantWebhookPollInterval: getEnvDuration("MERCHANT_WEBHOOK_POLL_INTERVAL", time.Second),
+		MerchantWebhookMaxAttempts:  getEnvInt("MERCHANT_WEBHOOK_MAX_ATTEMPTS", 8),
+		MerchantWebhookRetryBackoff: getEnvDuration("MERCHANT_WEBHOOK_RETRY_BACKOFF", 30*time.Second),
+
+		StripeWebhookWorkers:      getEnvInt("STRIPE_WEBHOOK_WORKERS", 4),
+		StripeWebhookPollInterval: getEnvDuration("STRIPE_WEBHOOK_POLL_INTERVAL", time.Second),
+		StripeWebhookBatchSize:    getEnvInt("STRIPE_WEBHOOK_BATCH_SIZE", 100),
+		StripeWebhookMaxAttempts:  getEnvInt("STRIPE_WEBHOOK_MAX_ATTEMPTS", 8),
+		StripeWebhookRetryBackoff: getEnvDuration("STRIPE_WEBHOOK_RETRY_BACKOFF", 5*time.Second),
+
+		DisputeDeadlineWarning:       getEnvDuration("DISPUTE_DEADLINE_WARNING", 72*time.Hour),
+		DisputeDeadlineCheckInterval: getEnvDuration("DISPUTE_DEADLINE_CHECK_INTERVAL", time.Hour),
+
+		AuthExpiryPolicy:        getEnv("AUTH_EXPIRY_POLICY", "flag"),
+		AuthExpiryValidity:      getEnvDuration("AUTH_EXPIRY_VALIDITY", 7*24*time.Hour),
+		AuthExpiryMargin:        getEnvDuration("AUTH_EXPIRY_MARGIN", 24*time.Hour),
+		AuthExpiryCheckInterval: getEnvDuration("AUTH_EXPIRY_CHECK_INTERVAL", 15*time.Minute),
+
+		ReviewSLA:           getEnvDuration("REVIEW_SLA", 24*time.Hour),
+		ReviewCheckInterval: getEnvDuration("REVIEW_CHECK_INTERVAL", 5*time.Minute),
+
+		RiskMaxAmount:        getEnvAmounts("RISK_MAX_AMOUNT", map[string]int64{"*": 9_999_999}),
+		RiskReviewAmount:     getEnvAmounts("RISK_REVIEW_AMOUNT", nil),
+		RiskBlockedEmails:    getEnvList("RISK_BLOCKED_EMAILS", strings.ToLower),
+		RiskBlockedDomains:   getEnvList("RISK_BLOCKED_EMAIL_DOMAINS", strings.ToLower),
+		RiskBlockedBINs:      getEnvList("RISK_BLOCKED_BINS", nil),
+		RiskBlockedCountries: getEnvList("RISK_BLOCKED_COUNTRIES", strings.ToUpper),
+		RiskReviewCountries:  getEnvList("RISK_REVIEW_COUNTRIES", strings.ToUpper),
+		RiskNightStart:       getEnvInt("RISK_NIGHT_START", 0),
+		RiskNightEnd:         getEnvInt("RISK_NIGHT_END", 6),
+		RiskNightMaxAmount:   getEnvAmounts("RISK_NIGHT_MAX_AMOUNT", nil),
+		RiskTimezone:         getEnv("RISK_TIMEZONE", "UTC"),
+
+		RiskRulesFile:          getEnv("RISK_RULES_FILE", ""),
+		RiskRulesCheckInterval: getEnvDuration("RISK_RULES_CHECK_INTERVAL", 10*time.Second),
+
+		VelocityWindow:        getEnvDuration("VELOCITY_WINDOW", time.Hour),
+		VelocityAction:        getEnv("VELOCITY_ACTION", "deny"),
+		VelocityEmailMaxCount: getEnvInt("VELOCITY_EMAIL_MAX_COUNT", 10),
+		VelocityEmailMaxSum:   getEnvAmounts("VELOCITY_EMAIL_MAX_SUM", nil),
+		VelocityIPMaxCount:    getEnvInt("VELOCITY_IP_MAX_COUNT", 20),
+		VelocityIPMaxSum:      getEnvAmounts("VELOCITY_IP_MAX_SUM", nil),
+		VelocityCardMaxCount:  getEnvInt("VELOCITY_CARD_MAX_COUNT", 10),
+		VelocityCardMaxSum:    getEnvAmounts("VELOCITY_CARD_MAX_SUM", nil),
+
+		CardTestingWindow:         getEnvDuration("CARD_TESTING_WINDOW", 10*time.Minute),
+		CardTestingMinAttempts:    getEnvInt("CARD_TESTING_MIN_ATTEMPTS", 5),
+		CardTestingDeclineRatio:   getEnvFloat("CARD_TESTING_DECLINE_RATIO", 0.6),
+		CardTestingLowAmount:      getEnvAmounts("CARD_TESTING_LOW_AMOUNT", map[string]int64{"*": 500}),
+		CardTestingLowAmountBurst: getEnvInt("CARD_TESTING_LOW_AMOUNT_BURST", 5),
+		CardTestingQuarantine:     getEnvDuration("CARD_TESTING_QUARANTINE", time.Hour),
+		CardTestingAction:         getEnv("CARD_TESTING_ACTION", "block"),
+
+		CaptchaSecret:    getEnv("CAPTCHA_SECRET", ""),
+		CaptchaVerifyURL: getEnv("CAPTCHA_VERIFY_URL", "https://api.hcaptcha.com/siteverify"),
 	}
 }
 
@@ -74,6 +225,42 @@ func getEnvFloat(key string, def float64) float64 {
 	}
 	return def
 }
+
+// getEnvList lê uma lista separada por vírgulas, aplicando norm a cada item.
+func getEnvList(key string, norm func(string) string) []string {
+	var out []string
+	for _, v := range strings.Split(getEnv(key, ""), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if norm != nil {
+			v = norm(v)
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// getEnvAmounts lê valores por moeda no formato "brl:100000,usd:20000".
+// Itens inválidos são descartados.
+func getEnvAmounts(key string, def map[string]int64) map[string]int64 {
+	v, ok := os.LookupEnv(key)
+	if !ok || strings.TrimSpace(v) == "" {
+		return def
+	}
+	out := make(map[string]int64)
+	for _, item := range getEnvList(key, strings.ToLower) {
+		cur, amount, ok := strings.Cut(item, ":")
+		var x int64
+		if _, err := fmt.Sscanf(amount, "%d", &x); !ok || err != nil {
+			continue
+		}
+		out[strings.TrimSpace(cur)] = x
+	}
+	return out
+}
+
 func getEnvDuration(key string, def time.Duration) time.Duration {
 	if v, ok := os.LookupEnv(key); ok {
 		d, err := time.ParseDuration(v)
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/williamkoller/golang-payment-stripe/internal/app/service"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/customer"
+)
+
+type CustomerHandler struct {
+	svc *service.CustomerService
+}
+
+func NewCustomerHandler(svc *service.CustomerService) *CustomerHandler {
+	return &CustomerHandler{svc: svc}
+}
+
+type createCustomerReq struct {
+	Email    string            `json:"email" example:"cliente@example.com"`
+	Name     string            `json:"name" example:"Maria Silva"`
+	Phone    string            `json:"phone" example:"+5511999990000"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// POST /v1/customers -> cria o cliente e o Customer no Stripe
+func (h *CustomerHandler) Create(c *gin.Context) {
+	var req createCustomerReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload", "details": err.Error()})
+		return
+	}
+	out, err := h.svc.Create(c.Request.Context(), service.CustomerInput{
+		Email: req.Email, Name: req.Name, Phone: req.Phone, Metadata: req.Metadata,
+	})
+	if err != nil {
+		c.JSON(customerErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, out)
+}
+
+// GET /v1/customers
+func (h *CustomerHandler) List(c *gin.Context) {
+	out, err := h.svc.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"customers": out})
+}
+
+// GET /v1/customers/:id
+func (h *CustomerHandler) Get(c *gin.Context) {
+	out, err := h.svc.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+type updateCustomerReq struct {
+	Email    *string           `json:"email"`
+	Name     *string           `json:"name"`
+	Phone    *string           `json:"phone"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// PATCH /v1/customers/:id -> altera só os campos enviados e sincroniza com o Stripe
+func (h *CustomerHandler) Update(c *gin.Context) {
+	var req updateCustomerReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload", "details": err.Error()})
+		return
+	}
+	out, err := h.svc.Update(c.Request.Context(), c.Param("id"), service.CustomerUpdateInput{
+		Email: req.Email, Name: req.Name, Phone: req.Phone, Metadata: req.Metadata,
+	})
+	if err != nil {
+		c.JSON(customerErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// DELETE /v1/customers/:id
+func (h *CustomerHandler) Delete(c *gin.Context) {
+	if err := h.svc.Delete(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(customerErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GET /v1/customers/:id/payments -> pagamentos do cliente, do mais novo para o mais antigo
+func (h *CustomerHandler) Payments(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	out, err := h.svc.Payments(c.Request.Context(), c.Param("id"), c.Query("cursor"), limit)
+	if err != nil {
+		c.JSON(customerErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func customerErrorStatus(err error) int {
+	if code := gatewayStatus(err); code != 0 {
+		return code
+	}
+	switch {
+	case errors.Is(err, customer.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, customer.ErrEmailInUse):
+		return http.StatusConflict
+	}
+	return http.StatusUnprocessableEntity
+}
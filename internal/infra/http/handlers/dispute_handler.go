@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/williamkoller/golang-payment-stripe/internal/app/service"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/dispute"
+)
+
+type DisputeHandler struct {
+	svc *service.DisputeService
+}
+
+func NewDisputeHandler(svc *service.DisputeService) *DisputeHandler {
+	return &DisputeHandler{svc: svc}
+}
+
+// GET /v1/disputes?status=needs_response&payment_id=...&due_within=72h
+func (h *DisputeHandler) List(c *gin.Context) {
+	in := service.DisputeListInput{PaymentID: c.Query("payment_id"), Status: c.Query("status")}
+	if v := c.Query("due_within"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid due_within"})
+			return
+		}
+		in.DueWithin = d
+	}
+	out, err := h.svc.List(c.Request.Context(), in)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"disputes": out})
+}
+
+// GET /v1/disputes/:id
+func (h *DisputeHandler) Get(c *gin.Context) {
+	out, err := h.svc.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+type evidenceReq struct {
+	Evidence map[string]string `json:"evidence"`
+	Submit   bool              `json:"submit"`
+}
+
+// POST /v1/disputes/:id/evidence -> grava as evidências no Stripe; submit envia ao emissor
+func (h *DisputeHandler) Evidence(c *gin.Context) {
+	var req evidenceReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload", "details": err.Error()})
+		return
+	}
+	out, err := h.svc.SubmitEvidence(c.Request.Context(), c.Param("id"), service.EvidenceInput{
+		Evidence: req.Evidence, Submit: req.Submit,
+	})
+	if err != nil {
+		c.JSON(disputeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// POST /v1/disputes/:id/files (multipart: file, field) -> envia o arquivo ao Stripe
+func (h *DisputeHandler) UploadFile(c *gin.Context) {
+	// folga para os demais campos do multipart
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, service.MaxEvidenceFileSize+1<<20)
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file required", "details": err.Error()})
+		return
+	}
+	f, err := fh.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+	out, err := h.svc.UploadFile(c.Request.Context(), c.Param("id"), c.PostForm("field"), fh.Filename, fh.Size, f)
+	if err != nil {
+		c.JSON(disputeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, out)
+}
+
+func disputeErrorStatus(err error) int {
+	if code := gatewayStatus(err); code != 0 {
+		return code
+	}
+	switch {
+	case errors.Is(err, dispute.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, dispute.ErrClosed):
+		return http.StatusConflict
+	}
+	return http.StatusUnprocessableEntity
+}
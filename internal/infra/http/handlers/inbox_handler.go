@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/inbox"
+)
+
+const maxInboxPage = 200
+
+type InboxHandler struct {
+	store inbox.Store
+}
+
+func NewInboxHandler(store inbox.Store) *InboxHandler { return &InboxHandler{store: store} }
+
+// GET /v1/webhooks/stripe/events -> eventos recebidos, mais recentes primeiro
+func (h *InboxHandler) List(c *gin.Context) {
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxInboxPage {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 200"})
+			return
+		}
+		limit = n
+	}
+	out, err := h.store.List(inbox.Status(c.Query("status")), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": out})
+}
+
+// GET /v1/webhooks/stripe/dead-letters -> eventos que esgotaram as tentativas
+func (h *InboxHandler) DeadLetters(c *gin.Context) {
+	out, err := h.store.List(inbox.StatusDead, maxInboxPage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": out})
+}
+
+// POST /v1/webhooks/stripe/events/:id/retry -> devolve um evento concluído para processamento
+func (h *InboxHandler) Retry(c *gin.Context) {
+	if err := h.store.Requeue(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"requeued": true})
+}
+
+// GET /v1/webhooks/stripe/events/:id -> evento com o resultado do processamento
+func (h *InboxHandler) Get(c *gin.Context) {
+	e, err := h.store.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, e)
+}
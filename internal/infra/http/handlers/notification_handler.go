@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/williamkoller/golang-payment-stripe/internal/app/service"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/notification"
+)
+
+type NotificationHandler struct {
+	svc *service.NotificationService
+}
+
+func NewNotificationHandler(svc *service.NotificationService) *NotificationHandler {
+	return &NotificationHandler{svc: svc}
+}
+
+type createEndpointReq struct {
+	URL         string   `json:"url" example:"https://orders.internal/webhooks/payments"`
+	Events      []string `json:"events" example:"payment.captured,payment.canceled"`
+	Description string   `json:"description" example:"orders service"`
+}
+
+type createEndpointResp struct {
+	*notification.Endpoint
+	Secret string `json:"secret"`
+}
+
+// POST /v1/webhook-endpoints -> inscreve um endpoint (o segredo só aparece aqui)
+func (h *NotificationHandler) CreateEndpoint(c *gin.Context) {
+	var req createEndpointReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload", "details": err.Error()})
+		return
+	}
+	ep, err := h.svc.RegisterEndpoint(c.Request.Context(), service.EndpointInput{
+		URL: req.URL, Events: req.Events, Description: req.Description,
+	})
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, createEndpointResp{Endpoint: ep, Secret: ep.Secret})
+}
+
+// GET /v1/webhook-endpoints
+func (h *NotificationHandler) ListEndpoints(c *gin.Context) {
+	out, err := h.svc.ListEndpoints(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"endpoints": out})
+}
+
+// GET /v1/webhook-endpoints/:id
+func (h *NotificationHandler) GetEndpoint(c *gin.Context) {
+	out, err := h.svc.GetEndpoint(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// DELETE /v1/webhook-endpoints/:id
+func (h *NotificationHandler) DeleteEndpoint(c *gin.Context) {
+	if err := h.svc.DeleteEndpoint(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GET /v1/webhook-endpoints/:id/deliveries -> log de entregas do endpoint
+func (h *NotificationHandler) ListDeliveries(c *gin.Context) {
+	out, err := h.svc.ListDeliveries(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": out})
+}
+
+// GET /v1/webhook-deliveries/:id
+func (h *NotificationHandler) GetDelivery(c *gin.Context) {
+	out, err := h.svc.GetDelivery(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// POST /v1/webhook-deliveries/:id/redeliver -> reenvio manual imediato
+func (h *NotificationHandler) Redeliver(c *gin.Context) {
+	out, err := h.svc.Redeliver(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, notification.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
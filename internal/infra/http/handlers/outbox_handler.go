@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/outbox"
+)
+
+type OutboxHandler struct {
+	store outbox.Store
+}
+
+func NewOutboxHandler(store outbox.Store) *OutboxHandler { return &OutboxHandler{store: store} }
+
+// GET /v1/outbox/dead-letters -> mensagens que esgotaram as tentativas
+func (h *OutboxHandler) DeadLetters(c *gin.Context) {
+	out, err := h.store.DeadLetters()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"messages": out})
+}
+
+// POST /v1/outbox/dead-letters/:id/requeue -> devolve a mensagem para entrega
+func (h *OutboxHandler) Requeue(c *gin.Context) {
+	if err := h.store.Requeue(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"requeued": true})
+}
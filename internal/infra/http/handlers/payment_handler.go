@@ -1,10 +1,19 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/williamkoller/golang-payment-stripe/internal/app/cardtesting"
+	"github.com/williamkoller/golang-payment-stripe/internal/app/ports"
 	"github.com/williamkoller/golang-payment-stripe/internal/app/service"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/risk"
 )
 
 type PaymentHandler struct {
@@ -14,9 +23,15 @@ type PaymentHandler struct {
 func NewPaymentHandler(svc *service.PaymentService) *PaymentHandler { return &PaymentHandler{svc: svc} }
 
 type createReq struct {
-	Amount   int64  `json:"amount" example:"5500"`
-	Currency string `json:"currency" example:"brl"`
-	Email    string `json:"email" example:"cliente@example.com"`
+	Amount     int64  `json:"amount" example:"5500"`
+	Currency   string `json:"currency" example:"brl"`
+	Email      string `json:"email" example:"cliente@example.com"`
+	CustomerID string `json:"customer_id" example:"01HXYZ0CUSTOMER000000000"`
+
+	ClientConfirmation bool              `json:"client_confirmation" example:"false"`
+	Description        string            `json:"description" example:"Pedido #8731"`
+	OrderReference     string            `json:"order_reference" example:"8731"`
+	Metadata           map[string]string `json:"metadata"`
 }
 
 // POST /v1/payments -> cria e autoriza (captura manual)
@@ -27,21 +42,56 @@ func (h *PaymentHandler) Create(c *gin.Context) {
 		return
 	}
 	out, err := h.svc.CreateAndAuthorize(c.Request.Context(), service.CreateInput{
-		Amount: req.Amount, Currency: req.Currency, Email: req.Email,
+		Amount: req.Amount, Currency: req.Currency, Email: req.Email, CustomerID: req.CustomerID,
+		Description: req.Description, OrderReference: req.OrderReference, Metadata: req.Metadata,
+		ClientConfirmation: req.ClientConfirmation,
+		ClientIP:           c.ClientIP(),
+		CaptchaToken:       c.GetHeader("Captcha-Token"),
 	})
+	var quarantined *cardtesting.QuarantinedError
+	if errors.As(err, &quarantined) {
+		q := quarantined.Quarantine
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(q.ExpiresAt).Seconds())+1))
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(), "captcha_required": q.Action == cardtesting.ActionCaptcha,
+		})
+		return
+	}
+	if errors.Is(err, payment.ErrUnsupportedCurrency) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": err.Error(), "supported_currencies": payment.SupportedCurrencies(),
+		})
+		return
+	}
+	var denied *risk.DeniedError
+	if errors.As(err, &denied) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": err.Error(), "payment_id": denied.PaymentID, "risk_reasons": denied.Reasons,
+		})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusCreated, out)
 }
 
-// POST /v1/payments/:id/capture -> captura fundos autorizados
+type captureReq struct {
+	Amount int64 `json:"amount" example:"3000"`
+}
+
+// POST /v1/payments/:id/capture -> captura fundos autorizados (total ou parcial)
 func (h *PaymentHandler) Capture(c *gin.Context) {
+	var req captureReq
+	if err := bindOptionalJSON(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload", "details": err.Error()})
+		return
+	}
 	id := c.Param("id")
-	out, err := h.svc.Capture(c.Request.Context(), id)
+	out, err := h.svc.Capture(c.Request.Context(), id, service.CaptureInput{Amount: req.Amount})
 	if err != nil {
-		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, out)
@@ -52,7 +102,103 @@ func (h *PaymentHandler) Cancel(c *gin.Context) {
 	id := c.Param("id")
 	out, err := h.svc.Cancel(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+type updateAmountReq struct {
+	Amount int64 `json:"amount" example:"6500"`
+}
+
+// POST /v1/payments/:id/amount -> altera o valor autorizado antes da captura
+func (h *PaymentHandler) UpdateAmount(c *gin.Context) {
+	var req updateAmountReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload", "details": err.Error()})
+		return
+	}
+	out, err := h.svc.UpdateAmount(c.Request.Context(), c.Param("id"), service.UpdateAmountInput{Amount: req.Amount})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+type refundReq struct {
+	Amount int64  `json:"amount" example:"1500"`
+	Reason string `json:"reason" example:"requested_by_customer"`
+}
+
+// POST /v1/payments/:id/refunds -> reembolso total (sem amount) ou parcial
+func (h *PaymentHandler) Refund(c *gin.Context) {
+	var req refundReq
+	if err := bindOptionalJSON(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload", "details": err.Error()})
+		return
+	}
+	out, err := h.svc.Refund(c.Request.Context(), c.Param("id"), service.RefundInput{
+		Amount: req.Amount, Reason: req.Reason,
+	})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, out)
+}
+
+// GET /v1/payments/:id/refunds
+func (h *PaymentHandler) ListRefunds(c *gin.Context) {
+	out, err := h.svc.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	refunds := out.Refunds
+	if refunds == nil {
+		refunds = []payment.Refund{}
+	}
+	c.JSON(http.StatusOK, gin.H{"refunded_amount": out.RefundedAmount, "refunds": refunds})
+}
+
+type listReq struct {
+	Status         string    `form:"status" example:"authorized,captured"`
+	Email          string    `form:"email"`
+	Currency       string    `form:"currency" example:"brl"`
+	OrderReference string    `form:"order_reference"`
+	AmountMin      int64     `form:"amount_min"`
+	AmountMax      int64     `form:"amount_max"`
+	CreatedFrom    time.Time `form:"created_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedTo      time.Time `form:"created_to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Cursor         string    `form:"cursor"`
+	Limit          int       `form:"limit" example:"50"`
+}
+
+// GET /v1/payments -> lista pagamentos com filtros, do mais novo para o mais antigo
+func (h *PaymentHandler) List(c *gin.Context) {
+	var req listReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid query", "details": err.Error()})
+		return
+	}
+	in := service.ListInput{
+		Email: req.Email, Currency: req.Currency, OrderReference: req.OrderReference,
+		AmountMin: req.AmountMin, AmountMax: req.AmountMax,
+		CreatedFrom: req.CreatedFrom, CreatedTo: req.CreatedTo,
+		Cursor: req.Cursor, Limit: req.Limit,
+	}
+	if req.Status != "" {
+		in.Statuses = strings.Split(req.Status, ",")
+	}
+	// metadata[chave]=valor, como na API do Stripe
+	if md, ok := c.GetQueryMap("metadata"); ok {
+		in.Metadata = md
+	}
+	out, err := h.svc.List(c.Request.Context(), in)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, out)
@@ -68,3 +214,46 @@ func (h *PaymentHandler) Get(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, out)
 }
+
+// GET /v1/payments/:id/history -> transições de status do pagamento
+func (h *PaymentHandler) History(c *gin.Context) {
+	out, err := h.svc.History(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"payment_id": c.Param("id"), "history": out})
+}
+
+// bindOptionalJSON aceita corpo vazio, mantendo os valores zero de dst.
+func bindOptionalJSON(c *gin.Context, dst any) error {
+	if err := c.ShouldBindJSON(dst); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// errorStatus devolve 409 quando o pagamento continuou sendo alterado por
+// outro escritor mesmo após as novas tentativas ou não está mais em revisão,
+// 502/503 nas falhas transitórias do Stripe; demais erros são 422.
+func errorStatus(err error) int {
+	if code := gatewayStatus(err); code != 0 {
+		return code
+	}
+	if errors.Is(err, payment.ErrConflict) || errors.Is(err, payment.ErrNotInReview) {
+		return http.StatusConflict
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// gatewayStatus é 502 ou 503 quando err é uma falha transitória do gateway,
+// e 0 nos demais casos.
+func gatewayStatus(err error) int {
+	switch {
+	case errors.Is(err, ports.ErrGatewayUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ports.ErrGatewayFailed):
+		return http.StatusBadGateway
+	}
+	return 0
+}
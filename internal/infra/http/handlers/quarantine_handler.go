@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/williamkoller/golang-payment-stripe/internal/app/cardtesting"
+)
+
+type QuarantineHandler struct {
+	guard *cardtesting.Guard
+}
+
+func NewQuarantineHandler(guard *cardtesting.Guard) *QuarantineHandler {
+	return &QuarantineHandler{guard: guard}
+}
+
+// GET /v1/quarantines?active=true&kind=ip&value=...&limit=50 -> quarentenas, mais recentes primeiro
+func (h *QuarantineHandler) List(c *gin.Context) {
+	q := cardtesting.Query{Kind: cardtesting.Kind(c.Query("kind")), Value: c.Query("value"), Limit: 50}
+	if c.Query("active") == "true" {
+		q.ActiveAt = time.Now().UTC()
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 200"})
+			return
+		}
+		q.Limit = n
+	}
+	out, err := h.guard.List(c.Request.Context(), q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"quarantines": out})
+}
+
+// GET /v1/quarantines/:id
+func (h *QuarantineHandler) Get(c *gin.Context) {
+	out, err := h.guard.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+type releaseReq struct {
+	ReleasedBy string `json:"released_by"`
+	Note       string `json:"note"`
+}
+
+// POST /v1/quarantines/:id/release -> libera a origem antes de expirar
+func (h *QuarantineHandler) Release(c *gin.Context) {
+	var req releaseReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload", "details": err.Error()})
+		return
+	}
+	if req.ReleasedBy == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "released_by is required"})
+		return
+	}
+	out, err := h.guard.Release(c.Request.Context(), c.Param("id"), req.ReleasedBy, req.Note)
+	switch {
+	case errors.Is(err, cardtesting.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	case errors.Is(err, cardtesting.ErrReleased):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
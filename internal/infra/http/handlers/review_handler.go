@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/williamkoller/golang-payment-stripe/internal/app/service"
+)
+
+type ReviewHandler struct {
+	svc *service.ReviewService
+}
+
+func NewReviewHandler(svc *service.ReviewService) *ReviewHandler { return &ReviewHandler{svc: svc} }
+
+type reviewQueueReq struct {
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" example:"50"`
+}
+
+// GET /v1/reviews -> pagamentos em revisão manual, com o prazo do SLA
+func (h *ReviewHandler) Queue(c *gin.Context) {
+	var req reviewQueueReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid query", "details": err.Error()})
+		return
+	}
+	out, err := h.svc.Queue(c.Request.Context(), service.ReviewQueueInput{Cursor: req.Cursor, Limit: req.Limit})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+type reviewDecisionReq struct {
+	Reviewer string `json:"reviewer" example:"ana@ops"`
+	Note     string `json:"note" example:"cliente confirmou a compra por telefone"`
+	Capture  bool   `json:"capture"`
+}
+
+// POST /v1/payments/:id/review/approve -> libera para captura (ou captura com "capture": true)
+func (h *ReviewHandler) Approve(c *gin.Context) {
+	var req reviewDecisionReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload", "details": err.Error()})
+		return
+	}
+	out, err := h.svc.Approve(c.Request.Context(), c.Param("id"), service.ApproveReviewInput{
+		ReviewDecisionInput: service.ReviewDecisionInput{Reviewer: req.Reviewer, Note: req.Note},
+		Capture:             req.Capture,
+	})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// POST /v1/payments/:id/review/reject -> rejeita e cancela a autorização
+func (h *ReviewHandler) Reject(c *gin.Context) {
+	var req reviewDecisionReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload", "details": err.Error()})
+		return
+	}
+	out, err := h.svc.Reject(c.Request.Context(), c.Param("id"), service.ReviewDecisionInput{Reviewer: req.Reviewer, Note: req.Note})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/idempotency"
+	"github.com/williamkoller/golang-payment-stripe/pkg/ulidx"
+	"go.uber.org/zap"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+// Idempotency guarda a primeira requisição de cada Idempotency-Key e a
+// resposta devolvida a ela. Uma nova tentativa com a mesma chave e o mesmo
+// corpo recebe a resposta gravada; com outro corpo ou outra rota, 422; se a
+// primeira ainda está em andamento, 409. Só são gravadas as respostas
+// determinísticas (ver replayable); nas demais a chave fica livre para uma
+// nova tentativa. A exceção é um 5xx depois que o handler associou um recurso
+// à chave (idempotency.Attach): o gateway pode ter agido, então a chave fica
+// interrompida e a nova tentativa retoma o mesmo recurso.
+func Idempotency(store idempotency.Store, ttl time.Duration, zl *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			// sem chave do cliente, a chamada ainda tem um ID próprio para as
+			// chaves enviadas ao Stripe
+			c.Request = c.Request.WithContext(idempotency.WithOperation(c.Request.Context(), ulidx.New()))
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "idempotency key too long"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		fp := fingerprint(c.Request.Method, c.Request.URL.Path, body)
+		now := time.Now().UTC()
+		rec, created, err := store.Begin(idempotency.Record{
+			Key:         key,
+			Fingerprint: fp,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(ttl),
+		})
+		if err != nil {
+			zl.Error("idempotency_begin_failed", zap.String("key", key), zap.String("err", err.Error()))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "idempotency store unavailable"})
+			return
+		}
+		if !created {
+			switch {
+			case rec.Fingerprint != fp:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+					"error": "idempotency key already used with a different request",
+				})
+			case rec.Status != idempotency.StatusCompleted:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+					"error": "a request with this idempotency key is still in progress",
+				})
+			default:
+				c.Header(IdempotentReplayedHeader, "true")
+				c.Data(rec.ResponseCode, rec.ContentType, rec.ResponseBody)
+				c.Abort()
+			}
+			return
+		}
+
+		ctx := idempotency.WithCall(c.Request.Context(), store, rec)
+		c.Request = c.Request.WithContext(ctx)
+		w := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		defer func() {
+			if r := recover(); r != nil {
+				_ = store.Release(key)
+				panic(r)
+			}
+		}()
+		c.Next()
+
+		if !replayable(w.Status()) {
+			if w.Status() >= http.StatusInternalServerError && idempotency.ResourceFrom(ctx) != "" {
+				if err := store.Interrupt(key); err != nil {
+					zl.Warn("idempotency_interrupt_failed", zap.String("key", key), zap.String("err", err.Error()))
+				}
+				return
+			}
+			if err := store.Release(key); err != nil {
+				zl.Warn("idempotency_release_failed", zap.String("key", key), zap.String("err", err.Error()))
+			}
+			return
+		}
+		if err := store.Complete(key, w.Status(), w.Header().Get("Content-Type"), w.body.Bytes()); err != nil {
+			zl.Warn("idempotency_complete_failed", zap.String("key", key), zap.String("err", err.Error()))
+		}
+	}
+}
+
+// replayable indica se a resposta pode ser devolvida às novas tentativas:
+// 2xx e 4xx, exceto os que dependem do momento (409 por concorrência, 408,
+// 429 e o 403 da quarentena, que expira ou passa com o captcha). 5xx,
+// inclusive 502/503 de falhas do Stripe, nunca são gravados.
+func replayable(status int) bool {
+	switch status {
+	case http.StatusConflict, http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusForbidden:
+		return false
+	}
+	return status < http.StatusInternalServerError
+}
+
+func fingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingWriter copia o corpo da resposta para gravá-lo no store.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
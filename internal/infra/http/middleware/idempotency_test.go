@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/idempotency"
+	"go.uber.org/zap"
+)
+
+// idempotentRouter monta uma rota que responde com os status de statuses, em
+// ordem (o último se repete), e conta quantas vezes o handler rodou.
+func idempotentRouter(calls *int, statuses ...int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Idempotency(idempotency.NewMemoryStore(), time.Hour, zap.NewNop()))
+	r.POST("/v1/payments", func(c *gin.Context) {
+		*calls++
+		status := statuses[min(*calls, len(statuses))-1]
+		c.JSON(status, gin.H{"call": *calls, "key": idempotency.KeyFrom(c.Request.Context())})
+	})
+	r.POST("/v1/refunds", func(c *gin.Context) {
+		*calls++
+		c.JSON(http.StatusCreated, gin.H{"call": *calls})
+	})
+	return r
+}
+
+func post(r http.Handler, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplaysCompletedResponse(t *testing.T) {
+	var calls int
+	r := idempotentRouter(&calls, http.StatusCreated)
+
+	first := post(r, "/v1/payments", "key-1", `{"amount":5500}`)
+	second := post(r, "/v1/payments", "key-1", `{"amount":5500}`)
+
+	if calls != 1 {
+		t.Fatalf("handler calls = %d, want 1", calls)
+	}
+	if second.Code != first.Code || second.Body.String() != first.Body.String() {
+		t.Fatalf("replay = %d %s, want %d %s", second.Code, second.Body, first.Code, first.Body)
+	}
+	if first.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Fatal("first response must not be marked as replayed")
+	}
+	if second.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Fatal("replayed response must carry the Idempotent-Replayed header")
+	}
+	if !strings.Contains(first.Body.String(), `"key":"key-1"`) {
+		t.Fatalf("handler did not see the idempotency key in the context: %s", first.Body)
+	}
+}
+
+func TestIdempotencyRejectsDifferentRequest(t *testing.T) {
+	var calls int
+	r := idempotentRouter(&calls, http.StatusCreated)
+
+	post(r, "/v1/payments", "key-1", `{"amount":5500}`)
+	body := post(r, "/v1/payments", "key-1", `{"amount":9900}`)
+	path := post(r, "/v1/refunds", "key-1", `{"amount":5500}`)
+
+	if calls != 1 {
+		t.Fatalf("handler calls = %d, want 1", calls)
+	}
+	for name, w := range map[string]*httptest.ResponseRecorder{"body": body, "path": path} {
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("different %s: status = %d, want 422", name, w.Code)
+		}
+	}
+}
+
+func TestIdempotencyReleasesNonReplayableResponses(t *testing.T) {
+	for _, status := range []int{
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusConflict,
+		http.StatusTooManyRequests,
+		http.StatusForbidden,
+	} {
+		var calls int
+		r := idempotentRouter(&calls, status, http.StatusCreated)
+
+		post(r, "/v1/payments", "key-1", `{"amount":5500}`)
+		retry := post(r, "/v1/payments", "key-1", `{"amount":5500}`)
+
+		if calls != 2 || retry.Code != http.StatusCreated {
+			t.Fatalf("after %d: calls = %d, retry = %d, want the retry to run the handler", status, calls, retry.Code)
+		}
+		if retry.Header().Get(IdempotentReplayedHeader) != "" {
+			t.Fatalf("after %d: retry must not be a replay", status)
+		}
+	}
+}
+
+func TestIdempotencyStoresClientErrors(t *testing.T) {
+	var calls int
+	r := idempotentRouter(&calls, http.StatusUnprocessableEntity, http.StatusCreated)
+
+	post(r, "/v1/payments", "key-1", `{"amount":5500}`)
+	retry := post(r, "/v1/payments", "key-1", `{"amount":5500}`)
+
+	if calls != 1 || retry.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("calls = %d, retry = %d, want the 422 replayed", calls, retry.Code)
+	}
+}
+
+func TestIdempotencyWithoutKeyAlwaysRuns(t *testing.T) {
+	var calls int
+	r := idempotentRouter(&calls, http.StatusCreated)
+
+	post(r, "/v1/payments", "", `{"amount":5500}`)
+	post(r, "/v1/payments", "", `{"amount":5500}`)
+
+	if calls != 2 {
+		t.Fatalf("handler calls = %d, want 2", calls)
+	}
+}
+
+func TestIdempotencyResumesResourceAfterAmbiguousFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Idempotency(idempotency.NewMemoryStore(), time.Hour, zap.NewNop()))
+	var created, resumed []string
+	r.POST("/v1/payments", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		if id := idempotency.ResourceFrom(ctx); id != "" {
+			resumed = append(resumed, id)
+			c.JSON(http.StatusCreated, gin.H{"id": id})
+			return
+		}
+		id := "pay_" + strconv.Itoa(len(created)+1)
+		created = append(created, id)
+		if err := idempotency.Attach(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+		// o gateway não respondeu: o PaymentIntent pode existir
+		c.JSON(http.StatusBadGateway, gin.H{"error": "payment gateway error"})
+	})
+
+	first := post(r, "/v1/payments", "key-1", `{"amount":5500}`)
+	other := post(r, "/v1/payments", "key-1", `{"amount":9900}`)
+	retry := post(r, "/v1/payments", "key-1", `{"amount":5500}`)
+	replay := post(r, "/v1/payments", "key-1", `{"amount":5500}`)
+
+	if first.Code != http.StatusBadGateway {
+		t.Fatalf("first = %d, want 502", first.Code)
+	}
+	if other.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("different body = %d, want 422", other.Code)
+	}
+	if len(created) != 1 || len(resumed) != 1 || resumed[0] != created[0] {
+		t.Fatalf("created = %v, resumed = %v, want the retry to resume the first resource", created, resumed)
+	}
+	if retry.Code != http.StatusCreated || replay.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Fatalf("retry = %d, replay replayed = %q", retry.Code, replay.Header().Get(IdempotentReplayedHeader))
+	}
+}
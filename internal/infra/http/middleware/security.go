@@ -2,10 +2,13 @@ package middleware
 
 import (
 	"context"
+	"crypto/subtle"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
 	"github.com/williamkoller/golang-payment-stripe/internal/infra/config"
 	"github.com/williamkoller/golang-payment-stripe/pkg/ulidx"
 	"go.uber.org/zap"
@@ -20,6 +23,10 @@ func RequestID() gin.HandlerFunc {
 		}
 		c.Writer.Header().Set("X-Request-ID", id)
 		c.Set("request_id", id)
+		c.Request = c.Request.WithContext(payment.WithOrigin(c.Request.Context(), payment.Origin{
+			Source:    payment.SourceAPI,
+			RequestID: id,
+		}))
 		c.Next()
 	}
 }
@@ -33,12 +40,30 @@ func SecurityHeaders() gin.HandlerFunc {
 		c.Writer.Header().Set("X-DNS-Prefetch-Control", "off")
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key, Captcha-Token")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Next()
 	}
 }
 
+// AdminAuth protege as rotas de operação com o token Bearer de
+// ADMIN_API_TOKEN. Sem token configurado, as rotas ficam fechadas.
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin API is disabled"})
+			return
+		}
+		got, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="admin"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or missing admin token"})
+			return
+		}
+		c.Next()
+	}
+}
+
 type limiter struct {
 	lim *rate.Limiter
 }
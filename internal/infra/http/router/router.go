@@ -4,31 +4,31 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/stripe/stripe-go/v76"
+	"github.com/williamkoller/golang-payment-stripe/internal/app/cardtesting"
 	"github.com/williamkoller/golang-payment-stripe/internal/app/service"
-	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
 	"github.com/williamkoller/golang-payment-stripe/internal/infra/config"
 	"github.com/williamkoller/golang-payment-stripe/internal/infra/http/handlers"
 	"github.com/williamkoller/golang-payment-stripe/internal/infra/http/middleware"
 	"github.com/williamkoller/golang-payment-stripe/internal/infra/http/webhook"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/idempotency"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/inbox"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/outbox"
 	"go.uber.org/zap"
 )
 
-// Interfaces mínimas para reduzir acoplamento e evitar type-assert confuso
-type StripeVerifier interface {
-	VerifyWebhookSignature(payload []byte, sigHeader string) (stripe.Event, error)
-}
-type PaymentRepo interface {
-	GetByPaymentIntent(piID string) (*payment.Payment, error)
-	Update(p *payment.Payment) error
-}
-
 func Build(
 	zl *zap.Logger,
 	cfg *config.Config,
 	svc *service.PaymentService,
-	sv StripeVerifier,
-	repo PaymentRepo,
+	ns *service.NotificationService,
+	cs *service.CustomerService,
+	ds *service.DisputeService,
+	rs *service.ReviewService,
+	wh *webhook.Handler,
+	ob outbox.Store,
+	idem idempotency.Store,
+	ib inbox.Store,
+	guard *cardtesting.Guard,
 ) *gin.Engine {
 
 	if cfg.Env == "prod" {
@@ -36,6 +36,10 @@ func Build(
 	}
 
 	r := gin.New()
+	// sem proxies configurados, ClientIP ignora X-Forwarded-For e X-Real-IP
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		zl.Sugar().Fatalw("trusted_proxies", "error", err)
+	}
 	r.Use(
 		gin.Recovery(),
 		middleware.RequestID(),
@@ -49,15 +53,74 @@ func Build(
 
 	// Payments
 	ph := handlers.NewPaymentHandler(svc)
-	r.POST("/v1/payments", ph.Create)
+	idk := middleware.Idempotency(idem, cfg.IdempotencyTTL, zl)
+	r.POST("/v1/payments", idk, ph.Create)
+	r.GET("/v1/payments", ph.List)
 	r.GET("/v1/payments/:id", ph.Get)
-	r.POST("/v1/payments/:id/capture", ph.Capture)
-	r.POST("/v1/payments/:id/cancel", ph.Cancel)
+	r.GET("/v1/payments/:id/history", ph.History)
+	r.POST("/v1/payments/:id/capture", idk, ph.Capture)
+	r.POST("/v1/payments/:id/cancel", idk, ph.Cancel)
+	r.POST("/v1/payments/:id/amount", idk, ph.UpdateAmount)
+	r.POST("/v1/payments/:id/refunds", idk, ph.Refund)
+	r.GET("/v1/payments/:id/refunds", ph.ListRefunds)
+
+	// Customers
+	ch := handlers.NewCustomerHandler(cs)
+	r.POST("/v1/customers", ch.Create)
+	r.GET("/v1/customers", ch.List)
+	r.GET("/v1/customers/:id", ch.Get)
+	r.PATCH("/v1/customers/:id", ch.Update)
+	r.DELETE("/v1/customers/:id", ch.Delete)
+	r.GET("/v1/customers/:id/payments", ch.Payments)
+
+	// Disputas (chargebacks)
+	dh := handlers.NewDisputeHandler(ds)
+	r.GET("/v1/disputes", dh.List)
+	r.GET("/v1/disputes/:id", dh.Get)
+	r.POST("/v1/disputes/:id/evidence", dh.Evidence)
+	r.POST("/v1/disputes/:id/files", dh.UploadFile)
 
 	// Webhook Stripe
-	wh := webhook.NewStripeWebhook(zl, sv, repo)
 	r.POST("/v1/webhooks/stripe", wh.Handle)
 
+	// Rotas de operação: exigem o token de ADMIN_API_TOKEN
+	admin := r.Group("", middleware.AdminAuth(cfg.AdminAPIToken))
+
+	// Reviews
+	rh := handlers.NewReviewHandler(rs)
+	admin.GET("/v1/reviews", rh.Queue)
+	admin.POST("/v1/payments/:id/review/approve", idk, rh.Approve)
+	admin.POST("/v1/payments/:id/review/reject", idk, rh.Reject)
+
+	// Quarentenas por teste de cartões
+	qh := handlers.NewQuarantineHandler(guard)
+	admin.GET("/v1/quarantines", qh.List)
+	admin.GET("/v1/quarantines/:id", qh.Get)
+	admin.POST("/v1/quarantines/:id/release", qh.Release)
+
+	// Webhooks de saída (serviços internos)
+	nh := handlers.NewNotificationHandler(ns)
+	admin.POST("/v1/webhook-endpoints", nh.CreateEndpoint)
+	admin.GET("/v1/webhook-endpoints", nh.ListEndpoints)
+	admin.GET("/v1/webhook-endpoints/:id", nh.GetEndpoint)
+	admin.DELETE("/v1/webhook-endpoints/:id", nh.DeleteEndpoint)
+	admin.GET("/v1/webhook-endpoints/:id/deliveries", nh.ListDeliveries)
+	admin.GET("/v1/webhook-deliveries/:id", nh.GetDelivery)
+	admin.POST("/v1/webhook-deliveries/:id/redeliver", nh.Redeliver)
+
+	// Outbox
+	oh := handlers.NewOutboxHandler(ob)
+	admin.GET("/v1/outbox/dead-letters", oh.DeadLetters)
+	admin.POST("/v1/outbox/dead-letters/:id/requeue", oh.Requeue)
+
+	// Inbox de eventos do Stripe
+	ih := handlers.NewInboxHandler(ib)
+	admin.GET("/v1/webhooks/stripe/unknown-events", wh.ListUnknown)
+	admin.GET("/v1/webhooks/stripe/events", ih.List)
+	admin.GET("/v1/webhooks/stripe/events/:id", ih.Get)
+	admin.POST("/v1/webhooks/stripe/events/:id/retry", ih.Retry)
+	admin.GET("/v1/webhooks/stripe/dead-letters", ih.DeadLetters)
+
 	// Endpoint de teste para webhook (remover em produção)
 	if cfg.Env != "prod" {
 		r.POST("/v1/webhooks/stripe/test", wh.HandleTest)
@@ -0,0 +1,327 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/stripe/stripe-go/v76"
+	"github.com/williamkoller/golang-payment-stripe/internal/app/cardtesting"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/dispute"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/risk"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/inbox"
+	"github.com/williamkoller/golang-payment-stripe/pkg/ulidx"
+	"go.uber.org/zap"
+)
+
+// registerDefaults liga os eventos do Stripe às transições do pagamento.
+func (h *Handler) registerDefaults() {
+	h.Register("payment_intent.requires_capture", h.onRequiresCapture)
+	h.Register("payment_intent.amount_capturable_updated", h.onCapturableUpdated)
+	h.Register("payment_intent.requires_action", h.onPending(payment.StatusRequiresAction)) // 3-D Secure pendente no frontend
+	h.Register("payment_intent.processing", h.onPending(payment.StatusProcessing))
+	h.Register("payment_intent.payment_failed", h.onPaymentFailed)
+	h.Register("payment_intent.succeeded", h.onSucceeded)
+	h.Register("payment_intent.canceled", h.onCanceled)
+	h.Register("charge.refunded", h.onChargeRefunded)
+	h.Register("refund.created", h.onRefund)
+	h.Register("refund.updated", h.onRefund)
+	for _, t := range []stripe.EventType{
+		"charge.dispute.created",
+		"charge.dispute.updated",
+		"charge.dispute.closed",
+		"charge.dispute.funds_withdrawn",
+		"charge.dispute.funds_reinstated",
+	} {
+		h.Register(t, h.onDispute)
+	}
+}
+
+func (h *Handler) onRequiresCapture(e stripe.Event, origin payment.Origin) (inbox.Status, error) {
+	var pi stripe.PaymentIntent
+	if err := json.Unmarshal(e.Data.Raw, &pi); err != nil {
+		return inbox.StatusFailed, err
+	}
+	prev := h.current(pi.ID)
+	card := h.confirmedCard(prev, &pi)
+	st, err := h.apply(pi.ID, origin, func(p *payment.Payment) error {
+		if p.HoldsAuthorization() && p.StripePaymentIntentID == pi.ID {
+			return nil
+		}
+		return card.authorize(p, pi.ID)
+	})
+	h.recordAttempt(prev, pi.ID, st, false)
+	return st, err
+}
+
+// onCapturableUpdated autoriza o pagamento que ainda aguardava o cliente; já
+// autorizado, só registra divergência entre o valor capturável e o do pagamento.
+func (h *Handler) onCapturableUpdated(e stripe.Event, origin payment.Origin) (inbox.Status, error) {
+	var pi stripe.PaymentIntent
+	if err := json.Unmarshal(e.Data.Raw, &pi); err != nil {
+		return inbox.StatusFailed, err
+	}
+	if pi.AmountCapturable == 0 {
+		return inbox.StatusIgnored, nil
+	}
+	prev := h.current(pi.ID)
+	card := h.confirmedCard(prev, &pi)
+	st, err := h.apply(pi.ID, origin, func(p *payment.Payment) error {
+		if !p.HoldsAuthorization() {
+			return card.authorize(p, pi.ID)
+		}
+		if pi.AmountCapturable != p.Amount {
+			h.zl.Warn("webhook_capturable_mismatch",
+				zap.String("payment_id", p.ID),
+				zap.String("pi", pi.ID),
+				zap.Int64("amount", p.Amount),
+				zap.Int64("amount_capturable", pi.AmountCapturable))
+		}
+		return nil
+	})
+	h.recordAttempt(prev, pi.ID, st, false)
+	return st, err
+}
+
+// current é o pagamento de piID antes de aplicar o evento; nil se não for
+// encontrado (apply devolve o erro).
+func (h *Handler) current(piID string) *payment.Payment {
+	p, err := h.r.GetByPaymentIntent(piID)
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+// recordAttempt leva ao guard de teste de cartões o resultado de uma
+// autorização que aguardava o cliente antes do evento. As concluídas na
+// própria requisição já foram registradas pelo serviço de pagamentos.
+func (h *Handler) recordAttempt(prev *payment.Payment, piID string, st inbox.Status, declined bool) {
+	if st != inbox.StatusProcessed || prev == nil || prev.StripePaymentIntentID != piID || !prev.AwaitingCustomer() {
+		return
+	}
+	src := cardtesting.Source{IP: prev.ClientIP, Email: prev.Email}
+	h.ga.Record(context.Background(), src, prev.Currency, prev.Amount, declined)
+}
+
+// confirmation é o cartão confirmado no frontend, resolvido antes de aplicar
+// o evento para que a janela de velocidade conte a tentativa uma só vez.
+type confirmation struct {
+	card       payment.Card
+	objections []risk.Reason
+}
+
+// confirmedCard busca no Stripe o cartão que autorizou pi quando o pagamento
+// ainda não o conhece (client_confirmation) e o avalia nas regras de cartão:
+// BIN, país emissor e velocidade por cartão. As objeções viram review mesmo
+// quando a regra recusaria, porque a autorização já existe.
+func (h *Handler) confirmedCard(p *payment.Payment, pi *stripe.PaymentIntent) confirmation {
+	if p == nil || p.CardFingerprint != "" || p.HoldsAuthorization() || p.StripePaymentIntentID != pi.ID {
+		return confirmation{}
+	}
+	card, err := h.cs.Card(context.Background(), pi.ID, "")
+	if err != nil || card.Fingerprint == "" {
+		if err != nil {
+			h.zl.Warn("webhook_card_lookup_failed",
+				zap.String("payment_id", p.ID),
+				zap.String("pi", pi.ID),
+				zap.String("err", err.Error()))
+		}
+		return confirmation{}
+	}
+	c := confirmation{card: card}
+	in := risk.Input{
+		PaymentID:       p.ID,
+		Amount:          p.Amount,
+		Currency:        p.Currency,
+		CardBIN:         card.BIN,
+		CardCountry:     card.Country,
+		CardFingerprint: card.Fingerprint,
+		At:              time.Now().UTC(),
+	}
+	for _, check := range h.cc {
+		if r, hit := check.Check(in); hit {
+			r.Outcome = risk.Review
+			c.objections = append(c.objections, r)
+		}
+	}
+	return c
+}
+
+// authorize grava o cartão confirmado, se houver, e autoriza o pagamento; uma
+// objeção leva o pagamento a in_review.
+func (c confirmation) authorize(p *payment.Payment, piID string) error {
+	if c.card.Fingerprint != "" && p.CardFingerprint == "" {
+		if err := p.RecordCard(c.card, c.objections); err != nil {
+			return err
+		}
+	}
+	return p.MarkAuthorized(piID)
+}
+
+// onPending move o pagamento para um status de espera do PaymentIntent; não
+// volta um pagamento já autorizado (eventos fora de ordem).
+func (h *Handler) onPending(to payment.Status) EventHandler {
+	return func(e stripe.Event, origin payment.Origin) (inbox.Status, error) {
+		var pi stripe.PaymentIntent
+		if err := json.Unmarshal(e.Data.Raw, &pi); err != nil {
+			return inbox.StatusFailed, err
+		}
+		return h.apply(pi.ID, origin, func(p *payment.Payment) error {
+			if p.Status == to || p.HoldsAuthorization() {
+				return nil
+			}
+			return p.MarkPending(to, pi.ID)
+		})
+	}
+}
+
+// onPaymentFailed guarda a recusa (code/decline_code) do last_payment_error.
+func (h *Handler) onPaymentFailed(e stripe.Event, origin payment.Origin) (inbox.Status, error) {
+	var pi stripe.PaymentIntent
+	if err := json.Unmarshal(e.Data.Raw, &pi); err != nil {
+		return inbox.StatusFailed, err
+	}
+	var f payment.Failure
+	if le := pi.LastPaymentError; le != nil {
+		f = payment.Failure{Code: string(le.Code), DeclineCode: string(le.DeclineCode), Message: le.Msg}
+	}
+	prev := h.current(pi.ID)
+	st, err := h.apply(pi.ID, origin, func(p *payment.Payment) error {
+		declined := p.Status == payment.StatusFailed || p.Status == payment.StatusRequiresPaymentMethod
+		if declined && p.LastFailure != nil && *p.LastFailure == f {
+			return nil
+		}
+		return p.MarkDeclined(pi.ID, f)
+	})
+	h.recordAttempt(prev, pi.ID, st, true)
+	return st, err
+}
+
+func (h *Handler) onSucceeded(e stripe.Event, origin payment.Origin) (inbox.Status, error) {
+	var pi stripe.PaymentIntent
+	if err := json.Unmarshal(e.Data.Raw, &pi); err != nil {
+		return inbox.StatusFailed, err
+	}
+	return h.apply(pi.ID, origin, func(p *payment.Payment) error {
+		if p.Status == payment.StatusCaptured {
+			return nil
+		}
+		return p.MarkCaptured(pi.AmountReceived)
+	})
+}
+
+func (h *Handler) onCanceled(e stripe.Event, origin payment.Origin) (inbox.Status, error) {
+	var pi stripe.PaymentIntent
+	if err := json.Unmarshal(e.Data.Raw, &pi); err != nil {
+		return inbox.StatusFailed, err
+	}
+	return h.apply(pi.ID, origin, func(p *payment.Payment) error {
+		if p.Status == payment.StatusCanceled {
+			return nil
+		}
+		return p.MarkCanceled()
+	})
+}
+
+// onChargeRefunded registra refunds feitos fora da API (ex.: Dashboard) que
+// vierem listados na charge. Refunds sem ID nunca são criados: os que a
+// charge não listar chegam por refund.created/refund.updated.
+func (h *Handler) onChargeRefunded(e stripe.Event, origin payment.Origin) (inbox.Status, error) {
+	var ch stripe.Charge
+	if err := json.Unmarshal(e.Data.Raw, &ch); err != nil {
+		return inbox.StatusFailed, err
+	}
+	if ch.PaymentIntent == nil || ch.Refunds == nil {
+		return inbox.StatusIgnored, nil
+	}
+	return h.applyUnordered(ch.PaymentIntent.ID, origin, func(p *payment.Payment) error {
+		for _, rf := range ch.Refunds.Data {
+			if err := recordRefund(p, rf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// onRefund registra o refund do evento pelo ID do Stripe; um refund já
+// registrado (pela API ou por outro evento) é ignorado. Como o registro é por
+// ID, o evento vale mesmo se chegar depois de outro mais novo.
+func (h *Handler) onRefund(e stripe.Event, origin payment.Origin) (inbox.Status, error) {
+	var rf stripe.Refund
+	if err := json.Unmarshal(e.Data.Raw, &rf); err != nil {
+		return inbox.StatusFailed, err
+	}
+	if rf.PaymentIntent == nil {
+		return inbox.StatusIgnored, nil
+	}
+	return h.applyUnordered(rf.PaymentIntent.ID, origin, func(p *payment.Payment) error {
+		if (rf.Status == stripe.RefundStatusFailed || rf.Status == stripe.RefundStatusCanceled) && p.HasRefund(rf.ID) {
+			h.zl.Warn("webhook_refund_reversed",
+				zap.String("payment_id", p.ID),
+				zap.String("refund", rf.ID),
+				zap.String("status", string(rf.Status)))
+		}
+		return recordRefund(p, &rf)
+	})
+}
+
+// recordRefund registra rf no pagamento, a menos que já esteja registrado ou
+// tenha falhado ou sido cancelado.
+func recordRefund(p *payment.Payment, rf *stripe.Refund) error {
+	if rf.ID == "" || rf.Status == stripe.RefundStatusFailed || rf.Status == stripe.RefundStatusCanceled || p.HasRefund(rf.ID) {
+		return nil
+	}
+	return p.AddRefund(payment.Refund{
+		ID:             ulidx.New(),
+		Amount:         rf.Amount,
+		Reason:         string(rf.Reason),
+		StripeRefundID: rf.ID,
+		CreatedAt:      refundedAt(rf),
+	})
+}
+
+func refundedAt(rf *stripe.Refund) time.Time {
+	if rf.Created == 0 {
+		return time.Now().UTC()
+	}
+	return time.Unix(rf.Created, 0).UTC()
+}
+
+// onDispute sincroniza a disputa (e o status disputed do pagamento) com o
+// objeto do evento.
+func (h *Handler) onDispute(e stripe.Event, origin payment.Origin) (inbox.Status, error) {
+	var d stripe.Dispute
+	if err := json.Unmarshal(e.Data.Raw, &d); err != nil {
+		return inbox.StatusFailed, err
+	}
+	if d.PaymentIntent == nil {
+		return inbox.StatusIgnored, errors.New("dispute without payment intent")
+	}
+	snap := dispute.Snapshot{
+		StripeDisputeID: d.ID,
+		PaymentIntentID: d.PaymentIntent.ID,
+		Amount:          d.Amount,
+		Currency:        string(d.Currency),
+		Reason:          string(d.Reason),
+		Status:          dispute.Status(d.Status),
+		At:              origin.GatewayEventAt,
+	}
+	if d.Charge != nil {
+		snap.ChargeID = d.Charge.ID
+	}
+	if d.EvidenceDetails != nil && d.EvidenceDetails.DueBy > 0 {
+		snap.EvidenceDueBy = time.Unix(d.EvidenceDetails.DueBy, 0).UTC()
+	}
+	changed, err := h.ds.Sync(payment.WithOrigin(context.Background(), origin), snap)
+	switch {
+	case err != nil:
+		return inbox.StatusFailed, err
+	case !changed:
+		return inbox.StatusIgnored, errStale
+	}
+	return inbox.StatusProcessed, nil
+}
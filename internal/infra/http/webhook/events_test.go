@@ -0,0 +1,199 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v76"
+	"github.com/williamkoller/golang-payment-stripe/internal/app/cardtesting"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/risk"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/inbox"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/outbox"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/repo/memory"
+)
+
+// capturedPayment grava um pagamento de 5000 BRL capturado no PaymentIntent
+// pi_1 por um webhook criado em at.
+func capturedPayment(t *testing.T, r *memory.PaymentRepo, at time.Time) *payment.Payment {
+	t.Helper()
+	p, err := payment.New("pay_1", payment.Money{Amount: 5000, Currency: "brl"}, "buyer@example.com", payment.Details{}, payment.Origin{Source: payment.SourceAPI})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Create(p); err != nil {
+		t.Fatal(err)
+	}
+	p.SetOrigin(payment.Origin{Source: payment.SourceWebhook, GatewayEventAt: at})
+	if err := p.MarkAuthorized("pi_1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.MarkCaptured(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Update(p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func stripeEvent(t *testing.T, id string, typ stripe.EventType, obj map[string]any) stripe.Event {
+	t.Helper()
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stripe.Event{ID: id, Type: typ, Data: &stripe.EventData{Raw: raw}}
+}
+
+func webhookOrigin(id string, at time.Time) payment.Origin {
+	return payment.Origin{Source: payment.SourceWebhook, GatewayEventID: id, GatewayEventAt: at}
+}
+
+func TestRefundEventsAreRecordedOutOfOrder(t *testing.T) {
+	r := memory.NewPaymentRepo(outbox.NewMemoryStore())
+	h, _ := newProcessor(t)
+	h.r = r
+
+	t0 := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	capturedPayment(t, r, t0)
+
+	refund := func(id string, amount int64, at time.Time) map[string]any {
+		return map[string]any{
+			"id": id, "object": "refund", "amount": amount, "status": "succeeded",
+			"payment_intent": "pi_1", "created": at.Unix(),
+		}
+	}
+	// o Stripe criou re_1 antes de re_2, mas o evento de re_2 chega primeiro
+	t1, t2 := t0.Add(time.Minute), t0.Add(2*time.Minute)
+	deliveries := []struct {
+		evt stripe.Event
+		at  time.Time
+	}{
+		{stripeEvent(t, "evt_2", "refund.created", refund("re_2", 1000, t2)), t2},
+		{stripeEvent(t, "evt_1", "refund.created", refund("re_1", 500, t1)), t1},
+		// reentrega do primeiro: já registrado
+		{stripeEvent(t, "evt_1b", "refund.updated", refund("re_1", 500, t1)), t1},
+	}
+	want := []inbox.Status{inbox.StatusProcessed, inbox.StatusProcessed, inbox.StatusIgnored}
+	for i, d := range deliveries {
+		st, err := h.process(d.evt, webhookOrigin(d.evt.ID, d.at))
+		if err != nil || st != want[i] {
+			t.Fatalf("%s: status = %s, err = %v, want %s", d.evt.ID, st, err, want[i])
+		}
+	}
+
+	p, err := r.GetByPaymentIntent("pi_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.HasRefund("re_1") || !p.HasRefund("re_2") || len(p.Refunds) != 2 {
+		t.Fatalf("refunds = %+v, want re_1 and re_2 once each", p.Refunds)
+	}
+	if got := p.RefundableAmount(); got != 3500 {
+		t.Fatalf("refundable = %d, want 3500", got)
+	}
+}
+
+func TestChargeRefundedIsRecordedOutOfOrder(t *testing.T) {
+	r := memory.NewPaymentRepo(outbox.NewMemoryStore())
+	h, _ := newProcessor(t)
+	h.r = r
+
+	t0 := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	capturedPayment(t, r, t0)
+
+	late := stripeEvent(t, "evt_2", "refund.created", map[string]any{
+		"id": "re_2", "object": "refund", "amount": 1000, "status": "succeeded", "payment_intent": "pi_1",
+	})
+	if _, err := h.process(late, webhookOrigin("evt_2", t0.Add(2*time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+	early := stripeEvent(t, "evt_1", "charge.refunded", map[string]any{
+		"id": "ch_1", "object": "charge", "payment_intent": "pi_1",
+		"refunds": map[string]any{"object": "list", "data": []any{
+			map[string]any{"id": "re_1", "object": "refund", "amount": 500, "status": "succeeded"},
+		}},
+	})
+	st, err := h.process(early, webhookOrigin("evt_1", t0.Add(time.Minute)))
+	if err != nil || st != inbox.StatusProcessed {
+		t.Fatalf("charge.refunded: status = %s, err = %v, want processed", st, err)
+	}
+	p, _ := r.GetByPaymentIntent("pi_1")
+	if !p.HasRefund("re_1") || !p.HasRefund("re_2") {
+		t.Fatalf("refunds = %+v, want re_1 and re_2", p.Refunds)
+	}
+}
+
+func TestStatusEventsOlderThanTheLastChangeAreIgnored(t *testing.T) {
+	r := memory.NewPaymentRepo(outbox.NewMemoryStore())
+	h, _ := newProcessor(t)
+	h.r = r
+
+	t0 := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	capturedPayment(t, r, t0)
+
+	old := stripeEvent(t, "evt_0", "payment_intent.canceled", map[string]any{
+		"id": "pi_1", "object": "payment_intent", "status": "canceled",
+	})
+	st, err := h.process(old, webhookOrigin("evt_0", t0.Add(-time.Minute)))
+	if st != inbox.StatusIgnored || err != errStale {
+		t.Fatalf("status = %s, err = %v, want ignored as stale", st, err)
+	}
+}
+
+// stripeCards devolve sempre o mesmo cartão, como o Stripe devolveria o do
+// PaymentMethod confirmado.
+type stripeCards struct{ card payment.Card }
+
+func (c stripeCards) Card(context.Context, string, string) (payment.Card, error) {
+	return c.card, nil
+}
+
+type noAttempts struct{}
+
+func (noAttempts) Record(context.Context, cardtesting.Source, string, int64, bool) {}
+
+func TestConfirmedCardIsCheckedAgainstCardRules(t *testing.T) {
+	r := memory.NewPaymentRepo(outbox.NewMemoryStore())
+	h, _ := newProcessor(t)
+	h.r = r
+	h.cs = stripeCards{payment.Card{Fingerprint: "fp_1", BIN: "411111", Country: "NG"}}
+	h.cc = []CardCheck{risk.RuleCheck{Rule: risk.CardRule{BlockedCountries: []string{"NG"}}}}
+	h.ga = noAttempts{}
+
+	// confirmação no frontend: o risco foi avaliado sem o cartão
+	p, err := payment.New("pay_1", payment.Money{Amount: 5000, Currency: "brl"}, "buyer@example.com",
+		payment.Details{ClientConfirmation: true}, payment.Origin{Source: payment.SourceAPI})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RecordRisk(risk.Decision{Outcome: risk.Allow}, payment.Card{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.MarkPending(payment.StatusRequiresAction, "pi_1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Create(p); err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Now().UTC().Truncate(time.Second)
+	evt := stripeEvent(t, "evt_1", "payment_intent.requires_capture", map[string]any{
+		"id": "pi_1", "object": "payment_intent", "status": "requires_capture",
+	})
+	if st, err := h.process(evt, webhookOrigin("evt_1", at)); err != nil || st != inbox.StatusProcessed {
+		t.Fatalf("status = %s, err = %v, want processed", st, err)
+	}
+
+	p, _ = r.GetByPaymentIntent("pi_1")
+	if p.CardBIN != "411111" || p.CardCountry != "NG" || p.CardFingerprint != "fp_1" {
+		t.Fatalf("card = %s %s %s, want the one read from Stripe", p.CardBIN, p.CardCountry, p.CardFingerprint)
+	}
+	// a autorização já existe: o país bloqueado leva à revisão, não à recusa
+	if p.Status != payment.StatusInReview || p.Risk.Outcome != risk.Review {
+		t.Fatalf("status = %s, risk = %+v, want in_review", p.Status, p.Risk)
+	}
+}
@@ -0,0 +1,183 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"time"
+
+	"github.com/stripe/stripe-go/v76"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/inbox"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/outbox"
+	"go.uber.org/zap"
+)
+
+// Run processa os eventos pendentes do inbox até ctx ser cancelado. Cada
+// chave (PaymentIntent) é sempre enviada ao mesmo worker e só tem um evento
+// em processamento por vez, então os eventos de um pagamento são aplicados
+// na ordem de recebimento.
+func (h *Handler) Run(ctx context.Context) {
+	shards := make([]chan inbox.Event, h.workers)
+	done := make(chan struct{}, h.workers)
+	for i := range shards {
+		shards[i] = make(chan inbox.Event, h.batch)
+		go func(ch chan inbox.Event) {
+			defer func() { done <- struct{}{} }()
+			h.work(ctx, ch)
+		}(shards[i])
+	}
+	defer func() {
+		for range shards {
+			<-done
+		}
+	}()
+
+	t := time.NewTicker(h.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-h.wake:
+		}
+		h.dispatch(ctx, shards)
+	}
+}
+
+// notify acorda o Run sem esperar o próximo tick.
+func (h *Handler) notify() {
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (h *Handler) dispatch(ctx context.Context, shards []chan inbox.Event) {
+	evts, err := h.ib.Due(time.Now().UTC(), h.batch)
+	if err != nil {
+		h.zl.Error("webhook_due_failed", zap.String("err", err.Error()))
+		return
+	}
+	for _, e := range evts {
+		h.mu.Lock()
+		busy := h.inflight[e.Key]
+		h.inflight[e.Key] = true
+		h.mu.Unlock()
+		if busy {
+			continue
+		}
+		select {
+		case shards[shard(e.Key, len(shards))] <- e:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (h *Handler) work(ctx context.Context, ch chan inbox.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-ch:
+			h.handleEvent(e)
+			h.mu.Lock()
+			delete(h.inflight, e.Key)
+			h.mu.Unlock()
+			h.notify() // próximo evento da mesma chave
+		}
+	}
+}
+
+// handleEvent aplica o evento e grava o resultado. Só falhas (leitura ou
+// gravação) são tentadas de novo, com backoff; ao esgotar as tentativas o
+// evento vai para dead e aguarda o operador.
+func (h *Handler) handleEvent(ie inbox.Event) {
+	// o Due pode ter lido o evento antes de outro worker concluir a tentativa
+	if cur, err := h.ib.Get(ie.ID); err != nil || cur.Status.Done() || cur.Attempts != ie.Attempts {
+		return
+	}
+	var (
+		st  inbox.Status
+		err error
+		e   stripe.Event
+	)
+	if err = json.Unmarshal(ie.Payload, &e); err != nil {
+		st = inbox.StatusFailed
+	} else {
+		st, err = h.process(e, payment.Origin{
+			Source:         payment.SourceWebhook,
+			RequestID:      ie.RequestID,
+			GatewayEventID: ie.ID,
+			GatewayEventAt: ie.Created,
+		})
+	}
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+
+	attempts := ie.Attempts + 1
+	switch {
+	case st != inbox.StatusFailed:
+		err = h.ib.Finish(ie.ID, st, attempts, msg)
+	case attempts >= h.maxAttempts:
+		h.zl.Error("webhook_dead_letter",
+			zap.String("event_id", ie.ID),
+			zap.String("type", ie.Type),
+			zap.Int("attempts", attempts),
+			zap.String("err", msg))
+		err = h.ib.Finish(ie.ID, inbox.StatusDead, attempts, msg)
+	default:
+		next := time.Now().UTC().Add(outbox.Backoff(h.backoff, attempts))
+		h.zl.Warn("webhook_event_failed",
+			zap.String("event_id", ie.ID),
+			zap.String("type", ie.Type),
+			zap.Int("attempts", attempts),
+			zap.Time("next_attempt_at", next),
+			zap.String("err", msg))
+		err = h.ib.Retry(ie.ID, attempts, next, msg)
+	}
+	if err != nil {
+		h.zl.Error("webhook_inbox_failed", zap.String("event_id", ie.ID), zap.String("err", err.Error()))
+	}
+}
+
+func shard(key string, n int) int {
+	f := fnv.New32a()
+	_, _ = f.Write([]byte(key))
+	return int(f.Sum32() % uint32(n))
+}
+
+// eventKey é o PaymentIntent do objeto do evento (o próprio PaymentIntent ou
+// o campo payment_intent de charges, refunds e disputes); sem ele, o ID do
+// evento, que não precisa de ordem.
+func eventKey(e stripe.Event) string {
+	if e.Data == nil {
+		return e.ID
+	}
+	var obj struct {
+		ID            string          `json:"id"`
+		Object        string          `json:"object"`
+		PaymentIntent json.RawMessage `json:"payment_intent"`
+	}
+	if json.Unmarshal(e.Data.Raw, &obj) != nil {
+		return e.ID
+	}
+	if obj.Object == "payment_intent" && obj.ID != "" {
+		return obj.ID
+	}
+	var id string
+	if json.Unmarshal(obj.PaymentIntent, &id) == nil && id != "" {
+		return id
+	}
+	var pi struct {
+		ID string `json:"id"`
+	}
+	if json.Unmarshal(obj.PaymentIntent, &pi) == nil && pi.ID != "" {
+		return pi.ID
+	}
+	return e.ID
+}
@@ -0,0 +1,167 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v76"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/config"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/inbox"
+	"go.uber.org/zap"
+)
+
+const orderedEvent stripe.EventType = "test.ordered"
+
+// orderLog registra a ordem em que os eventos de cada chave foram aplicados
+// e acusa dois eventos da mesma chave em processamento ao mesmo tempo.
+type orderLog struct {
+	mu      sync.Mutex
+	applied map[string][]string
+	running map[string]bool
+	overlap []string
+	failed  map[string]bool // eventos que já falharam uma vez
+}
+
+func newProcessor(t *testing.T) (*Handler, inbox.Store) {
+	t.Helper()
+	ib := inbox.NewMemoryStore()
+	cfg := &config.Config{
+		StripeWebhookWorkers:      4,
+		StripeWebhookPollInterval: time.Millisecond,
+		StripeWebhookBatchSize:    100,
+		StripeWebhookMaxAttempts:  5,
+		StripeWebhookRetryBackoff: time.Millisecond,
+	}
+	return NewStripeWebhook(zap.NewNop(), nil, nil, nil, nil, nil, nil, ib, cfg), ib
+}
+
+func enqueue(t *testing.T, ib inbox.Store, id, key string, at time.Time) {
+	t.Helper()
+	raw, _ := json.Marshal(map[string]any{"id": id, "type": orderedEvent, "data": map[string]any{"object": map[string]any{"key": key}}})
+	if _, _, err := ib.Begin(inbox.Event{ID: id, Key: key, Type: string(orderedEvent), Payload: raw, ReceivedAt: at}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessorAppliesEventsInOrderPerKey(t *testing.T) {
+	h, ib := newProcessor(t)
+	log := &orderLog{applied: map[string][]string{}, running: map[string]bool{}, failed: map[string]bool{}}
+	h.Register(orderedEvent, func(e stripe.Event, _ payment.Origin) (inbox.Status, error) {
+		var obj struct {
+			Key string `json:"key"`
+		}
+		_ = json.Unmarshal(e.Data.Raw, &obj)
+
+		log.mu.Lock()
+		if log.running[obj.Key] {
+			log.overlap = append(log.overlap, e.ID)
+		}
+		log.running[obj.Key] = true
+		// o primeiro evento de cada chave falha uma vez: os seguintes
+		// precisam esperar a nova tentativa
+		fail := e.ID[len(e.ID)-2:] == "-0" && !log.failed[e.ID]
+		log.failed[e.ID] = true
+		log.mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		log.mu.Lock()
+		defer log.mu.Unlock()
+		log.running[obj.Key] = false
+		if fail {
+			return inbox.StatusFailed, errors.New("transient failure")
+		}
+		log.applied[obj.Key] = append(log.applied[obj.Key], e.ID)
+		return inbox.StatusProcessed, nil
+	})
+
+	// eventos de chaves diferentes intercalados na ordem de recebimento
+	keys := []string{"pi_a", "pi_b", "pi_c"}
+	const perKey = 5
+	at := time.Now().UTC()
+	for i := range perKey {
+		for _, k := range keys {
+			at = at.Add(time.Microsecond)
+			enqueue(t, ib, fmt.Sprintf("%s-%d", k, i), k, at)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		log.mu.Lock()
+		n := 0
+		for _, ids := range log.applied {
+			n += len(ids)
+		}
+		log.mu.Unlock()
+		if n == len(keys)*perKey {
+			break
+		}
+		if time.Now().After(deadline) {
+			cancel()
+			<-done
+			t.Fatalf("applied %d of %d events before the deadline", n, len(keys)*perKey)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if len(log.overlap) > 0 {
+		t.Fatalf("events processed concurrently with another of the same key: %v", log.overlap)
+	}
+	for _, k := range keys {
+		for i, id := range log.applied[k] {
+			if want := fmt.Sprintf("%s-%d", k, i); id != want {
+				t.Fatalf("key %s: applied %v, want %s at position %d", k, log.applied[k], want, i)
+			}
+		}
+	}
+	for _, k := range keys {
+		e, err := ib.Get(k + "-0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Status != inbox.StatusProcessed || e.Attempts != 2 {
+			t.Fatalf("%s-0: status = %s, attempts = %d, want processed after 2", k, e.Status, e.Attempts)
+		}
+	}
+}
+
+func TestEventKey(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  string
+		want string
+	}{
+		{"payment intent", `{"id":"pi_1","object":"payment_intent"}`, "pi_1"},
+		{"charge", `{"id":"ch_1","object":"charge","payment_intent":"pi_1"}`, "pi_1"},
+		{"expanded payment intent", `{"id":"re_1","object":"refund","payment_intent":{"id":"pi_1"}}`, "pi_1"},
+		{"no payment intent", `{"id":"cus_1","object":"customer"}`, "evt_1"},
+		{"null payment intent", `{"id":"ch_1","object":"charge","payment_intent":null}`, "evt_1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := stripe.Event{ID: "evt_1", Data: &stripe.EventData{Raw: json.RawMessage(tt.obj)}}
+			if got := eventKey(e); got != tt.want {
+				t.Fatalf("eventKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if got := eventKey(stripe.Event{ID: "evt_1"}); got != "evt_1" {
+		t.Fatalf("eventKey without data = %q, want evt_1", got)
+	}
+}
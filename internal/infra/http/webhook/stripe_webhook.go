@@ -1,16 +1,29 @@
 package webhook
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stripe/stripe-go/v76"
+	"github.com/williamkoller/golang-payment-stripe/internal/app/cardtesting"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/dispute"
 	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/risk"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/config"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/inbox"
 	"go.uber.org/zap"
 )
 
+// maxConflictAttempts limita as regravações de um pagamento alterado
+// concorrentemente enquanto o evento era aplicado.
+const maxConflictAttempts = 3
+
 type StripeVerifier interface {
 	VerifyWebhookSignature(payload []byte, sigHeader string) (stripe.Event, error)
 }
@@ -19,14 +32,104 @@ type Repo interface {
 	Update(p *payment.Payment) error
 }
 
+// Disputes sincroniza as disputas recebidas em charge.dispute.*.
+type Disputes interface {
+	Sync(ctx context.Context, snap dispute.Snapshot) (changed bool, err error)
+}
+
+// Cards resolve o cartão de um PaymentIntent confirmado no frontend.
+type Cards interface {
+	Card(ctx context.Context, paymentIntentID, paymentMethodID string) (payment.Card, error)
+}
+
+// CardCheck avalia o cartão confirmado no frontend e devolve a objeção, se
+// houver (ver risk.RuleCheck e velocity.CardCheck).
+type CardCheck interface {
+	Check(in risk.Input) (risk.Reason, bool)
+}
+
+// Attempts recebe o resultado das autorizações concluídas fora da requisição
+// (confirmação no frontend, 3-D Secure) para a detecção de teste de cartões.
+type Attempts interface {
+	Record(ctx context.Context, src cardtesting.Source, currency string, amount int64, declined bool)
+}
+
+// errStale marca eventos anteriores à última mudança do Stripe já aplicada.
+var errStale = errors.New("event older than the payment's last gateway change")
+
+// errSuperseded marca eventos de um PaymentIntent substituído numa
+// reautorização (ex.: o payment_intent.canceled do anterior).
+var errSuperseded = errors.New("payment intent superseded by a reauthorization")
+
+// EventHandler aplica um evento do Stripe ao domínio e devolve o resultado
+// gravado no inbox, com o erro que o explica quando houver.
+type EventHandler func(e stripe.Event, origin payment.Origin) (inbox.Status, error)
+
 type Handler struct {
 	zl *zap.Logger
 	sv StripeVerifier
 	r  Repo
+	ds Disputes
+	cs Cards
+	cc []CardCheck
+	ga Attempts
+	ib inbox.Store
+
+	handlers map[stripe.EventType]EventHandler
+
+	mu       sync.Mutex
+	unknown  map[stripe.EventType]int64 // eventos recebidos sem handler, por tipo
+	inflight map[string]bool            // chaves com evento em processamento
+
+	workers     int
+	interval    time.Duration
+	batch       int
+	maxAttempts int
+	backoff     time.Duration
+	wake        chan struct{}
+}
+
+// NewStripeWebhook grava todo evento verificado em ib e responde ao Stripe;
+// o processamento é feito pelos workers de Run. Reentregas de eventos já
+// gravados não são processadas de novo.
+func NewStripeWebhook(zl *zap.Logger, sv StripeVerifier, r Repo, ds Disputes, cs Cards, cc []CardCheck, ga Attempts, ib inbox.Store, cfg *config.Config) *Handler {
+	h := &Handler{
+		zl:          zl,
+		sv:          sv,
+		r:           r,
+		ds:          ds,
+		cs:          cs,
+		cc:          cc,
+		ga:          ga,
+		ib:          ib,
+		handlers:    make(map[stripe.EventType]EventHandler),
+		unknown:     make(map[stripe.EventType]int64),
+		inflight:    make(map[string]bool),
+		workers:     max(cfg.StripeWebhookWorkers, 1),
+		interval:    cfg.StripeWebhookPollInterval,
+		batch:       cfg.StripeWebhookBatchSize,
+		maxAttempts: cfg.StripeWebhookMaxAttempts,
+		backoff:     cfg.StripeWebhookRetryBackoff,
+		wake:        make(chan struct{}, 1),
+	}
+	h.registerDefaults()
+	return h
 }
 
-func NewStripeWebhook(zl *zap.Logger, sv StripeVerifier, r Repo) *Handler {
-	return &Handler{zl: zl, sv: sv, r: r}
+// Register associa o tipo de evento t a fn, substituindo o handler anterior.
+func (h *Handler) Register(t stripe.EventType, fn EventHandler) {
+	h.handlers[t] = fn
+}
+
+// UnknownEvents devolve quantos eventos de cada tipo sem handler foram recebidos.
+func (h *Handler) UnknownEvents() map[stripe.EventType]int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make(map[stripe.EventType]int64, len(h.unknown))
+	for t, n := range h.unknown {
+		out[t] = n
+	}
+	return out
 }
 
 func (h *Handler) Handle(c *gin.Context) {
@@ -42,36 +145,105 @@ func (h *Handler) Handle(c *gin.Context) {
 		return
 	}
 
-	switch event.Type {
-	case "payment_intent.requires_capture":
-		var pi stripe.PaymentIntent
-		if json.Unmarshal(event.Data.Raw, &pi) == nil {
-			if p, err := h.r.GetByPaymentIntent(pi.ID); err == nil {
-				_ = p.MarkAuthorized(pi.ID, pi.ClientSecret)
-				_ = h.r.Update(p)
-			}
+	_, isNew, err := h.ib.Begin(inbox.Event{
+		ID:         event.ID,
+		Key:        eventKey(event),
+		Type:       string(event.Type),
+		Created:    time.Unix(event.Created, 0).UTC(),
+		Payload:    body,
+		RequestID:  payment.OriginFrom(c.Request.Context()).RequestID,
+		ReceivedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		// sem registro no inbox o Stripe precisa reenviar
+		h.zl.Error("webhook_inbox_failed", zap.String("event_id", event.ID), zap.String("err", err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !isNew {
+		h.zl.Info("webhook_event_duplicate", zap.String("event_id", event.ID))
+		c.JSON(http.StatusOK, gin.H{"received": true, "duplicate": true})
+		return
+	}
+	h.notify()
+
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
+
+func (h *Handler) process(e stripe.Event, origin payment.Origin) (inbox.Status, error) {
+	fn, ok := h.handlers[e.Type]
+	if !ok {
+		h.countUnknown(e)
+		return inbox.StatusUnhandled, nil
+	}
+	return fn(e, origin)
+}
+
+// GET /v1/webhooks/stripe/unknown-events -> contagem de eventos sem handler
+func (h *Handler) ListUnknown(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"events": h.UnknownEvents()})
+}
+
+func (h *Handler) countUnknown(e stripe.Event) {
+	h.mu.Lock()
+	h.unknown[e.Type]++
+	n := h.unknown[e.Type]
+	h.mu.Unlock()
+	h.zl.Info("webhook_event_unhandled",
+		zap.String("event_id", e.ID),
+		zap.String("type", string(e.Type)),
+		zap.Int64("count", n))
+}
+
+// apply carrega o pagamento do PaymentIntent e grava a transição de mutate.
+// Eventos mais antigos que a última mudança do Stripe no pagamento ou de um
+// PaymentIntent que não é mais o vigente são ignorados. Em conflito de versão (saga ou outro webhook gravou antes)
+// recarrega e reaplica; mutate não faz nada se o pagamento já estiver no
+// estado do evento.
+func (h *Handler) apply(piID string, origin payment.Origin, mutate func(p *payment.Payment) error) (inbox.Status, error) {
+	return h.update(piID, origin, true, mutate)
+}
+
+// applyUnordered é apply sem a guarda de eventos antigos, para eventos que
+// não mudam o status e são idempotentes por um ID próprio (refunds, pelo ID
+// do Stripe). A entrega não segue o created do Stripe: um refund anterior
+// pode chegar depois de um evento mais novo do mesmo PaymentIntent e ainda
+// precisa ser registrado.
+func (h *Handler) applyUnordered(piID string, origin payment.Origin, mutate func(p *payment.Payment) error) (inbox.Status, error) {
+	return h.update(piID, origin, false, mutate)
+}
+
+func (h *Handler) update(piID string, origin payment.Origin, ordered bool, mutate func(p *payment.Payment) error) (inbox.Status, error) {
+	for attempt := 1; ; attempt++ {
+		p, err := h.r.GetByPaymentIntent(piID)
+		if err != nil {
+			return inbox.StatusFailed, fmt.Errorf("payment for %s: %w", piID, err)
+		}
+		if p.StripePaymentIntentID != piID {
+			return inbox.StatusIgnored, errSuperseded
 		}
-	case "payment_intent.succeeded":
-		var pi stripe.PaymentIntent
-		if json.Unmarshal(event.Data.Raw, &pi) == nil {
-			if p, err := h.r.GetByPaymentIntent(pi.ID); err == nil {
-				_ = p.MarkCaptured()
-				_ = h.r.Update(p)
-			}
+		if ordered && p.Stale(origin.GatewayEventAt) {
+			return inbox.StatusIgnored, errStale
 		}
-	case "payment_intent.canceled":
-		var pi stripe.PaymentIntent
-		if json.Unmarshal(event.Data.Raw, &pi) == nil {
-			if p, err := h.r.GetByPaymentIntent(pi.ID); err == nil {
-				_ = p.MarkCanceled()
-				_ = h.r.Update(p)
-			}
+		p.SetOrigin(origin)
+		if err := mutate(p); err != nil {
+			return inbox.StatusRejected, err
 		}
-	default:
-		// ignore outros tipos
+		if len(p.PendingEvents()) == 0 {
+			return inbox.StatusIgnored, nil
+		}
+		err = h.r.Update(p)
+		if err == nil {
+			return inbox.StatusProcessed, nil
+		}
+		if !errors.Is(err, payment.ErrConflict) || attempt == maxConflictAttempts {
+			return inbox.StatusFailed, err
+		}
+		h.zl.Warn("webhook_payment_conflict",
+			zap.String("payment_id", p.ID),
+			zap.String("pi", piID),
+			zap.Int("attempt", attempt))
 	}
-
-	c.JSON(http.StatusOK, gin.H{"received": true})
 }
 
 func (h *Handler) HandleTest(c *gin.Context) {
@@ -0,0 +1,119 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("idempotency key not found")
+
+type Status string
+
+const (
+	StatusInProgress Status = "in_progress"
+	StatusCompleted  Status = "completed"
+	// StatusInterrupted marca uma requisição que criou um recurso e terminou
+	// num erro ambíguo do gateway; a próxima tentativa retoma o recurso.
+	StatusInterrupted Status = "interrupted"
+)
+
+// Record guarda a primeira requisição feita com uma Idempotency-Key e, depois
+// de concluída, a resposta devolvida a ela.
+type Record struct {
+	Key          string
+	Fingerprint  string // hash de método, path e corpo da requisição
+	Status       Status
+	ResponseCode int
+	ResponseBody []byte
+	ContentType  string
+	ResourceID   string // recurso criado pela requisição (ver Attach)
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+type Store interface {
+	// Begin grava rec como em andamento se a chave ainda não existe (ou
+	// expirou) e devolve (rec, true). Uma chave interrompida com o mesmo
+	// fingerprint volta a ficar em andamento e é devolvida, com o ResourceID,
+	// e true. Nos demais casos devolve o registro armazenado e false.
+	Begin(rec Record) (Record, bool, error)
+	// Complete grava a resposta da requisição em andamento.
+	Complete(key string, code int, contentType string, body []byte) error
+	// Release apaga a chave para que a requisição possa ser refeita.
+	Release(key string) error
+	// Attach associa à chave em andamento o recurso criado pela requisição.
+	Attach(key, resourceID string) error
+	// Interrupt marca a chave como interrompida, mantendo o ResourceID.
+	Interrupt(key string) error
+}
+
+type keyCtx struct{}
+
+// call é a requisição em andamento com uma Idempotency-Key.
+type call struct {
+	store    Store
+	key      string
+	resource string
+}
+
+// WithKey grava no contexto a Idempotency-Key da requisição, usada para
+// derivar as chaves de idempotência enviadas ao Stripe.
+func WithKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, keyCtx{}, &call{key: key})
+}
+
+// WithCall grava no contexto a requisição de rec, em andamento em store: a
+// chave, o recurso de uma tentativa interrompida e o store usado por Attach.
+func WithCall(ctx context.Context, store Store, rec Record) context.Context {
+	return context.WithValue(ctx, keyCtx{}, &call{store: store, key: rec.Key, resource: rec.ResourceID})
+}
+
+// KeyFrom devolve a Idempotency-Key gravada no contexto, ou "".
+func KeyFrom(ctx context.Context) string {
+	if c, ok := ctx.Value(keyCtx{}).(*call); ok {
+		return c.key
+	}
+	return ""
+}
+
+// ResourceFrom devolve o recurso associado à Idempotency-Key da requisição,
+// por esta ou por uma tentativa anterior interrompida; "" se não houver.
+func ResourceFrom(ctx context.Context) string {
+	if c, ok := ctx.Value(keyCtx{}).(*call); ok {
+		return c.resource
+	}
+	return ""
+}
+
+// Attach associa id à Idempotency-Key da requisição. Deve ser chamado depois
+// de gravar o recurso e antes de chamar o gateway: se a resposta do gateway
+// for ambígua, a nova tentativa com a mesma chave retoma id em vez de criar
+// outro recurso. Sem Idempotency-Key não faz nada.
+func Attach(ctx context.Context, id string) error {
+	c, ok := ctx.Value(keyCtx{}).(*call)
+	if !ok || c.store == nil {
+		return nil
+	}
+	if err := c.store.Attach(c.key, id); err != nil {
+		return err
+	}
+	c.resource = id
+	return nil
+}
+
+type operationCtx struct{}
+
+// WithOperation grava no contexto um ID gerado pelo servidor para a chamada
+// sem Idempotency-Key. As novas tentativas internas da mesma chamada (por
+// conflito de versão) reaproveitam o ID; chamadas diferentes nunca o
+// compartilham.
+func WithOperation(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, operationCtx{}, id)
+}
+
+// OperationFrom devolve o ID gravado por WithOperation, ou "".
+func OperationFrom(ctx context.Context) string {
+	id, _ := ctx.Value(operationCtx{}).(string)
+	return id
+}
@@ -0,0 +1,89 @@
+package idempotency
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore descarta as chaves expiradas no máximo uma vez por minuto,
+// durante Begin.
+type MemoryStore struct {
+	mu        sync.Mutex
+	recs      map[string]Record
+	lastPurge time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{recs: make(map[string]Record)}
+}
+
+func (s *MemoryStore) Begin(rec Record) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastPurge) >= time.Minute {
+		s.purge(now)
+	}
+	if cur, ok := s.recs[rec.Key]; ok && now.Before(cur.ExpiresAt) {
+		if cur.Status != StatusInterrupted || cur.Fingerprint != rec.Fingerprint {
+			return cur, false, nil
+		}
+		cur.Status = StatusInProgress
+		s.recs[rec.Key] = cur
+		return cur, true, nil
+	}
+	rec.Status = StatusInProgress
+	s.recs[rec.Key] = rec
+	return rec, true, nil
+}
+
+func (s *MemoryStore) Complete(key string, code int, contentType string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.recs[key]
+	if !ok {
+		return ErrNotFound
+	}
+	rec.Status = StatusCompleted
+	rec.ResponseCode = code
+	rec.ContentType = contentType
+	rec.ResponseBody = append([]byte(nil), body...)
+	s.recs[key] = rec
+	return nil
+}
+
+func (s *MemoryStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.recs, key)
+	return nil
+}
+
+func (s *MemoryStore) Attach(key, resourceID string) error {
+	return s.update(key, func(rec *Record) { rec.ResourceID = resourceID })
+}
+
+func (s *MemoryStore) Interrupt(key string) error {
+	return s.update(key, func(rec *Record) { rec.Status = StatusInterrupted })
+}
+
+func (s *MemoryStore) update(key string, fn func(rec *Record)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.recs[key]
+	if !ok {
+		return ErrNotFound
+	}
+	fn(&rec)
+	s.recs[key] = rec
+	return nil
+}
+
+func (s *MemoryStore) purge(now time.Time) {
+	s.lastPurge = now
+	for k, rec := range s.recs {
+		if !now.Before(rec.ExpiresAt) {
+			delete(s.recs, k)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package inbox
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("inbox event not found")
+
+type Status string
+
+const (
+	StatusReceived  Status = "received"  // gravado, aguardando processamento
+	StatusProcessed Status = "processed" // transição aplicada ao pagamento
+	StatusIgnored   Status = "ignored"   // nada a fazer: já aplicado ou mais antigo que o estado
+	StatusRejected  Status = "rejected"  // transição inválida para o estado do pagamento
+	StatusFailed    Status = "failed"    // erro de leitura ou de gravação; nova tentativa agendada
+	StatusUnhandled Status = "unhandled" // tipo de evento sem handler
+	StatusDead      Status = "dead"      // excedeu as tentativas; aguarda operador
+)
+
+// Done indica se o evento já teve um resultado definitivo; received e
+// failed ainda serão processados.
+func (s Status) Done() bool {
+	return s != StatusReceived && s != StatusFailed
+}
+
+// Event é um evento do Stripe já verificado, guardado pelo ID para
+// deduplicar as entregas (at-least-once) e registrar o resultado.
+type Event struct {
+	ID            string          `json:"id"`  // ID do evento no Stripe (evt_...)
+	Key           string          `json:"key"` // PaymentIntent do evento; define a ordem de processamento
+	Type          string          `json:"type"`
+	Created       time.Time       `json:"created"` // created do evento no Stripe
+	Payload       json.RawMessage `json:"payload"`
+	RequestID     string          `json:"request_id,omitempty"`
+	Status        Status          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	Error         string          `json:"error,omitempty"`
+	ReceivedAt    time.Time       `json:"received_at"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	ProcessedAt   *time.Time      `json:"processed_at,omitempty"`
+}
+
+type Store interface {
+	// Begin grava e como received se o ID ainda não existe e devolve
+	// (e, true). Se já existe, devolve o evento armazenado e false.
+	Begin(e Event) (Event, bool, error)
+	// Due devolve, em ordem de recebimento, o evento pendente (received ou
+	// failed) mais antigo de cada chave cujo horário de tentativa já chegou.
+	Due(now time.Time, limit int) ([]Event, error)
+	// Finish registra o resultado definitivo da tentativa attempts.
+	Finish(id string, st Status, attempts int, errMsg string) error
+	// Retry marca a tentativa attempts como failed e agenda a próxima para next.
+	Retry(id string, attempts int, next time.Time, errMsg string) error
+	// Requeue devolve um evento já concluído (inclusive dead) para processamento.
+	Requeue(id string) error
+	Get(id string) (Event, error)
+	// List devolve os eventos mais recentes primeiro; st vazio não filtra.
+	List(st Status, limit int) ([]Event, error)
+}
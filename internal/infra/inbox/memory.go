@@ -0,0 +1,130 @@
+package inbox
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+type MemoryStore struct {
+	mu      sync.Mutex
+	evts    map[string]Event
+	order   []string // IDs em ordem de recebimento
+	pending []string // IDs ainda não concluídos, na ordem em que entraram na fila
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{evts: make(map[string]Event)}
+}
+
+func (s *MemoryStore) Begin(e Event) (Event, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cur, ok := s.evts[e.ID]; ok {
+		return cur, false, nil
+	}
+	e.Status = StatusReceived
+	e.NextAttemptAt = e.ReceivedAt
+	s.evts[e.ID] = e
+	s.order = append(s.order, e.ID)
+	s.pending = append(s.pending, e.ID)
+	return e, true, nil
+}
+
+func (s *MemoryStore) Due(now time.Time, limit int) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := make(map[string]bool)
+	out := make([]Event, 0, limit)
+	for _, id := range s.pending {
+		if len(out) == limit {
+			break
+		}
+		e := s.evts[id]
+		if seen[e.Key] {
+			continue
+		}
+		seen[e.Key] = true
+		if e.NextAttemptAt.After(now) {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) Finish(id string, st Status, attempts int, errMsg string) error {
+	err := s.update(id, func(e *Event) {
+		now := time.Now().UTC()
+		e.Status = st
+		e.Attempts = attempts
+		e.Error = errMsg
+		e.ProcessedAt = &now
+	})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = slices.DeleteFunc(s.pending, func(p string) bool { return p == id })
+	return nil
+}
+
+func (s *MemoryStore) Retry(id string, attempts int, next time.Time, errMsg string) error {
+	return s.update(id, func(e *Event) {
+		e.Status = StatusFailed
+		e.Attempts = attempts
+		e.Error = errMsg
+		e.NextAttemptAt = next
+	})
+}
+
+func (s *MemoryStore) Requeue(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.evts[id]
+	if !ok || !e.Status.Done() {
+		return ErrNotFound
+	}
+	e.Status = StatusReceived
+	e.Attempts = 0
+	e.NextAttemptAt = time.Now().UTC()
+	e.ProcessedAt = nil
+	s.evts[id] = e
+	s.pending = append(s.pending, id)
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.evts[id]
+	if !ok {
+		return Event{}, ErrNotFound
+	}
+	return e, nil
+}
+
+func (s *MemoryStore) List(st Status, limit int) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Event{}
+	for i := len(s.order) - 1; i >= 0 && len(out) < limit; i-- {
+		if e := s.evts[s.order[i]]; st == "" || e.Status == st {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) update(id string, fn func(e *Event)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.evts[id]
+	if !ok {
+		return ErrNotFound
+	}
+	fn(&e)
+	s.evts[id] = e
+	return nil
+}
@@ -0,0 +1,220 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/notification"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/config"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/outbox"
+	"github.com/williamkoller/golang-payment-stripe/pkg/ulidx"
+	"go.uber.org/zap"
+)
+
+const SignatureHeader = "X-Signature"
+
+// envelope é o corpo enviado aos endpoints inscritos.
+type envelope struct {
+	ID        string        `json:"id"`
+	Type      string        `json:"type"`
+	CreatedAt time.Time     `json:"created_at"`
+	Data      payment.Event `json:"data"`
+}
+
+// Dispatcher implementa ports.EventPublisher: para cada evento publicado pelo
+// outbox agenda uma entrega por endpoint inscrito. Run envia as entregas
+// pendentes e reagenda falhas com backoff exponencial.
+type Dispatcher struct {
+	zl          *zap.Logger
+	repo        notification.Repository
+	client      *http.Client
+	interval    time.Duration
+	maxAttempts int
+	backoff     time.Duration
+
+	inflight sync.Map
+}
+
+func NewDispatcher(zl *zap.Logger, repo notification.Repository, client *http.Client, cfg *config.Config) *Dispatcher {
+	return &Dispatcher{
+		zl:          zl,
+		repo:        repo,
+		client:      client,
+		interval:    cfg.MerchantWebhookPollInterval,
+		maxAttempts: cfg.MerchantWebhookMaxAttempts,
+		backoff:     cfg.MerchantWebhookRetryBackoff,
+	}
+}
+
+func (d *Dispatcher) Publish(ctx context.Context, topic string, payload any) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	var evt payment.Event
+	if err := json.Unmarshal(raw, &evt); err != nil || evt.ID == "" {
+		return fmt.Errorf("notifier: unsupported payload for topic %s", topic)
+	}
+	body, err := json.Marshal(envelope{ID: evt.ID, Type: topic, CreatedAt: evt.OccurredAt, Data: evt})
+	if err != nil {
+		return err
+	}
+
+	eps, err := d.repo.ListEndpoints()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, ep := range eps {
+		if !ep.Matches(topic) {
+			continue
+		}
+		del := &notification.Delivery{
+			ID:            ulidx.New(),
+			EndpointID:    ep.ID,
+			EventID:       evt.ID,
+			EventType:     topic,
+			Payload:       body,
+			Status:        notification.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		// o outbox é at-least-once: o mesmo evento pode chegar de novo
+		if err := d.repo.CreateDelivery(del); err != nil && !errors.Is(err, notification.ErrDuplicateDelivery) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Dispatcher) Run(ctx context.Context) {
+	t := time.NewTicker(d.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			d.flush(ctx)
+		}
+	}
+}
+
+func (d *Dispatcher) flush(ctx context.Context) {
+	due, err := d.repo.DueDeliveries(time.Now().UTC(), 100)
+	if err != nil {
+		d.zl.Error("merchant_webhook_due_failed", zap.String("err", err.Error()))
+		return
+	}
+	for _, del := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := d.deliver(ctx, del, false); err != nil {
+			d.zl.Error("merchant_webhook_deliver_failed", zap.String("delivery_id", del.ID), zap.String("err", err.Error()))
+		}
+	}
+}
+
+// Redeliver reenvia uma entrega imediatamente, independente do status.
+func (d *Dispatcher) Redeliver(ctx context.Context, id string) (*notification.Delivery, error) {
+	del, err := d.repo.GetDelivery(id)
+	if err != nil {
+		return nil, err
+	}
+	return d.deliver(ctx, del, true)
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, del *notification.Delivery, manual bool) (*notification.Delivery, error) {
+	if _, busy := d.inflight.LoadOrStore(del.ID, struct{}{}); busy {
+		return nil, errors.New("delivery in progress")
+	}
+	defer d.inflight.Delete(del.ID)
+
+	ep, err := d.repo.GetEndpoint(del.EndpointID)
+	if err != nil {
+		return nil, err
+	}
+
+	a := d.send(ctx, ep, del)
+	a.Manual = manual
+
+	var next time.Time
+	if n := del.AutoAttempts(); !manual {
+		n++
+		if n < d.maxAttempts {
+			next = a.At.Add(outbox.Backoff(d.backoff, n))
+		}
+	} else if del.Status == notification.DeliveryPending {
+		// reenvio manual não consome o agendamento automático
+		next = del.NextAttemptAt
+	}
+	del.Record(a, next)
+
+	if del.Status != notification.DeliverySucceeded {
+		d.zl.Warn("merchant_webhook_attempt_failed",
+			zap.String("delivery_id", del.ID),
+			zap.String("endpoint_id", ep.ID),
+			zap.Int("status_code", a.StatusCode),
+			zap.String("err", a.Error),
+			zap.String("status", string(del.Status)))
+	}
+	if err := d.repo.UpdateDelivery(del); err != nil {
+		return nil, err
+	}
+	return del, nil
+}
+
+func (d *Dispatcher) send(ctx context.Context, ep *notification.Endpoint, del *notification.Delivery) notification.Attempt {
+	start := time.Now().UTC()
+	a := notification.Attempt{At: start}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(del.Payload))
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	ts := strconv.FormatInt(start.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "golang-payment-stripe-webhooks/1.0")
+	req.Header.Set("X-Webhook-ID", del.ID)
+	req.Header.Set("X-Event-Type", del.EventType)
+	req.Header.Set(SignatureHeader, "t="+ts+",v1="+Sign(ep.Secret, ts, del.Payload))
+
+	res, err := d.client.Do(req)
+	a.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	a.StatusCode = res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		a.Error = fmt.Sprintf("unexpected status %d", res.StatusCode)
+	}
+	return a
+}
+
+// Sign calcula o HMAC-SHA256 (hex) de "<timestamp>.<corpo>", no mesmo esquema
+// do Stripe-Signature. O receptor deve recalcular e rejeitar timestamps antigos.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,186 @@
+package notifier
+
+import (
+	"context"
+	"crypto/hmac"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/notification"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/repo/memory"
+	"go.uber.org/zap"
+)
+
+// receiver é um endpoint de teste que responde com os status de statuses,
+// em ordem (o último se repete), e guarda as requisições recebidas.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	reqs     []received
+}
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.reqs = append(rc.reqs, received{header: r.Header.Clone(), body: body})
+	status := rc.statuses[min(len(rc.reqs), len(rc.statuses))-1]
+	w.WriteHeader(status)
+}
+
+func newDispatcher(t *testing.T, statuses ...int) (*Dispatcher, *memory.NotificationRepo, *receiver) {
+	t.Helper()
+	rc := &receiver{statuses: statuses}
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+
+	repo := memory.NewNotificationRepo()
+	ep, err := notification.NewEndpoint("ep_1", srv.URL, "whsec_test", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateEndpoint(ep); err != nil {
+		t.Fatal(err)
+	}
+	d := &Dispatcher{
+		zl:          zap.NewNop(),
+		repo:        repo,
+		client:      srv.Client(),
+		interval:    time.Millisecond,
+		maxAttempts: 3,
+		backoff:     time.Millisecond,
+	}
+	return d, repo, rc
+}
+
+func publish(t *testing.T, d *Dispatcher) {
+	t.Helper()
+	evt := payment.Event{ID: "evt_1", Type: payment.EvtPaymentCreated, PaymentID: "pay_1", Seq: 1, OccurredAt: time.Now().UTC()}
+	if err := d.Publish(context.Background(), string(evt.Type), evt); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// flushUntil roda flush até a entrega sair de pending ou o prazo acabar,
+// respeitando o backoff entre tentativas.
+func flushUntil(t *testing.T, d *Dispatcher, repo *memory.NotificationRepo) *notification.Delivery {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		d.flush(context.Background())
+		dels, err := repo.ListDeliveries("ep_1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(dels) != 1 {
+			t.Fatalf("deliveries = %d, want 1", len(dels))
+		}
+		if dels[0].Status != notification.DeliveryPending || time.Now().After(deadline) {
+			return dels[0]
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDispatcherSignsPayload(t *testing.T) {
+	d, repo, rc := newDispatcher(t, http.StatusOK)
+	publish(t, d)
+
+	del := flushUntil(t, d, repo)
+	if del.Status != notification.DeliverySucceeded {
+		t.Fatalf("status = %s, want %s", del.Status, notification.DeliverySucceeded)
+	}
+	if len(rc.reqs) != 1 {
+		t.Fatalf("requests = %d, want 1", len(rc.reqs))
+	}
+	req := rc.reqs[0]
+
+	var ts, sig string
+	for _, part := range strings.Split(req.header.Get(SignatureHeader), ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	if ts == "" || sig == "" {
+		t.Fatalf("malformed %s header: %q", SignatureHeader, req.header.Get(SignatureHeader))
+	}
+	if want := Sign("whsec_test", ts, req.body); !hmac.Equal([]byte(sig), []byte(want)) {
+		t.Fatalf("signature = %s, want %s", sig, want)
+	}
+	if Sign("other_secret", ts, req.body) == sig {
+		t.Fatal("signature must depend on the endpoint secret")
+	}
+	if got := req.header.Get("X-Webhook-ID"); got != del.ID {
+		t.Fatalf("X-Webhook-ID = %q, want %q", got, del.ID)
+	}
+	if got := req.header.Get("X-Event-Type"); got != string(payment.EvtPaymentCreated) {
+		t.Fatalf("X-Event-Type = %q", got)
+	}
+}
+
+func TestDispatcherRetriesUntilSuccess(t *testing.T) {
+	d, repo, rc := newDispatcher(t, http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusOK)
+	publish(t, d)
+
+	del := flushUntil(t, d, repo)
+	if del.Status != notification.DeliverySucceeded {
+		t.Fatalf("status = %s, want %s", del.Status, notification.DeliverySucceeded)
+	}
+	if len(del.Attempts) != 3 || len(rc.reqs) != 3 {
+		t.Fatalf("attempts = %d, requests = %d, want 3", len(del.Attempts), len(rc.reqs))
+	}
+	if del.Attempts[0].StatusCode != http.StatusInternalServerError || del.Attempts[0].Error == "" {
+		t.Fatalf("first attempt = %+v, want a recorded 500", del.Attempts[0])
+	}
+	// todas as tentativas reenviam o mesmo corpo
+	for _, r := range rc.reqs[1:] {
+		if string(r.body) != string(rc.reqs[0].body) {
+			t.Fatal("retry sent a different payload")
+		}
+	}
+}
+
+func TestDispatcherGivesUpAfterMaxAttempts(t *testing.T) {
+	d, repo, rc := newDispatcher(t, http.StatusInternalServerError)
+	publish(t, d)
+
+	del := flushUntil(t, d, repo)
+	if del.Status != notification.DeliveryFailed {
+		t.Fatalf("status = %s, want %s", del.Status, notification.DeliveryFailed)
+	}
+	if len(rc.reqs) != d.maxAttempts {
+		t.Fatalf("requests = %d, want %d", len(rc.reqs), d.maxAttempts)
+	}
+	if !del.NextAttemptAt.IsZero() {
+		t.Fatalf("next attempt = %s, want none", del.NextAttemptAt)
+	}
+}
+
+func TestDispatcherPublishIsIdempotentPerEvent(t *testing.T) {
+	d, repo, _ := newDispatcher(t, http.StatusOK)
+	publish(t, d)
+	publish(t, d) // o outbox pode reentregar o mesmo evento
+
+	dels, err := repo.ListDeliveries("ep_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dels) != 1 {
+		t.Fatalf("deliveries = %d, want 1", len(dels))
+	}
+}
@@ -0,0 +1,146 @@
+package outbox
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore mantém as mensagens pendentes em ordem de inserção; as
+// entregues são descartadas e as mortas ficam na dead-letter.
+type MemoryStore struct {
+	mu      sync.Mutex
+	pending []*Message
+	byID    map[string]*Message
+	dead    map[string]*Message
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		byID: make(map[string]*Message),
+		dead: make(map[string]*Message),
+	}
+}
+
+func (s *MemoryStore) Add(msgs ...Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range msgs {
+		if _, ok := s.byID[m.ID]; ok {
+			continue
+		}
+		if _, ok := s.dead[m.ID]; ok {
+			continue
+		}
+		cp := m
+		s.pending = append(s.pending, &cp)
+		s.byID[m.ID] = &cp
+	}
+	return nil
+}
+
+func (s *MemoryStore) Due(now time.Time, limit int) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := make(map[string]bool)
+	out := make([]Message, 0, limit)
+	for _, m := range s.pending {
+		if len(out) == limit {
+			break
+		}
+		if seen[m.Key] {
+			continue
+		}
+		seen[m.Key] = true
+		if m.NextAttemptAt.After(now) {
+			continue
+		}
+		out = append(out, *m)
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) MarkDelivered(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byID[id]; !ok {
+		return errors.New("not found")
+	}
+	s.remove(id)
+	return nil
+}
+
+func (s *MemoryStore) MarkRetry(id string, attempts int, next time.Time, lastErr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.byID[id]
+	if !ok {
+		return errors.New("not found")
+	}
+	m.Attempts = attempts
+	m.NextAttemptAt = next
+	m.LastError = lastErr
+	return nil
+}
+
+func (s *MemoryStore) MarkDead(id string, attempts int, lastErr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.byID[id]
+	if !ok {
+		return errors.New("not found")
+	}
+	m.Status = StatusDead
+	m.Attempts = attempts
+	m.LastError = lastErr
+	s.remove(id)
+	s.dead[id] = m
+	return nil
+}
+
+func (s *MemoryStore) DeadLetters() ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Message, 0, len(s.dead))
+	for _, m := range s.dead {
+		out = append(out, *m)
+	}
+	sortByCreatedAt(out)
+	return out, nil
+}
+
+func (s *MemoryStore) Requeue(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.dead[id]
+	if !ok {
+		return errors.New("not found")
+	}
+	delete(s.dead, id)
+	m.Status = StatusPending
+	m.Attempts = 0
+	m.NextAttemptAt = time.Now().UTC()
+	// volta para a posição original da chave para não furar a ordem
+	i := 0
+	for i < len(s.pending) && !s.pending[i].CreatedAt.After(m.CreatedAt) {
+		i++
+	}
+	s.pending = append(s.pending[:i], append([]*Message{m}, s.pending[i:]...)...)
+	s.byID[id] = m
+	return nil
+}
+
+func (s *MemoryStore) remove(id string) {
+	delete(s.byID, id)
+	for i, m := range s.pending {
+		if m.ID == id {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+func sortByCreatedAt(msgs []Message) {
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].CreatedAt.Before(msgs[j].CreatedAt) })
+}
@@ -0,0 +1,66 @@
+package outbox
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusDelivered Status = "delivered"
+	StatusDead      Status = "dead" // excedeu as tentativas; aguarda operador
+)
+
+type Message struct {
+	ID            string          `json:"id"` // ID do evento de domínio
+	Topic         string          `json:"topic"`
+	Key           string          `json:"key"` // ID do pagamento; define a ordem de entrega
+	Payload       json.RawMessage `json:"payload"`
+	Status        Status          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"last_error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+}
+
+// Writer é usado pelos repositórios para gravar mensagens junto da mudança de estado.
+type Writer interface {
+	Add(msgs ...Message) error
+}
+
+type Store interface {
+	Writer
+	// Due devolve, em ordem de criação, a mensagem pendente mais antiga de
+	// cada chave cujo horário de tentativa já chegou.
+	Due(now time.Time, limit int) ([]Message, error)
+	MarkDelivered(id string) error
+	MarkRetry(id string, attempts int, next time.Time, lastErr string) error
+	MarkDead(id string, attempts int, lastErr string) error
+	DeadLetters() ([]Message, error)
+	Requeue(id string) error
+}
+
+// FromEvents converte eventos de domínio em mensagens do outbox.
+func FromEvents(evts []payment.Event) ([]Message, error) {
+	msgs := make([]Message, 0, len(evts))
+	for _, e := range evts {
+		raw, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, Message{
+			ID:            e.ID,
+			Topic:         string(e.Type),
+			Key:           e.PaymentID,
+			Payload:       raw,
+			Status:        StatusPending,
+			CreatedAt:     e.OccurredAt,
+			NextAttemptAt: e.OccurredAt,
+		})
+	}
+	return msgs, nil
+}
@@ -0,0 +1,101 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/app/ports"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/config"
+	"go.uber.org/zap"
+)
+
+// Relay entrega as mensagens do outbox ao EventPublisher com semântica
+// at-least-once: só marca como entregue após Publish retornar sem erro.
+type Relay struct {
+	zl          *zap.Logger
+	store       Store
+	pub         ports.EventPublisher
+	interval    time.Duration
+	batch       int
+	maxAttempts int
+	backoff     time.Duration
+}
+
+func NewRelay(zl *zap.Logger, store Store, pub ports.EventPublisher, cfg *config.Config) *Relay {
+	return &Relay{
+		zl:          zl,
+		store:       store,
+		pub:         pub,
+		interval:    cfg.OutboxPollInterval,
+		batch:       cfg.OutboxBatchSize,
+		maxAttempts: cfg.OutboxMaxAttempts,
+		backoff:     cfg.OutboxRetryBackoff,
+	}
+}
+
+func (r *Relay) Run(ctx context.Context) {
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			r.flush(ctx)
+		}
+	}
+}
+
+func (r *Relay) flush(ctx context.Context) {
+	msgs, err := r.store.Due(time.Now().UTC(), r.batch)
+	if err != nil {
+		r.zl.Error("outbox_due_failed", zap.String("err", err.Error()))
+		return
+	}
+	for _, m := range msgs {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := r.pub.Publish(ctx, m.Topic, m.Payload); err != nil {
+			r.fail(m, err)
+			continue
+		}
+		if err := r.store.MarkDelivered(m.ID); err != nil {
+			r.zl.Error("outbox_mark_delivered_failed", zap.String("id", m.ID), zap.String("err", err.Error()))
+		}
+	}
+}
+
+func (r *Relay) fail(m Message, err error) {
+	attempts := m.Attempts + 1
+	if attempts >= r.maxAttempts {
+		r.zl.Error("outbox_dead_letter",
+			zap.String("id", m.ID),
+			zap.String("topic", m.Topic),
+			zap.Int("attempts", attempts),
+			zap.String("err", err.Error()))
+		_ = r.store.MarkDead(m.ID, attempts, err.Error())
+		return
+	}
+	next := time.Now().UTC().Add(Backoff(r.backoff, attempts))
+	r.zl.Warn("outbox_publish_failed",
+		zap.String("id", m.ID),
+		zap.String("topic", m.Topic),
+		zap.Int("attempts", attempts),
+		zap.Time("next_attempt_at", next),
+		zap.String("err", err.Error()))
+	_ = r.store.MarkRetry(m.ID, attempts, next, err.Error())
+}
+
+// Backoff dobra base a cada tentativa, limitado a 10 minutos.
+func Backoff(base time.Duration, attempts int) time.Duration {
+	const max = 10 * time.Minute
+	d := base
+	for i := 1; i < attempts && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
@@ -0,0 +1,40 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/app/ports"
+	"go.uber.org/zap"
+)
+
+// Log publica eventos no log estruturado; útil como destino padrão.
+type Log struct {
+	zl *zap.Logger
+}
+
+func NewLog(zl *zap.Logger) *Log { return &Log{zl: zl} }
+
+func (l *Log) Publish(ctx context.Context, topic string, payload any) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	l.zl.Info("event_published", zap.String("topic", topic), zap.ByteString("payload", raw))
+	return nil
+}
+
+// Multi repassa cada evento a todos os publishers; falha se algum falhar,
+// fazendo o relay tentar novamente (os destinos devem ser idempotentes).
+type Multi []ports.EventPublisher
+
+func (m Multi) Publish(ctx context.Context, topic string, payload any) error {
+	var errs []error
+	for _, p := range m {
+		if err := p.Publish(ctx, topic, payload); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
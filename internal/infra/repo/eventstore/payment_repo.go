@@ -0,0 +1,240 @@
+package eventstore
+
+import (
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/outbox"
+)
+
+// PaymentRepo persiste pagamentos como streams de eventos. As leituras
+// (Get, GetByPaymentIntent, History, List) são servidas por projeções em
+// memória, reconstruídas do store na criação do repositório e mantidas a
+// cada append. A versão do pagamento é a posição do último evento no stream.
+// Os eventos entram no outbox junto do append (ver Store.Append).
+type PaymentRepo struct {
+	store Store
+
+	mu   sync.RWMutex
+	byID map[string]*payment.Payment
+	byPI map[string]string // inclui PaymentIntents substituídos na reautorização
+	ids  []string          // IDs (ULID) em ordem crescente, para List
+}
+
+// NewPaymentRepo monta as projeções reaplicando os streams já gravados.
+func NewPaymentRepo(store Store) (*PaymentRepo, error) {
+	r := &PaymentRepo{store: store}
+	if err := r.Rebuild(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *PaymentRepo) Create(p *payment.Payment) error {
+	evts := p.PendingEvents()
+	if len(evts) == 0 || evts[0].Seq != 1 {
+		return errors.New("payment has no creation event")
+	}
+	msgs, err := outbox.FromEvents(evts)
+	if err != nil {
+		return err
+	}
+	if err := r.store.Append(p.ID, 0, evts, msgs); err != nil {
+		if errors.Is(err, ErrStreamConflict) {
+			return errors.New("payment already exists")
+		}
+		return err
+	}
+	p.Version = p.EventSeq
+	p.ClearPendingEvents()
+	return r.project(p.ID, evts)
+}
+
+func (r *PaymentRepo) Update(p *payment.Payment) error {
+	r.mu.RLock()
+	cur, ok := r.byID[p.ID]
+	r.mu.RUnlock()
+	if !ok {
+		return errors.New("not found")
+	}
+	if cur.Version != p.Version {
+		return &payment.ConflictError{ID: p.ID, Expected: p.Version, Actual: cur.Version}
+	}
+	evts := p.PendingEvents()
+	if len(evts) == 0 {
+		return nil
+	}
+	msgs, err := outbox.FromEvents(evts)
+	if err != nil {
+		return err
+	}
+	if err := r.store.Append(p.ID, p.Version, evts, msgs); err != nil {
+		if errors.Is(err, ErrStreamConflict) {
+			// outro escritor gravou entre a checagem da projeção e o append:
+			// a projeção é recarregada do stream para a nova tentativa
+			stored, err := r.refresh(p.ID)
+			if err != nil {
+				return err
+			}
+			return &payment.ConflictError{ID: p.ID, Expected: p.Version, Actual: stored.Version}
+		}
+		return err
+	}
+	p.Version = p.EventSeq
+	p.ClearPendingEvents()
+	return r.project(p.ID, evts)
+}
+
+func (r *PaymentRepo) Get(id string) (*payment.Payment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.byID[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return p.Clone(), nil
+}
+
+func (r *PaymentRepo) GetByPaymentIntent(piID string) (*payment.Payment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.byPI[piID]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return r.byID[id].Clone(), nil
+}
+
+// List percorre o índice ordenado de IDs a partir do cursor, parando assim
+// que a página enche.
+func (r *PaymentRepo) List(q payment.Query) (payment.Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return payment.Paginate(r.ids, func(id string) *payment.Payment { return r.byID[id] }, q), nil
+}
+
+func (r *PaymentRepo) History(id string) ([]payment.Transition, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.byID[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return append([]payment.Transition(nil), p.History...), nil
+}
+
+// Load reconstrói o pagamento reaplicando todos os eventos do stream,
+// ignorando a projeção.
+func (r *PaymentRepo) Load(id string) (*payment.Payment, error) {
+	evts, err := r.store.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	p, _, err := replay(evts)
+	return p, err
+}
+
+// Rebuild descarta as projeções e as recria a partir do store.
+func (r *PaymentRepo) Rebuild() error {
+	ids, err := r.store.Streams()
+	if err != nil {
+		return err
+	}
+	slices.Sort(ids)
+	byID := make(map[string]*payment.Payment, len(ids))
+	byPI := make(map[string]string, len(ids))
+	for _, id := range ids {
+		evts, err := r.store.Load(id)
+		if err != nil {
+			return err
+		}
+		p, pis, err := replay(evts)
+		if err != nil {
+			return err
+		}
+		byID[id] = p
+		for _, pi := range pis {
+			byPI[pi] = id
+		}
+	}
+	r.mu.Lock()
+	r.byID, r.byPI, r.ids = byID, byPI, ids
+	r.mu.Unlock()
+	return nil
+}
+
+// refresh troca a projeção de id pelo stream gravado no store.
+func (r *PaymentRepo) refresh(id string) (*payment.Payment, error) {
+	evts, err := r.store.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	p, pis, err := replay(evts)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.byID[id]; !ok {
+		r.ids = insertSorted(r.ids, id)
+	}
+	r.byID[id] = p
+	for _, pi := range pis {
+		r.byPI[pi] = id
+	}
+	return p.Clone(), nil
+}
+
+// replay reaplica o stream evento a evento e devolve também todos os
+// PaymentIntents que o pagamento teve, inclusive os substituídos.
+func replay(evts []payment.Event) (*payment.Payment, []string, error) {
+	if len(evts) == 0 {
+		return nil, nil, errors.New("empty event stream")
+	}
+	p := &payment.Payment{}
+	var pis []string
+	for _, e := range evts {
+		if err := p.Replay(e); err != nil {
+			return nil, nil, err
+		}
+		if pi := p.StripePaymentIntentID; pi != "" && !slices.Contains(pis, pi) {
+			pis = append(pis, pi)
+		}
+	}
+	p.Version = p.EventSeq
+	return p, pis, nil
+}
+
+// project aplica os eventos recém-gravados à projeção do pagamento.
+func (r *PaymentRepo) project(id string, evts []payment.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cur, ok := r.byID[id]
+	if ok {
+		cur = cur.Clone()
+	} else {
+		cur = &payment.Payment{}
+	}
+	if err := cur.Replay(evts...); err != nil {
+		return err
+	}
+	cur.Version = cur.EventSeq
+	if cur.StripePaymentIntentID != "" {
+		r.byPI[cur.StripePaymentIntentID] = id
+	}
+	if !ok {
+		r.ids = insertSorted(r.ids, id)
+	}
+	r.byID[id] = cur
+	return nil
+}
+
+func insertSorted(ids []string, id string) []string {
+	i, found := slices.BinarySearch(ids, id)
+	if found {
+		return ids
+	}
+	return slices.Insert(ids, i, id)
+}
@@ -0,0 +1,54 @@
+package eventstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/outbox"
+)
+
+func TestUpdateRefreshesStaleProjection(t *testing.T) {
+	store := NewMemoryStore(outbox.NewMemoryStore())
+	a, err := NewPaymentRepo(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := payment.New("pay_1", payment.Money{Amount: 5000, Currency: "brl"}, "buyer@example.com",
+		payment.Details{}, payment.Origin{Source: payment.SourceAPI})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Create(p); err != nil {
+		t.Fatal(err)
+	}
+
+	// b é outra instância sobre o mesmo store; a grava depois dela carregar
+	b, err := NewPaymentRepo(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale, _ := b.Get("pay_1")
+	if err := p.MarkAuthorized("pi_1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Update(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stale.MarkAuthorized("pi_1"); err != nil {
+		t.Fatal(err)
+	}
+	var conflict *payment.ConflictError
+	if err := b.Update(stale); !errors.As(err, &conflict) || conflict.Actual != p.Version {
+		t.Fatalf("err = %v, want a conflict at version %d", err, p.Version)
+	}
+	// depois do conflito a projeção de b reflete o stream
+	cur, err := b.Get("pay_1")
+	if err != nil || cur.Status != payment.StatusAuthorized || cur.Version != p.Version {
+		t.Fatalf("b.Get = %+v, %v, want the authorized payment at version %d", cur, err, p.Version)
+	}
+	if got, err := b.GetByPaymentIntent("pi_1"); err != nil || got.ID != "pay_1" {
+		t.Fatalf("b.GetByPaymentIntent = %v, %v", got, err)
+	}
+}
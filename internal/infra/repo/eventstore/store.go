@@ -0,0 +1,71 @@
+package eventstore
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/outbox"
+)
+
+var ErrStreamConflict = errors.New("event stream version conflict")
+
+// Store guarda os streams de eventos, um por pagamento (append-only). Há a
+// implementação em memória e a SQL (sqlrepo.EventStore).
+type Store interface {
+	// Append só grava se a última posição do stream for expectedSeq, e grava
+	// msgs no outbox na mesma seção crítica (ou transação): ou os dois são
+	// gravados, ou nenhum.
+	Append(streamID string, expectedSeq int64, evts []payment.Event, msgs []outbox.Message) error
+	Load(streamID string) ([]payment.Event, error)
+	Streams() ([]string, error)
+}
+
+type MemoryStore struct {
+	ob outbox.Writer
+
+	mu      sync.RWMutex
+	streams map[string][]payment.Event
+}
+
+func NewMemoryStore(ob outbox.Writer) *MemoryStore {
+	return &MemoryStore{ob: ob, streams: make(map[string][]payment.Event)}
+}
+
+func (s *MemoryStore) Append(streamID string, expectedSeq int64, evts []payment.Event, msgs []outbox.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur := s.streams[streamID]
+	if int64(len(cur)) != expectedSeq {
+		return ErrStreamConflict
+	}
+	if len(msgs) > 0 {
+		if err := s.ob.Add(msgs...); err != nil {
+			return err
+		}
+	}
+	s.streams[streamID] = append(cur, evts...)
+	return nil
+}
+
+func (s *MemoryStore) Load(streamID string) ([]payment.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	evts, ok := s.streams[streamID]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return append([]payment.Event(nil), evts...), nil
+}
+
+func (s *MemoryStore) Streams() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.streams))
+	for id := range s.streams {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
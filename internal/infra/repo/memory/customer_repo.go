@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/customer"
+)
+
+type CustomerRepo struct {
+	mu      sync.RWMutex
+	byID    map[string]*customer.Customer
+	byEmail map[string]string
+}
+
+func NewCustomerRepo() *CustomerRepo {
+	return &CustomerRepo{
+		byID:    make(map[string]*customer.Customer),
+		byEmail: make(map[string]string),
+	}
+}
+
+func (r *CustomerRepo) Create(c *customer.Customer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.byID[c.ID]; ok {
+		return customer.ErrCustomerExists
+	}
+	if _, ok := r.byEmail[c.Email]; ok {
+		return customer.ErrEmailInUse
+	}
+	r.byID[c.ID] = c.Clone()
+	r.byEmail[c.Email] = c.ID
+	return nil
+}
+
+func (r *CustomerRepo) Get(id string) (*customer.Customer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.byID[id]
+	if !ok {
+		return nil, customer.ErrNotFound
+	}
+	return c.Clone(), nil
+}
+
+func (r *CustomerRepo) GetByEmail(email string) (*customer.Customer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.byEmail[email]
+	if !ok {
+		return nil, customer.ErrNotFound
+	}
+	return r.byID[id].Clone(), nil
+}
+
+func (r *CustomerRepo) Update(c *customer.Customer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cur, ok := r.byID[c.ID]
+	if !ok {
+		return customer.ErrNotFound
+	}
+	if cur.Email != c.Email {
+		if _, taken := r.byEmail[c.Email]; taken {
+			return customer.ErrEmailInUse
+		}
+		delete(r.byEmail, cur.Email)
+		r.byEmail[c.Email] = c.ID
+	}
+	r.byID[c.ID] = c.Clone()
+	return nil
+}
+
+func (r *CustomerRepo) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.byID[id]
+	if !ok {
+		return customer.ErrNotFound
+	}
+	delete(r.byEmail, c.Email)
+	delete(r.byID, id)
+	return nil
+}
+
+func (r *CustomerRepo) List() ([]*customer.Customer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]*customer.Customer, 0, len(r.byID))
+	for _, c := range r.byID {
+		out = append(out, c.Clone())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
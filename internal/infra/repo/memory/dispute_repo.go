@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/dispute"
+)
+
+type DisputeRepo struct {
+	mu       sync.RWMutex
+	byID     map[string]*dispute.Dispute
+	byStripe map[string]string
+}
+
+func NewDisputeRepo() *DisputeRepo {
+	return &DisputeRepo{
+		byID:     make(map[string]*dispute.Dispute),
+		byStripe: make(map[string]string),
+	}
+}
+
+func (r *DisputeRepo) Create(d *dispute.Dispute) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.byID[d.ID]; ok {
+		return dispute.ErrExists
+	}
+	if _, ok := r.byStripe[d.StripeDisputeID]; ok {
+		return dispute.ErrExists
+	}
+	r.byID[d.ID] = d.Clone()
+	r.byStripe[d.StripeDisputeID] = d.ID
+	return nil
+}
+
+func (r *DisputeRepo) Get(id string) (*dispute.Dispute, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	d, ok := r.byID[id]
+	if !ok {
+		return nil, dispute.ErrNotFound
+	}
+	return d.Clone(), nil
+}
+
+func (r *DisputeRepo) GetByStripeID(stripeDisputeID string) (*dispute.Dispute, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.byStripe[stripeDisputeID]
+	if !ok {
+		return nil, dispute.ErrNotFound
+	}
+	return r.byID[id].Clone(), nil
+}
+
+func (r *DisputeRepo) Update(d *dispute.Dispute) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.byID[d.ID]; !ok {
+		return dispute.ErrNotFound
+	}
+	r.byID[d.ID] = d.Clone()
+	return nil
+}
+
+func (r *DisputeRepo) List(q dispute.Query) ([]*dispute.Dispute, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := []*dispute.Dispute{}
+	for _, d := range r.byID {
+		if q.Matches(d) {
+			out = append(out, d.Clone())
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	return out, nil
+}
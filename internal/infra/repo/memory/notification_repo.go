@@ -0,0 +1,133 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/notification"
+)
+
+type NotificationRepo struct {
+	mu         sync.RWMutex
+	endpoints  map[string]*notification.Endpoint
+	deliveries map[string]*notification.Delivery
+	byEvent    map[string]string // endpointID|eventID -> deliveryID
+}
+
+func NewNotificationRepo() *NotificationRepo {
+	return &NotificationRepo{
+		endpoints:  make(map[string]*notification.Endpoint),
+		deliveries: make(map[string]*notification.Delivery),
+		byEvent:    make(map[string]string),
+	}
+}
+
+func (r *NotificationRepo) CreateEndpoint(e *notification.Endpoint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cp := *e
+	cp.Events = append([]string(nil), e.Events...)
+	r.endpoints[e.ID] = &cp
+	return nil
+}
+
+func (r *NotificationRepo) GetEndpoint(id string) (*notification.Endpoint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.endpoints[id]
+	if !ok {
+		return nil, notification.ErrNotFound
+	}
+	cp := *e
+	return &cp, nil
+}
+
+func (r *NotificationRepo) ListEndpoints() ([]*notification.Endpoint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]*notification.Endpoint, 0, len(r.endpoints))
+	for _, e := range r.endpoints {
+		cp := *e
+		out = append(out, &cp)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (r *NotificationRepo) DeleteEndpoint(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.endpoints[id]; !ok {
+		return notification.ErrNotFound
+	}
+	delete(r.endpoints, id)
+	return nil
+}
+
+func (r *NotificationRepo) CreateDelivery(d *notification.Delivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := d.EndpointID + "|" + d.EventID
+	if _, ok := r.byEvent[key]; ok {
+		return notification.ErrDuplicateDelivery
+	}
+	r.byEvent[key] = d.ID
+	r.deliveries[d.ID] = cloneDelivery(d)
+	return nil
+}
+
+func (r *NotificationRepo) UpdateDelivery(d *notification.Delivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.deliveries[d.ID]; !ok {
+		return notification.ErrNotFound
+	}
+	r.deliveries[d.ID] = cloneDelivery(d)
+	return nil
+}
+
+func (r *NotificationRepo) GetDelivery(id string) (*notification.Delivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	d, ok := r.deliveries[id]
+	if !ok {
+		return nil, notification.ErrNotFound
+	}
+	return cloneDelivery(d), nil
+}
+
+func (r *NotificationRepo) ListDeliveries(endpointID string) ([]*notification.Delivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]*notification.Delivery, 0)
+	for _, d := range r.deliveries {
+		if d.EndpointID == endpointID {
+			out = append(out, cloneDelivery(d))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	return out, nil
+}
+
+func (r *NotificationRepo) DueDeliveries(now time.Time, limit int) ([]*notification.Delivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]*notification.Delivery, 0)
+	for _, d := range r.deliveries {
+		if d.Status == notification.DeliveryPending && !d.NextAttemptAt.After(now) {
+			out = append(out, cloneDelivery(d))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].NextAttemptAt.Before(out[j].NextAttemptAt) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func cloneDelivery(d *notification.Delivery) *notification.Delivery {
+	cp := *d
+	cp.Attempts = append([]notification.Attempt(nil), d.Attempts...)
+	return &cp
+}
@@ -2,22 +2,29 @@ package memory
 
 import (
 	"errors"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/outbox"
 )
 
 type PaymentRepo struct {
 	mu   sync.RWMutex
 	byID map[string]*payment.Payment
-	byPI map[string]string
+	byPI map[string]string // inclui PaymentIntents substituídos na reautorização
+	ids  []string          // IDs (ULID) em ordem crescente, para List
+	ob   outbox.Writer
 }
 
-func NewPaymentRepo() *PaymentRepo {
+// NewPaymentRepo grava os eventos pendentes de cada pagamento no outbox sob o
+// mesmo lock da escrita do estado.
+func NewPaymentRepo(ob outbox.Writer) *PaymentRepo {
 	return &PaymentRepo{
 		byID: make(map[string]*payment.Payment),
 		byPI: make(map[string]string),
+		ob:   ob,
 	}
 }
 
@@ -27,10 +34,16 @@ func (r *PaymentRepo) Create(p *payment.Payment) error {
 	if _, ok := r.byID[p.ID]; ok {
 		return errors.New("payment already exists")
 	}
+	if err := r.enqueue(p); err != nil {
+		return err
+	}
 	now := time.Now().UTC()
 	p.CreatedAt = now
 	p.UpdatedAt = now
-	r.byID[p.ID] = clone(p)
+	p.Version = 1
+	p.ClearPendingEvents()
+	r.byID[p.ID] = stored(p)
+	r.ids = insertSorted(r.ids, p.ID)
 	if p.StripePaymentIntentID != "" {
 		r.byPI[p.StripePaymentIntentID] = p.ID
 	}
@@ -44,18 +57,26 @@ func (r *PaymentRepo) Get(id string) (*payment.Payment, error) {
 	if !ok {
 		return nil, errors.New("not found")
 	}
-	return clone(p), nil
+	return p.Clone(), nil
 }
 
 func (r *PaymentRepo) Update(p *payment.Payment) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	_, ok := r.byID[p.ID]
+	cur, ok := r.byID[p.ID]
 	if !ok {
 		return errors.New("not found")
 	}
+	if cur.Version != p.Version {
+		return &payment.ConflictError{ID: p.ID, Expected: p.Version, Actual: cur.Version}
+	}
+	if err := r.enqueue(p); err != nil {
+		return err
+	}
 	p.UpdatedAt = time.Now().UTC()
-	r.byID[p.ID] = clone(p)
+	p.Version++
+	p.ClearPendingEvents()
+	r.byID[p.ID] = stored(p)
 	if p.StripePaymentIntentID != "" {
 		r.byPI[p.StripePaymentIntentID] = p.ID
 	}
@@ -69,10 +90,49 @@ func (r *PaymentRepo) GetByPaymentIntent(piID string) (*payment.Payment, error)
 	if !ok {
 		return nil, errors.New("not found")
 	}
-	return clone(r.byID[id]), nil
+	return r.byID[id].Clone(), nil
+}
+
+// List percorre o índice ordenado de IDs a partir do cursor, parando assim
+// que a página enche.
+func (r *PaymentRepo) List(q payment.Query) (payment.Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return payment.Paginate(r.ids, func(id string) *payment.Payment { return r.byID[id] }, q), nil
+}
+
+func (r *PaymentRepo) History(id string) ([]payment.Transition, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.byID[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return append([]payment.Transition(nil), p.History...), nil
 }
 
-func clone(p *payment.Payment) *payment.Payment {
-	cp := *p
-	return &cp
+func (r *PaymentRepo) enqueue(p *payment.Payment) error {
+	msgs, err := outbox.FromEvents(p.PendingEvents())
+	if err != nil {
+		return err
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return r.ob.Add(msgs...)
+}
+
+// stored é a cópia gravada de p, sem o client_secret (ver Payment.ClientSecret).
+func stored(p *payment.Payment) *payment.Payment {
+	c := p.Clone()
+	c.ClientSecret = ""
+	return c
+}
+
+func insertSorted(ids []string, id string) []string {
+	i, found := slices.BinarySearch(ids, id)
+	if found {
+		return ids
+	}
+	return slices.Insert(ids, i, id)
 }
@@ -0,0 +1,134 @@
+package sqlrepo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/customer"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+)
+
+const customerColumns = `id, email, name, phone, metadata, stripe_customer_id, created_at, updated_at`
+
+type CustomerRepo struct {
+	db *sql.DB
+}
+
+func NewCustomerRepo(db *sql.DB) *CustomerRepo {
+	return &CustomerRepo{db: db}
+}
+
+func (r *CustomerRepo) Create(c *customer.Customer) error {
+	args, err := customerArgs(c)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`INSERT INTO customers (`+customerColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`, args...)
+	return customerError(err)
+}
+
+func (r *CustomerRepo) Get(id string) (*customer.Customer, error) {
+	return scanCustomer(r.db.QueryRow(`SELECT `+customerColumns+` FROM customers WHERE id = $1`, id))
+}
+
+func (r *CustomerRepo) GetByEmail(email string) (*customer.Customer, error) {
+	return scanCustomer(r.db.QueryRow(`SELECT `+customerColumns+` FROM customers WHERE email = $1`, email))
+}
+
+func (r *CustomerRepo) Update(c *customer.Customer) error {
+	args, err := customerArgs(c)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.Exec(`UPDATE customers SET
+		email = $2, name = $3, phone = $4, metadata = $5, stripe_customer_id = $6,
+		created_at = $7, updated_at = $8
+		WHERE id = $1`, args...)
+	if err != nil {
+		return customerError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return customer.ErrNotFound
+	}
+	return nil
+}
+
+func (r *CustomerRepo) Delete(id string) error {
+	res, err := r.db.Exec(`DELETE FROM customers WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return customer.ErrNotFound
+	}
+	return nil
+}
+
+func (r *CustomerRepo) List() ([]*customer.Customer, error) {
+	rows, err := r.db.Query(`SELECT ` + customerColumns + ` FROM customers ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*customer.Customer{}
+	for rows.Next() {
+		c, err := scanCustomer(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func customerArgs(c *customer.Customer) ([]any, error) {
+	md := c.Metadata
+	if md == nil {
+		md = payment.Metadata{}
+	}
+	raw, err := json.Marshal(md)
+	if err != nil {
+		return nil, err
+	}
+	var stripeID sql.NullString
+	if c.StripeCustomerID != "" {
+		stripeID = sql.NullString{String: c.StripeCustomerID, Valid: true}
+	}
+	return []any{c.ID, c.Email, c.Name, c.Phone, string(raw), stripeID, c.CreatedAt.UTC(), c.UpdatedAt.UTC()}, nil
+}
+
+func scanCustomer(row scanner) (*customer.Customer, error) {
+	var (
+		c        customer.Customer
+		md       string
+		stripeID sql.NullString
+	)
+	err := row.Scan(&c.ID, &c.Email, &c.Name, &c.Phone, &md, &stripeID, &c.CreatedAt, &c.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, customer.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.StripeCustomerID = stripeID.String
+	if err := json.Unmarshal([]byte(md), &c.Metadata); err != nil {
+		return nil, err
+	}
+	if len(c.Metadata) == 0 {
+		c.Metadata = nil
+	}
+	return &c, nil
+}
+
+func customerError(err error) error {
+	if err == nil || !isUniqueViolation(err) {
+		return err
+	}
+	if strings.Contains(strings.ToLower(err.Error()), "email") {
+		return customer.ErrEmailInUse
+	}
+	return customer.ErrCustomerExists
+}
@@ -0,0 +1,166 @@
+package sqlrepo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/dispute"
+)
+
+const disputeColumns = `id, stripe_dispute_id, payment_id, payment_intent_id, charge_id, amount, currency,
+	reason, status, evidence_due_by, evidence, files, submitted_at, deadline_warned_at, gateway_event_at,
+	created_at, updated_at`
+
+type DisputeRepo struct {
+	db *sql.DB
+}
+
+func NewDisputeRepo(db *sql.DB) *DisputeRepo {
+	return &DisputeRepo{db: db}
+}
+
+func (r *DisputeRepo) Create(d *dispute.Dispute) error {
+	args, err := disputeArgs(d)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`INSERT INTO disputes (`+disputeColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`, args...)
+	if err != nil && isUniqueViolation(err) {
+		return dispute.ErrExists
+	}
+	return err
+}
+
+func (r *DisputeRepo) Get(id string) (*dispute.Dispute, error) {
+	return scanDispute(r.db.QueryRow(`SELECT `+disputeColumns+` FROM disputes WHERE id = $1`, id))
+}
+
+func (r *DisputeRepo) GetByStripeID(stripeDisputeID string) (*dispute.Dispute, error) {
+	return scanDispute(r.db.QueryRow(`SELECT `+disputeColumns+` FROM disputes WHERE stripe_dispute_id = $1`, stripeDisputeID))
+}
+
+func (r *DisputeRepo) Update(d *dispute.Dispute) error {
+	args, err := disputeArgs(d)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.Exec(`UPDATE disputes SET
+		stripe_dispute_id = $2, payment_id = $3, payment_intent_id = $4, charge_id = $5, amount = $6,
+		currency = $7, reason = $8, status = $9, evidence_due_by = $10, evidence = $11, files = $12,
+		submitted_at = $13, deadline_warned_at = $14, gateway_event_at = $15, created_at = $16,
+		updated_at = $17
+		WHERE id = $1`, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return dispute.ErrNotFound
+	}
+	return nil
+}
+
+func (r *DisputeRepo) List(q dispute.Query) ([]*dispute.Dispute, error) {
+	var (
+		where []string
+		args  []any
+	)
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, strings.ReplaceAll(cond, "?", fmt.Sprintf("$%d", len(args))))
+	}
+	if q.PaymentID != "" {
+		add("payment_id = ?", q.PaymentID)
+	}
+	if q.Status != "" {
+		add("status = ?", string(q.Status))
+	}
+	if !q.DueBefore.IsZero() {
+		add("evidence_due_by <= ?", q.DueBefore.UTC())
+		where = append(where, fmt.Sprintf("status IN ('%s', '%s')",
+			dispute.StatusNeedsResponse, dispute.StatusWarningNeedsResponse))
+	}
+	query := `SELECT ` + disputeColumns + ` FROM disputes`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	rows, err := r.db.Query(query+" ORDER BY id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*dispute.Dispute{}
+	for rows.Next() {
+		d, err := scanDispute(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func disputeArgs(d *dispute.Dispute) ([]any, error) {
+	ev := d.Evidence
+	if ev == nil {
+		ev = dispute.Evidence{}
+	}
+	evidence, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	files, err := json.Marshal(nonNil(d.Files))
+	if err != nil {
+		return nil, err
+	}
+	return []any{
+		d.ID, d.StripeDisputeID, d.PaymentID, d.PaymentIntentID, d.ChargeID, d.Amount, d.Currency,
+		d.Reason, string(d.Status), nullTime(d.EvidenceDueBy), string(evidence), string(files),
+		nullTime(d.SubmittedAt), nullTime(d.DeadlineWarnedAt), nullTime(d.GatewayEventAt),
+		d.CreatedAt.UTC(), d.UpdatedAt.UTC(),
+	}, nil
+}
+
+func scanDispute(row scanner) (*dispute.Dispute, error) {
+	var (
+		d                        dispute.Dispute
+		status, evidence, files  string
+		dueBy, submitted, warned sql.NullTime
+		gatewayAt                sql.NullTime
+	)
+	err := row.Scan(&d.ID, &d.StripeDisputeID, &d.PaymentID, &d.PaymentIntentID, &d.ChargeID, &d.Amount,
+		&d.Currency, &d.Reason, &status, &dueBy, &evidence, &files, &submitted, &warned, &gatewayAt,
+		&d.CreatedAt, &d.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, dispute.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.Status = dispute.Status(status)
+	d.EvidenceDueBy = dueBy.Time
+	d.SubmittedAt = submitted.Time
+	d.DeadlineWarnedAt = warned.Time
+	d.GatewayEventAt = gatewayAt.Time
+	if err := json.Unmarshal([]byte(evidence), &d.Evidence); err != nil {
+		return nil, err
+	}
+	if len(d.Evidence) == 0 {
+		d.Evidence = nil
+	}
+	if err := json.Unmarshal([]byte(files), &d.Files); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
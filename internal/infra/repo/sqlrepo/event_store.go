@@ -0,0 +1,124 @@
+package sqlrepo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/outbox"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/repo/eventstore"
+)
+
+// EventStore implementa eventstore.Store na tabela payment_events. Append
+// grava os eventos e as mensagens do outbox na mesma transação.
+type EventStore struct {
+	db *sql.DB
+}
+
+func NewEventStore(db *sql.DB) *EventStore {
+	return &EventStore{db: db}
+}
+
+func (s *EventStore) Append(streamID string, expectedSeq int64, evts []payment.Event, msgs []outbox.Message) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var last int64
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(seq), 0) FROM payment_events WHERE payment_id = $1`,
+		streamID).Scan(&last); err != nil {
+		return err
+	}
+	if last != expectedSeq {
+		return eventstore.ErrStreamConflict
+	}
+	for _, e := range evts {
+		origin, err := json.Marshal(e.Origin)
+		if err != nil {
+			return err
+		}
+		var meta []byte
+		if len(e.Meta) > 0 {
+			if meta, err = json.Marshal(e.Meta); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(`INSERT INTO payment_events
+			(payment_id, seq, id, event_type, occurred_at, origin, data, meta, sensitive)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			streamID, e.Seq, e.ID, string(e.Type), e.OccurredAt.UTC(), string(origin),
+			string(e.Data), string(meta), string(e.Sensitive)); err != nil {
+			if isUniqueViolation(err) {
+				// outro escritor gravou a mesma posição
+				return eventstore.ErrStreamConflict
+			}
+			return err
+		}
+	}
+	if err := insertMessages(tx, msgs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *EventStore) Load(streamID string) ([]payment.Event, error) {
+	rows, err := s.db.Query(`SELECT payment_id, seq, id, event_type, occurred_at, origin, data, meta, sensitive
+		FROM payment_events WHERE payment_id = $1 ORDER BY seq`, streamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var evts []payment.Event
+	for rows.Next() {
+		var (
+			e                             payment.Event
+			typ, origin, data, meta, sens string
+		)
+		if err := rows.Scan(&e.PaymentID, &e.Seq, &e.ID, &typ, &e.OccurredAt, &origin, &data, &meta, &sens); err != nil {
+			return nil, err
+		}
+		e.Type = payment.EventType(typ)
+		e.OccurredAt = e.OccurredAt.UTC()
+		if err := json.Unmarshal([]byte(origin), &e.Origin); err != nil {
+			return nil, err
+		}
+		if meta != "" {
+			if err := json.Unmarshal([]byte(meta), &e.Meta); err != nil {
+				return nil, err
+			}
+		}
+		if data != "" {
+			e.Data = json.RawMessage(data)
+		}
+		if sens != "" {
+			e.Sensitive = json.RawMessage(sens)
+		}
+		evts = append(evts, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(evts) == 0 {
+		return nil, errors.New("not found")
+	}
+	return evts, nil
+}
+
+func (s *EventStore) Streams() ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT payment_id FROM payment_events ORDER BY payment_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,112 @@
+package sqlrepo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/repo/eventstore"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := Open("sqlite", "file:"+filepath.Join(t.TempDir(), "payments.db")+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestEventStoreReplaysPaymentsAfterRestart(t *testing.T) {
+	db := openTestDB(t)
+	repo, err := eventstore.NewPaymentRepo(NewEventStore(db))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := payment.New("pay_1", payment.Money{Amount: 5000, Currency: "brl"}, "buyer@example.com",
+		payment.Details{Metadata: payment.Metadata{"cart_id": "c_1"}, ClientIP: "203.0.113.7"},
+		payment.Origin{Source: payment.SourceAPI, RequestID: "req_1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Create(p); err != nil {
+		t.Fatal(err)
+	}
+	steps := []func() error{
+		func() error { return p.MarkAuthorized("pi_1") },
+		func() error { return p.ChangeAmount(7000, payment.AmountChangeReauthorization, "pi_2") },
+		func() error { return p.MarkCaptured(0) },
+		func() error {
+			return p.AddRefund(payment.Refund{ID: "ref_1", Amount: 1000, StripeRefundID: "re_1", CreatedAt: time.Now().UTC()})
+		},
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if err := repo.Update(p); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+	want, _ := repo.Get("pay_1")
+
+	// nova instância sobre o mesmo banco: as projeções vêm só dos eventos
+	restarted, err := eventstore.NewPaymentRepo(NewEventStore(db))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := restarted.Get("pay_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(want)
+	if string(gotJSON) != string(wantJSON) {
+		t.Fatalf("replayed payment differs:\n got %s\nwant %s", gotJSON, wantJSON)
+	}
+	// dados pessoais só ficam no event store (Event.Sensitive)
+	if got.Email != "buyer@example.com" || got.ClientIP != "203.0.113.7" {
+		t.Fatalf("sensitive data = %q %q, want it replayed", got.Email, got.ClientIP)
+	}
+	if got.Status != payment.StatusPartiallyRefunded || got.Version != 5 || len(got.Refunds) != 1 {
+		t.Fatalf("status = %s, version = %d, refunds = %d", got.Status, got.Version, len(got.Refunds))
+	}
+	// o PaymentIntent substituído na reautorização continua indexado
+	if old, err := restarted.GetByPaymentIntent("pi_1"); err != nil || old.ID != "pay_1" {
+		t.Fatalf("GetByPaymentIntent(pi_1) = %v, %v", old, err)
+	}
+
+	var msgs int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM outbox_messages`).Scan(&msgs); err != nil {
+		t.Fatal(err)
+	}
+	if msgs != int(got.EventSeq) {
+		t.Fatalf("outbox messages = %d, want one per event (%d)", msgs, got.EventSeq)
+	}
+}
+
+func TestEventStoreRejectsStaleAppend(t *testing.T) {
+	s := NewEventStore(openTestDB(t))
+	p, err := payment.New("pay_1", payment.Money{Amount: 5000, Currency: "brl"}, "buyer@example.com",
+		payment.Details{}, payment.Origin{Source: payment.SourceAPI})
+	if err != nil {
+		t.Fatal(err)
+	}
+	evts := p.PendingEvents()
+	if err := s.Append("pay_1", 0, evts, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append("pay_1", 0, evts, nil); !errors.Is(err, eventstore.ErrStreamConflict) {
+		t.Fatalf("err = %v, want ErrStreamConflict", err)
+	}
+	stored, err := s.Load("pay_1")
+	if err != nil || len(stored) != len(evts) {
+		t.Fatalf("stored = %d events, err = %v, want %d", len(stored), err, len(evts))
+	}
+}
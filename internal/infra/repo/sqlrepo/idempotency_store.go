@@ -0,0 +1,105 @@
+package sqlrepo
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/idempotency"
+)
+
+// IdempotencyStore implementa idempotency.Store na tabela idempotency_keys.
+type IdempotencyStore struct {
+	db *sql.DB
+}
+
+func NewIdempotencyStore(db *sql.DB) *IdempotencyStore {
+	return &IdempotencyStore{db: db}
+}
+
+func (s *IdempotencyStore) Begin(rec idempotency.Record) (idempotency.Record, bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return idempotency.Record{}, false, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if _, err := tx.Exec(`DELETE FROM idempotency_keys WHERE expires_at <= $1`, now); err != nil {
+		return idempotency.Record{}, false, err
+	}
+	rec.Status = idempotency.StatusInProgress
+	res, err := tx.Exec(`INSERT INTO idempotency_keys
+		(idem_key, fingerprint, status, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (idem_key) DO NOTHING`,
+		rec.Key, rec.Fingerprint, string(rec.Status), rec.CreatedAt.UTC(), rec.ExpiresAt.UTC())
+	if err != nil {
+		return idempotency.Record{}, false, err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return rec, true, tx.Commit()
+	}
+
+	var (
+		cur          idempotency.Record
+		status, body string
+	)
+	err = tx.QueryRow(`SELECT idem_key, fingerprint, status, response_code, content_type, response_body,
+		resource_id, created_at, expires_at FROM idempotency_keys WHERE idem_key = $1`, rec.Key).
+		Scan(&cur.Key, &cur.Fingerprint, &status, &cur.ResponseCode, &cur.ContentType, &body,
+			&cur.ResourceID, &cur.CreatedAt, &cur.ExpiresAt)
+	if err != nil {
+		return idempotency.Record{}, false, err
+	}
+	cur.Status = idempotency.Status(status)
+	cur.ResponseBody = []byte(body)
+	if cur.Status != idempotency.StatusInterrupted || cur.Fingerprint != rec.Fingerprint {
+		return cur, false, tx.Commit()
+	}
+
+	// retoma a tentativa interrompida com o mesmo recurso
+	cur.Status = idempotency.StatusInProgress
+	if _, err := tx.Exec(`UPDATE idempotency_keys SET status = $2 WHERE idem_key = $1`,
+		cur.Key, string(cur.Status)); err != nil {
+		return idempotency.Record{}, false, err
+	}
+	return cur, true, tx.Commit()
+}
+
+func (s *IdempotencyStore) Complete(key string, code int, contentType string, body []byte) error {
+	res, err := s.db.Exec(`UPDATE idempotency_keys
+		SET status = $2, response_code = $3, content_type = $4, response_body = $5
+		WHERE idem_key = $1`,
+		key, string(idempotency.StatusCompleted), code, contentType, string(body))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return idempotency.ErrNotFound
+	}
+	return nil
+}
+
+func (s *IdempotencyStore) Release(key string) error {
+	_, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE idem_key = $1`, key)
+	return err
+}
+
+func (s *IdempotencyStore) Attach(key, resourceID string) error {
+	return s.update(`UPDATE idempotency_keys SET resource_id = $2 WHERE idem_key = $1`, key, resourceID)
+}
+
+func (s *IdempotencyStore) Interrupt(key string) error {
+	return s.update(`UPDATE idempotency_keys SET status = $2 WHERE idem_key = $1`, key, string(idempotency.StatusInterrupted))
+}
+
+func (s *IdempotencyStore) update(query string, args ...any) error {
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return idempotency.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package sqlrepo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/inbox"
+)
+
+const inboxColumns = `id, event_key, event_type, created, payload, request_id, status, attempts, error,
+	received_at, next_attempt_at, processed_at`
+
+// InboxStore implementa inbox.Store na tabela webhook_events.
+type InboxStore struct {
+	db *sql.DB
+}
+
+func NewInboxStore(db *sql.DB) *InboxStore {
+	return &InboxStore{db: db}
+}
+
+func (s *InboxStore) Begin(e inbox.Event) (inbox.Event, bool, error) {
+	e.Status = inbox.StatusReceived
+	e.NextAttemptAt = e.ReceivedAt
+	res, err := s.db.Exec(`INSERT INTO webhook_events
+		(id, event_key, event_type, created, payload, request_id, status, received_at, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO NOTHING`,
+		e.ID, e.Key, e.Type, e.Created.UTC(), string(e.Payload), e.RequestID, string(e.Status),
+		e.ReceivedAt.UTC(), e.NextAttemptAt.UTC())
+	if err != nil {
+		return inbox.Event{}, false, err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return e, true, nil
+	}
+	cur, err := s.Get(e.ID)
+	return cur, false, err
+}
+
+func (s *InboxStore) Due(now time.Time, limit int) ([]inbox.Event, error) {
+	// só o evento pendente mais antigo de cada chave é elegível
+	return s.query(`SELECT `+inboxColumns+` FROM webhook_events w
+		WHERE w.status IN ($1, $2) AND COALESCE(w.next_attempt_at, w.received_at) <= $3
+		AND NOT EXISTS (
+			SELECT 1 FROM webhook_events o
+			WHERE o.event_key = w.event_key AND o.status IN ($1, $2)
+			AND (o.received_at < w.received_at OR (o.received_at = w.received_at AND o.id < w.id))
+		)
+		ORDER BY w.received_at, w.id
+		LIMIT $4`, string(inbox.StatusReceived), string(inbox.StatusFailed), now.UTC(), limit)
+}
+
+func (s *InboxStore) Finish(id string, st inbox.Status, attempts int, errMsg string) error {
+	return s.exec(`UPDATE webhook_events SET status = $2, attempts = $3, error = $4, processed_at = $5
+		WHERE id = $1`, id, string(st), attempts, errMsg, time.Now().UTC())
+}
+
+func (s *InboxStore) Retry(id string, attempts int, next time.Time, errMsg string) error {
+	return s.exec(`UPDATE webhook_events SET status = $2, attempts = $3, error = $4, next_attempt_at = $5
+		WHERE id = $1`, id, string(inbox.StatusFailed), attempts, errMsg, next.UTC())
+}
+
+func (s *InboxStore) Requeue(id string) error {
+	return s.exec(`UPDATE webhook_events SET status = $2, attempts = 0, next_attempt_at = $3, processed_at = NULL
+		WHERE id = $1 AND status NOT IN ($2, $4)`,
+		id, string(inbox.StatusReceived), time.Now().UTC(), string(inbox.StatusFailed))
+}
+
+func (s *InboxStore) Get(id string) (inbox.Event, error) {
+	e, err := scanInboxEvent(s.db.QueryRow(`SELECT `+inboxColumns+` FROM webhook_events WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return inbox.Event{}, inbox.ErrNotFound
+	}
+	return e, err
+}
+
+func (s *InboxStore) List(st inbox.Status, limit int) ([]inbox.Event, error) {
+	query := `SELECT ` + inboxColumns + ` FROM webhook_events`
+	args := []any{}
+	if st != "" {
+		query += ` WHERE status = $1`
+		args = append(args, string(st))
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(` ORDER BY received_at DESC, id DESC LIMIT $%d`, len(args))
+	return s.query(query, args...)
+}
+
+func (s *InboxStore) exec(query string, args ...any) error {
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return inbox.ErrNotFound
+	}
+	return nil
+}
+
+func (s *InboxStore) query(query string, args ...any) ([]inbox.Event, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []inbox.Event{}
+	for rows.Next() {
+		e, err := scanInboxEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func scanInboxEvent(row scanner) (inbox.Event, error) {
+	var (
+		e               inbox.Event
+		payload, status string
+		nextAttemptAt   sql.NullTime
+		processedAt     sql.NullTime
+	)
+	if err := row.Scan(&e.ID, &e.Key, &e.Type, &e.Created, &payload, &e.RequestID, &status, &e.Attempts,
+		&e.Error, &e.ReceivedAt, &nextAttemptAt, &processedAt); err != nil {
+		return inbox.Event{}, err
+	}
+	e.Payload = []byte(payload)
+	e.Status = inbox.Status(status)
+	e.NextAttemptAt = e.ReceivedAt
+	if nextAttemptAt.Valid {
+		e.NextAttemptAt = nextAttemptAt.Time
+	}
+	if processedAt.Valid {
+		t := processedAt.Time
+		e.ProcessedAt = &t
+	}
+	return e, nil
+}
@@ -0,0 +1,35 @@
+CREATE TABLE payments (
+    id                       TEXT PRIMARY KEY,
+    amount                   BIGINT NOT NULL,
+    currency                 TEXT NOT NULL,
+    email                    TEXT NOT NULL,
+    status                   TEXT NOT NULL,
+    captured_amount          BIGINT NOT NULL DEFAULT 0,
+    released_amount          BIGINT NOT NULL DEFAULT 0,
+    refunded_amount          BIGINT NOT NULL DEFAULT 0,
+    refunds                  TEXT NOT NULL DEFAULT '[]',
+    amount_changes           TEXT NOT NULL DEFAULT '[]',
+    history                  TEXT NOT NULL DEFAULT '[]',
+    stripe_payment_intent_id TEXT,
+    client_secret            TEXT NOT NULL DEFAULT '',
+    event_seq                BIGINT NOT NULL DEFAULT 0,
+    created_at               TIMESTAMP NOT NULL,
+    updated_at               TIMESTAMP NOT NULL
+);
+
+-- id já é único pela PRIMARY KEY, PaymentIntent vazio é gravado como NULL
+CREATE UNIQUE INDEX ux_payments_stripe_pi ON payments (stripe_payment_intent_id);
+
+CREATE TABLE outbox_messages (
+    id              TEXT PRIMARY KEY,
+    topic           TEXT NOT NULL,
+    msg_key         TEXT NOT NULL,
+    payload         TEXT NOT NULL,
+    status          TEXT NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMP NOT NULL,
+    next_attempt_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX ix_outbox_status_key ON outbox_messages (status, msg_key, created_at);
@@ -0,0 +1,2 @@
+-- versão para controle de concorrência otimista: Update só grava se a versão lida for a atual
+ALTER TABLE payments ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
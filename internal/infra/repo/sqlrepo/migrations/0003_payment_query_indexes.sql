@@ -0,0 +1,4 @@
+-- filtros de GET /v1/payments, a ordenação e o cursor usam a chave primária (ULID)
+CREATE INDEX ix_payments_status ON payments (status, id);
+CREATE INDEX ix_payments_email ON payments (email, id);
+CREATE INDEX ix_payments_created_at ON payments (created_at);
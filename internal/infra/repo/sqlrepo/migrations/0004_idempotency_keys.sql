@@ -0,0 +1,13 @@
+-- Idempotency-Key das rotas que alteram pagamentos, com a resposta gravada para replay
+CREATE TABLE idempotency_keys (
+    idem_key      TEXT PRIMARY KEY,
+    fingerprint   TEXT NOT NULL,
+    status        TEXT NOT NULL,
+    response_code INTEGER NOT NULL DEFAULT 0,
+    content_type  TEXT NOT NULL DEFAULT '',
+    response_body TEXT NOT NULL DEFAULT '',
+    created_at    TIMESTAMP NOT NULL,
+    expires_at    TIMESTAMP NOT NULL
+);
+
+CREATE INDEX ix_idempotency_expires_at ON idempotency_keys (expires_at);
@@ -0,0 +1,15 @@
+ALTER TABLE payments ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN order_reference TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN metadata TEXT NOT NULL DEFAULT '{}';
+
+CREATE INDEX ix_payments_order_reference ON payments (order_reference);
+
+-- cópia de payments.metadata em linhas, para filtrar por chave/valor sem depender de funções JSON do banco
+CREATE TABLE payment_metadata (
+    payment_id TEXT NOT NULL REFERENCES payments (id),
+    meta_key   TEXT NOT NULL,
+    meta_value TEXT NOT NULL,
+    PRIMARY KEY (payment_id, meta_key)
+);
+
+CREATE INDEX ix_payment_metadata_key_value ON payment_metadata (meta_key, meta_value);
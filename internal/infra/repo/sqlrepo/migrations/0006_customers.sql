@@ -0,0 +1,18 @@
+CREATE TABLE customers (
+    id                 TEXT PRIMARY KEY,
+    email              TEXT NOT NULL,
+    name               TEXT NOT NULL DEFAULT '',
+    phone              TEXT NOT NULL DEFAULT '',
+    metadata           TEXT NOT NULL DEFAULT '{}',
+    stripe_customer_id TEXT,
+    created_at         TIMESTAMP NOT NULL,
+    updated_at         TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX ux_customers_email ON customers (email);
+CREATE UNIQUE INDEX ux_customers_stripe_id ON customers (stripe_customer_id);
+
+ALTER TABLE payments ADD COLUMN customer_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN stripe_customer_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX ix_payments_customer_id ON payments (customer_id, id);
@@ -0,0 +1 @@
+ALTER TABLE payments ADD COLUMN client_confirmation BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1 @@
+ALTER TABLE payments ADD COLUMN last_failure TEXT NOT NULL DEFAULT '';
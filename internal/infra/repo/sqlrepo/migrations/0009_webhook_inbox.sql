@@ -0,0 +1,15 @@
+-- Eventos do Stripe recebidos no webhook, por ID, com o resultado do processamento
+CREATE TABLE webhook_events (
+    id           TEXT PRIMARY KEY,
+    event_type   TEXT NOT NULL,
+    created      TIMESTAMP NOT NULL,
+    payload      TEXT NOT NULL,
+    status       TEXT NOT NULL,
+    error        TEXT NOT NULL DEFAULT '',
+    received_at  TIMESTAMP NOT NULL,
+    processed_at TIMESTAMP
+);
+
+CREATE INDEX ix_webhook_events_status ON webhook_events (status, received_at);
+
+ALTER TABLE payments ADD COLUMN gateway_event_at TIMESTAMP;
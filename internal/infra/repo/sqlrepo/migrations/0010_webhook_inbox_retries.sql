@@ -0,0 +1,7 @@
+-- Processamento assíncrono do inbox: chave de ordenação (PaymentIntent) e tentativas
+ALTER TABLE webhook_events ADD COLUMN event_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE webhook_events ADD COLUMN request_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE webhook_events ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE webhook_events ADD COLUMN next_attempt_at TIMESTAMP;
+
+CREATE INDEX ix_webhook_events_key ON webhook_events (event_key, status);
@@ -0,0 +1,27 @@
+-- Disputas (chargebacks) sincronizadas pelos webhooks charge.dispute.*
+CREATE TABLE disputes (
+    id                 TEXT PRIMARY KEY,
+    stripe_dispute_id  TEXT NOT NULL,
+    payment_id         TEXT NOT NULL,
+    payment_intent_id  TEXT NOT NULL DEFAULT '',
+    charge_id          TEXT NOT NULL DEFAULT '',
+    amount             BIGINT NOT NULL,
+    currency           TEXT NOT NULL,
+    reason             TEXT NOT NULL DEFAULT '',
+    status             TEXT NOT NULL,
+    evidence_due_by    TIMESTAMP,
+    evidence           TEXT NOT NULL DEFAULT '{}',
+    files              TEXT NOT NULL DEFAULT '[]',
+    submitted_at       TIMESTAMP,
+    deadline_warned_at TIMESTAMP,
+    gateway_event_at   TIMESTAMP,
+    created_at         TIMESTAMP NOT NULL,
+    updated_at         TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX ux_disputes_stripe_id ON disputes (stripe_dispute_id);
+CREATE INDEX ix_disputes_payment_id ON disputes (payment_id);
+CREATE INDEX ix_disputes_status_due ON disputes (status, evidence_due_by);
+
+ALTER TABLE payments ADD COLUMN dispute_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN dispute_status TEXT NOT NULL DEFAULT '';
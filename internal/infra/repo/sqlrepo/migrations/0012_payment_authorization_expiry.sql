@@ -0,0 +1,8 @@
+-- Prazo da autorização vigente, usado pela varredura de autorizações a expirar
+ALTER TABLE payments ADD COLUMN authorized_at TIMESTAMP;
+ALTER TABLE payments ADD COLUMN expiry_flagged_at TIMESTAMP;
+
+-- pagamentos já autorizados assumem a criação como início (estimativa conservadora)
+UPDATE payments SET authorized_at = created_at WHERE status = 'authorized';
+
+CREATE INDEX ix_payments_status_authorized_at ON payments (status, authorized_at);
@@ -0,0 +1,4 @@
+-- Dados do cartão avaliados pelo motor de risco e a última decisão (JSON)
+ALTER TABLE payments ADD COLUMN card_bin TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN card_country TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN risk TEXT NOT NULL DEFAULT '';
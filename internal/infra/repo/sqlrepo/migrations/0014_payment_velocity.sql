@@ -0,0 +1,3 @@
+-- Chaves dos limites de velocidade: IP do cliente e fingerprint do cartão
+ALTER TABLE payments ADD COLUMN client_ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN card_fingerprint TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,18 @@
+-- Quarentenas de origens (IP, e-mail) detectadas testando cartões. Os
+-- registros liberados ou expirados ficam como auditoria
+CREATE TABLE quarantines (
+    id           TEXT PRIMARY KEY,
+    kind         TEXT NOT NULL,
+    value        TEXT NOT NULL,
+    action       TEXT NOT NULL,
+    reason       TEXT NOT NULL,
+    attempts     INTEGER NOT NULL DEFAULT 0,
+    declines     INTEGER NOT NULL DEFAULT 0,
+    created_at   TIMESTAMP NOT NULL,
+    expires_at   TIMESTAMP NOT NULL,
+    released_at  TIMESTAMP,
+    released_by  TEXT NOT NULL DEFAULT '',
+    release_note TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX ix_quarantines_source ON quarantines (kind, value, expires_at);
@@ -0,0 +1,5 @@
+-- Revisão manual (JSON) e o início dela, usado pelo SLA de revisão
+ALTER TABLE payments ADD COLUMN review TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN review_requested_at TIMESTAMP;
+
+CREATE INDEX ix_payments_status_review_requested_at ON payments (status, review_requested_at);
@@ -0,0 +1,9 @@
+-- Todos os PaymentIntents de cada pagamento, inclusive os substituídos numa
+-- reautorização, para que os eventos tardios deles ainda achem o pagamento
+CREATE TABLE payment_intents (
+    payment_intent_id TEXT PRIMARY KEY,
+    payment_id        TEXT NOT NULL
+);
+
+INSERT INTO payment_intents (payment_intent_id, payment_id)
+    SELECT stripe_payment_intent_id, id FROM payments WHERE stripe_payment_intent_id IS NOT NULL;
@@ -0,0 +1,3 @@
+-- O client_secret do PaymentIntent só volta na resposta da autorização e não
+-- é mais gravado
+ALTER TABLE payments DROP COLUMN client_secret;
@@ -0,0 +1,25 @@
+-- Endpoints inscritos nos eventos de pagamento e as entregas para eles
+CREATE TABLE notification_endpoints (
+    id          TEXT PRIMARY KEY,
+    url         TEXT NOT NULL,
+    events      TEXT NOT NULL DEFAULT '[]',
+    description TEXT NOT NULL DEFAULT '',
+    secret      TEXT NOT NULL,
+    created_at  TIMESTAMP NOT NULL
+);
+
+CREATE TABLE notification_deliveries (
+    id              TEXT PRIMARY KEY,
+    endpoint_id     TEXT NOT NULL,
+    event_id        TEXT NOT NULL,
+    event_type      TEXT NOT NULL,
+    payload         TEXT NOT NULL,
+    status          TEXT NOT NULL,
+    attempts        TEXT NOT NULL DEFAULT '[]',
+    next_attempt_at TIMESTAMP,
+    created_at      TIMESTAMP NOT NULL,
+    updated_at      TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX ux_notification_deliveries_event ON notification_deliveries (endpoint_id, event_id);
+CREATE INDEX ix_notification_deliveries_due ON notification_deliveries (status, next_attempt_at);
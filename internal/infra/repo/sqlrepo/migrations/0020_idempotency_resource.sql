@@ -0,0 +1,2 @@
+-- recurso criado pela requisição (ex.: pagamento), retomado por uma nova tentativa depois de um erro ambíguo do gateway
+ALTER TABLE idempotency_keys ADD COLUMN resource_id TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,16 @@
+-- Streams de eventos dos pagamentos (REPO_DRIVER=eventstore), append-only e
+-- um por pagamento. sensitive guarda os dados pessoais, fora do outbox
+CREATE TABLE payment_events (
+    payment_id  TEXT NOT NULL,
+    seq         BIGINT NOT NULL,
+    id          TEXT NOT NULL,
+    event_type  TEXT NOT NULL,
+    occurred_at TIMESTAMP NOT NULL,
+    origin      TEXT NOT NULL DEFAULT '{}',
+    data        TEXT NOT NULL DEFAULT '',
+    meta        TEXT NOT NULL DEFAULT '',
+    sensitive   TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (payment_id, seq)
+);
+
+CREATE UNIQUE INDEX ux_payment_events_id ON payment_events (id);
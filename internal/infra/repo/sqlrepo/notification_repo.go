@@ -0,0 +1,187 @@
+package sqlrepo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/notification"
+)
+
+const (
+	endpointColumns = `id, url, events, description, secret, created_at`
+	deliveryColumns = `id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+	created_at, updated_at`
+)
+
+type NotificationRepo struct {
+	db *sql.DB
+}
+
+func NewNotificationRepo(db *sql.DB) *NotificationRepo {
+	return &NotificationRepo{db: db}
+}
+
+func (r *NotificationRepo) CreateEndpoint(e *notification.Endpoint) error {
+	events, err := json.Marshal(nonNil(e.Events))
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`INSERT INTO notification_endpoints (`+endpointColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		e.ID, e.URL, string(events), e.Description, e.Secret, e.CreatedAt.UTC())
+	return err
+}
+
+func (r *NotificationRepo) GetEndpoint(id string) (*notification.Endpoint, error) {
+	return scanEndpoint(r.db.QueryRow(`SELECT `+endpointColumns+` FROM notification_endpoints WHERE id = $1`, id))
+}
+
+func (r *NotificationRepo) ListEndpoints() ([]*notification.Endpoint, error) {
+	rows, err := r.db.Query(`SELECT ` + endpointColumns + ` FROM notification_endpoints ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*notification.Endpoint{}
+	for rows.Next() {
+		e, err := scanEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// DeleteEndpoint remove só a inscrição; as entregas ficam como histórico.
+func (r *NotificationRepo) DeleteEndpoint(id string) error {
+	res, err := r.db.Exec(`DELETE FROM notification_endpoints WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return notification.ErrNotFound
+	}
+	return nil
+}
+
+func (r *NotificationRepo) CreateDelivery(d *notification.Delivery) error {
+	args, err := deliveryArgs(d)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`INSERT INTO notification_deliveries (`+deliveryColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`, args...)
+	if err != nil && isUniqueViolation(err) {
+		return notification.ErrDuplicateDelivery
+	}
+	return err
+}
+
+func (r *NotificationRepo) UpdateDelivery(d *notification.Delivery) error {
+	args, err := deliveryArgs(d)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.Exec(`UPDATE notification_deliveries SET
+		endpoint_id = $2, event_id = $3, event_type = $4, payload = $5, status = $6, attempts = $7,
+		next_attempt_at = $8, created_at = $9, updated_at = $10
+		WHERE id = $1`, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return notification.ErrNotFound
+	}
+	return nil
+}
+
+func (r *NotificationRepo) GetDelivery(id string) (*notification.Delivery, error) {
+	return scanDelivery(r.db.QueryRow(`SELECT `+deliveryColumns+` FROM notification_deliveries WHERE id = $1`, id))
+}
+
+func (r *NotificationRepo) ListDeliveries(endpointID string) ([]*notification.Delivery, error) {
+	return r.queryDeliveries(`SELECT `+deliveryColumns+` FROM notification_deliveries
+		WHERE endpoint_id = $1 ORDER BY id DESC`, endpointID)
+}
+
+func (r *NotificationRepo) DueDeliveries(now time.Time, limit int) ([]*notification.Delivery, error) {
+	return r.queryDeliveries(`SELECT `+deliveryColumns+` FROM notification_deliveries
+		WHERE status = $1 AND (next_attempt_at IS NULL OR next_attempt_at <= $2)
+		ORDER BY next_attempt_at, id
+		LIMIT $3`, string(notification.DeliveryPending), now.UTC(), limit)
+}
+
+func (r *NotificationRepo) queryDeliveries(query string, args ...any) ([]*notification.Delivery, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*notification.Delivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func scanEndpoint(row scanner) (*notification.Endpoint, error) {
+	var (
+		e      notification.Endpoint
+		events string
+	)
+	err := row.Scan(&e.ID, &e.URL, &events, &e.Description, &e.Secret, &e.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notification.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(events), &e.Events); err != nil {
+		return nil, err
+	}
+	if len(e.Events) == 0 {
+		e.Events = nil
+	}
+	return &e, nil
+}
+
+func deliveryArgs(d *notification.Delivery) ([]any, error) {
+	attempts, err := json.Marshal(nonNil(d.Attempts))
+	if err != nil {
+		return nil, err
+	}
+	return []any{
+		d.ID, d.EndpointID, d.EventID, d.EventType, string(d.Payload), string(d.Status), string(attempts),
+		nullTime(d.NextAttemptAt), d.CreatedAt.UTC(), d.UpdatedAt.UTC(),
+	}, nil
+}
+
+func scanDelivery(row scanner) (*notification.Delivery, error) {
+	var (
+		d                         notification.Delivery
+		payload, status, attempts string
+		next                      sql.NullTime
+	)
+	err := row.Scan(&d.ID, &d.EndpointID, &d.EventID, &d.EventType, &payload, &status, &attempts, &next,
+		&d.CreatedAt, &d.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notification.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.Payload = json.RawMessage(payload)
+	d.Status = notification.DeliveryStatus(status)
+	d.NextAttemptAt = next.Time
+	if err := json.Unmarshal([]byte(attempts), &d.Attempts); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
@@ -0,0 +1,105 @@
+package sqlrepo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/outbox"
+)
+
+const outboxColumns = `id, topic, msg_key, payload, status, attempts, last_error, created_at, next_attempt_at`
+
+// OutboxStore lê a tabela outbox_messages preenchida pelo PaymentRepo.
+type OutboxStore struct {
+	db *sql.DB
+}
+
+func NewOutboxStore(db *sql.DB) *OutboxStore {
+	return &OutboxStore{db: db}
+}
+
+func (s *OutboxStore) Add(msgs ...outbox.Message) error {
+	for _, m := range msgs {
+		if _, err := s.db.Exec(`INSERT INTO outbox_messages (`+outboxColumns+`)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (id) DO NOTHING`,
+			m.ID, m.Topic, m.Key, string(m.Payload), string(m.Status), m.Attempts, m.LastError,
+			m.CreatedAt, m.NextAttemptAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *OutboxStore) Due(now time.Time, limit int) ([]outbox.Message, error) {
+	// só a mensagem pendente mais antiga de cada chave é elegível
+	return s.query(`SELECT `+outboxColumns+` FROM outbox_messages m
+		WHERE m.status = $1 AND m.next_attempt_at <= $2
+		AND NOT EXISTS (
+			SELECT 1 FROM outbox_messages o
+			WHERE o.msg_key = m.msg_key AND o.status = $1
+			AND (o.created_at < m.created_at OR (o.created_at = m.created_at AND o.id < m.id))
+		)
+		ORDER BY m.created_at, m.id
+		LIMIT $3`, string(outbox.StatusPending), now.UTC(), limit)
+}
+
+func (s *OutboxStore) MarkDelivered(id string) error {
+	return s.exec(`UPDATE outbox_messages SET status = $2 WHERE id = $1`, id, string(outbox.StatusDelivered))
+}
+
+func (s *OutboxStore) MarkRetry(id string, attempts int, next time.Time, lastErr string) error {
+	return s.exec(`UPDATE outbox_messages SET attempts = $2, next_attempt_at = $3, last_error = $4 WHERE id = $1`,
+		id, attempts, next.UTC(), lastErr)
+}
+
+func (s *OutboxStore) MarkDead(id string, attempts int, lastErr string) error {
+	return s.exec(`UPDATE outbox_messages SET status = $2, attempts = $3, last_error = $4 WHERE id = $1`,
+		id, string(outbox.StatusDead), attempts, lastErr)
+}
+
+func (s *OutboxStore) DeadLetters() ([]outbox.Message, error) {
+	return s.query(`SELECT `+outboxColumns+` FROM outbox_messages WHERE status = $1 ORDER BY created_at, id`,
+		string(outbox.StatusDead))
+}
+
+func (s *OutboxStore) Requeue(id string) error {
+	return s.exec(`UPDATE outbox_messages SET status = $2, attempts = 0, next_attempt_at = $3
+		WHERE id = $1 AND status = $4`,
+		id, string(outbox.StatusPending), time.Now().UTC(), string(outbox.StatusDead))
+}
+
+func (s *OutboxStore) exec(query string, args ...any) error {
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("not found")
+	}
+	return nil
+}
+
+func (s *OutboxStore) query(query string, args ...any) ([]outbox.Message, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []outbox.Message
+	for rows.Next() {
+		var (
+			m              outbox.Message
+			payload, state string
+		)
+		if err := rows.Scan(&m.ID, &m.Topic, &m.Key, &payload, &state, &m.Attempts, &m.LastError,
+			&m.CreatedAt, &m.NextAttemptAt); err != nil {
+			return nil, err
+		}
+		m.Payload = []byte(payload)
+		m.Status = outbox.Status(state)
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,396 @@
+package sqlrepo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/outbox"
+)
+
+const paymentColumns = `id, amount, currency, email, status, captured_amount, released_amount,
+	refunded_amount, refunds, amount_changes, history, stripe_payment_intent_id,
+	event_seq, created_at, updated_at, version, description, order_reference, metadata,
+	customer_id, stripe_customer_id, client_confirmation, last_failure, gateway_event_at, dispute_id, dispute_status,
+	authorized_at, expiry_flagged_at, card_bin, card_country, risk,
+	client_ip, card_fingerprint, review, review_requested_at`
+
+// PaymentRepo persiste pagamentos em SQL. Create e Update gravam o estado e
+// os eventos pendentes em outbox_messages na mesma transação.
+type PaymentRepo struct {
+	db *sql.DB
+}
+
+func NewPaymentRepo(db *sql.DB) *PaymentRepo {
+	return &PaymentRepo{db: db}
+}
+
+func (r *PaymentRepo) Create(p *payment.Payment) error {
+	return r.inTx(func(tx *sql.Tx) error {
+		now := time.Now().UTC()
+		p.CreatedAt = now
+		p.UpdatedAt = now
+		p.Version = 1
+		cols, err := paymentArgs(p)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO payments (`+paymentColumns+`)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33, $34, $35)`, cols...); err != nil {
+			if isUniqueViolation(err) {
+				return errors.New("payment already exists")
+			}
+			return err
+		}
+		if err := insertPaymentIntent(tx, p); err != nil {
+			return err
+		}
+		for k, v := range p.Metadata {
+			if _, err := tx.Exec(`INSERT INTO payment_metadata (payment_id, meta_key, meta_value)
+				VALUES ($1, $2, $3)`, p.ID, k, v); err != nil {
+				return err
+			}
+		}
+		return insertOutbox(tx, p)
+	}, p)
+}
+
+// Update só grava se a versão em p ainda for a armazenada; caso contrário
+// devolve *payment.ConflictError.
+func (r *PaymentRepo) Update(p *payment.Payment) error {
+	err := r.inTx(func(tx *sql.Tx) error {
+		p.UpdatedAt = time.Now().UTC()
+		cols, err := paymentArgs(p)
+		if err != nil {
+			return err
+		}
+		// as colunas entre version e last_failure só são gravadas na criação
+		res, err := tx.Exec(`UPDATE payments SET
+			amount = $2, currency = $3, email = $4, status = $5, captured_amount = $6,
+			released_amount = $7, refunded_amount = $8, refunds = $9, amount_changes = $10,
+			history = $11, stripe_payment_intent_id = $12, event_seq = $13,
+			created_at = $14, updated_at = $15, version = $16 + 1, last_failure = $17,
+			gateway_event_at = $18, dispute_id = $19, dispute_status = $20,
+			authorized_at = $21, expiry_flagged_at = $22, card_bin = $23, card_country = $24, risk = $25,
+			client_ip = $26, card_fingerprint = $27, review = $28, review_requested_at = $29
+			WHERE id = $1 AND version = $16`, append(cols[:16:16], cols[22:]...)...)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			var stored int64
+			if err := tx.QueryRow(`SELECT version FROM payments WHERE id = $1`, p.ID).Scan(&stored); err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return errors.New("not found")
+				}
+				return err
+			}
+			return &payment.ConflictError{ID: p.ID, Expected: p.Version, Actual: stored}
+		}
+		if err := insertPaymentIntent(tx, p); err != nil {
+			return err
+		}
+		return insertOutbox(tx, p)
+	}, p)
+	if err != nil {
+		return err
+	}
+	p.Version++
+	return nil
+}
+
+func (r *PaymentRepo) Get(id string) (*payment.Payment, error) {
+	return scanPayment(r.db.QueryRow(`SELECT `+paymentColumns+` FROM payments WHERE id = $1`, id))
+}
+
+// GetByPaymentIntent também acha o pagamento por um PaymentIntent já
+// substituído numa reautorização.
+func (r *PaymentRepo) GetByPaymentIntent(piID string) (*payment.Payment, error) {
+	return scanPayment(r.db.QueryRow(`SELECT `+paymentColumns+` FROM payments
+		WHERE id = (SELECT payment_id FROM payment_intents WHERE payment_intent_id = $1)`, piID))
+}
+
+func (r *PaymentRepo) History(id string) ([]payment.Transition, error) {
+	p, err := r.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return p.History, nil
+}
+
+// List monta o WHERE a partir dos filtros de q e busca um item a mais que o
+// tamanho da página para saber se há próxima.
+func (r *PaymentRepo) List(q payment.Query) (payment.Page, error) {
+	var (
+		where []string
+		args  []any
+	)
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, strings.ReplaceAll(cond, "?", fmt.Sprintf("$%d", len(args))))
+	}
+	if len(q.Statuses) > 0 {
+		in := make([]string, len(q.Statuses))
+		for i, st := range q.Statuses {
+			args = append(args, string(st))
+			in[i] = fmt.Sprintf("$%d", len(args))
+		}
+		where = append(where, "status IN ("+strings.Join(in, ", ")+")")
+	}
+	if q.Email != "" {
+		add("email = ?", q.Email)
+	}
+	if q.Currency != "" {
+		add("currency = ?", q.Currency)
+	}
+	if q.OrderReference != "" {
+		add("order_reference = ?", q.OrderReference)
+	}
+	if q.CustomerID != "" {
+		add("customer_id = ?", q.CustomerID)
+	}
+	for k, v := range q.Metadata {
+		args = append(args, k, v)
+		where = append(where, fmt.Sprintf(`EXISTS (SELECT 1 FROM payment_metadata m
+			WHERE m.payment_id = payments.id AND m.meta_key = $%d AND m.meta_value = $%d)`, len(args)-1, len(args)))
+	}
+	if q.MinAmount > 0 {
+		add("amount >= ?", q.MinAmount)
+	}
+	if q.MaxAmount > 0 {
+		add("amount <= ?", q.MaxAmount)
+	}
+	if !q.CreatedFrom.IsZero() {
+		add("created_at >= ?", q.CreatedFrom.UTC())
+	}
+	if !q.CreatedTo.IsZero() {
+		add("created_at < ?", q.CreatedTo.UTC())
+	}
+	if !q.AuthorizedBefore.IsZero() {
+		add("authorized_at < ?", q.AuthorizedBefore.UTC())
+	}
+	if !q.ReviewRequestedBefore.IsZero() {
+		add("review_requested_at < ?", q.ReviewRequestedBefore.UTC())
+	}
+	if q.Cursor != "" {
+		add("id < ?", q.Cursor)
+	}
+
+	query := `SELECT ` + paymentColumns + ` FROM payments`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	size := q.PageSize()
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT %d", size+1)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return payment.Page{}, err
+	}
+	defer rows.Close()
+	page := payment.Page{Items: []*payment.Payment{}}
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return payment.Page{}, err
+		}
+		page.Items = append(page.Items, p)
+	}
+	if err := rows.Err(); err != nil {
+		return payment.Page{}, err
+	}
+	if len(page.Items) > size {
+		page.Items = page.Items[:size]
+		page.NextCursor = page.Items[size-1].ID
+	}
+	return page, nil
+}
+
+// inTx executa fn numa transação e, após o commit, descarta os eventos
+// pendentes de p (já gravados no outbox).
+func (r *PaymentRepo) inTx(fn func(tx *sql.Tx) error, p *payment.Payment) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	p.ClearPendingEvents()
+	return nil
+}
+
+// insertPaymentIntent registra o PaymentIntent vigente de p; os anteriores
+// continuam na tabela.
+func insertPaymentIntent(tx *sql.Tx, p *payment.Payment) error {
+	if p.StripePaymentIntentID == "" {
+		return nil
+	}
+	_, err := tx.Exec(`INSERT INTO payment_intents (payment_intent_id, payment_id) VALUES ($1, $2)
+		ON CONFLICT (payment_intent_id) DO NOTHING`, p.StripePaymentIntentID, p.ID)
+	return err
+}
+
+func insertOutbox(tx *sql.Tx, p *payment.Payment) error {
+	msgs, err := outbox.FromEvents(p.PendingEvents())
+	if err != nil {
+		return err
+	}
+	return insertMessages(tx, msgs)
+}
+
+func insertMessages(tx *sql.Tx, msgs []outbox.Message) error {
+	for _, m := range msgs {
+		if _, err := tx.Exec(`INSERT INTO outbox_messages
+			(id, topic, msg_key, payload, status, attempts, last_error, created_at, next_attempt_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			m.ID, m.Topic, m.Key, string(m.Payload), string(m.Status), m.Attempts, m.LastError,
+			m.CreatedAt, m.NextAttemptAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func paymentArgs(p *payment.Payment) ([]any, error) {
+	refunds, err := json.Marshal(nonNil(p.Refunds))
+	if err != nil {
+		return nil, err
+	}
+	changes, err := json.Marshal(nonNil(p.AmountChanges))
+	if err != nil {
+		return nil, err
+	}
+	history, err := json.Marshal(nonNil(p.History))
+	if err != nil {
+		return nil, err
+	}
+	metadata := p.Metadata
+	if metadata == nil {
+		metadata = payment.Metadata{}
+	}
+	md, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	var failure []byte
+	if p.LastFailure != nil {
+		if failure, err = json.Marshal(p.LastFailure); err != nil {
+			return nil, err
+		}
+	}
+	var riskDecision []byte
+	if p.Risk != nil {
+		if riskDecision, err = json.Marshal(p.Risk); err != nil {
+			return nil, err
+		}
+	}
+	var review []byte
+	var reviewRequestedAt time.Time
+	if p.Review != nil {
+		if review, err = json.Marshal(p.Review); err != nil {
+			return nil, err
+		}
+		reviewRequestedAt = p.Review.RequestedAt
+	}
+	var pi sql.NullString
+	if p.StripePaymentIntentID != "" {
+		pi = sql.NullString{String: p.StripePaymentIntentID, Valid: true}
+	}
+	return []any{
+		p.ID, p.Amount, p.Currency, p.Email, string(p.Status), p.CapturedAmount, p.ReleasedAmount,
+		p.RefundedAmount, string(refunds), string(changes), string(history), pi,
+		p.EventSeq, p.CreatedAt.UTC(), p.UpdatedAt.UTC(), p.Version,
+		p.Description, p.OrderReference, string(md), p.CustomerID, p.StripeCustomerID,
+		p.ClientConfirmation, string(failure), nullTime(p.GatewayEventAt), p.DisputeID, p.DisputeStatus,
+		nullTime(p.AuthorizedAt), nullTime(p.ExpiryFlaggedAt), p.CardBIN, p.CardCountry, string(riskDecision),
+		p.ClientIP, p.CardFingerprint, string(review), nullTime(reviewRequestedAt),
+	}, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPayment(row scanner) (*payment.Payment, error) {
+	var (
+		p                         payment.Payment
+		status                    string
+		refunds, changes, history string
+		metadata, failure, risk   string
+		review                    string
+		reviewRequestedAt         sql.NullTime
+		pi                        sql.NullString
+		gatewayAt                 sql.NullTime
+		authorizedAt, flaggedAt   sql.NullTime
+	)
+	err := row.Scan(&p.ID, &p.Amount, &p.Currency, &p.Email, &status, &p.CapturedAmount, &p.ReleasedAmount,
+		&p.RefundedAmount, &refunds, &changes, &history, &pi,
+		&p.EventSeq, &p.CreatedAt, &p.UpdatedAt, &p.Version,
+		&p.Description, &p.OrderReference, &metadata, &p.CustomerID, &p.StripeCustomerID,
+		&p.ClientConfirmation, &failure, &gatewayAt, &p.DisputeID, &p.DisputeStatus,
+		&authorizedAt, &flaggedAt, &p.CardBIN, &p.CardCountry, &risk,
+		&p.ClientIP, &p.CardFingerprint, &review, &reviewRequestedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.Status = payment.Status(status)
+	p.StripePaymentIntentID = pi.String
+	p.GatewayEventAt = gatewayAt.Time
+	p.AuthorizedAt = authorizedAt.Time
+	p.ExpiryFlaggedAt = flaggedAt.Time
+	if err := json.Unmarshal([]byte(refunds), &p.Refunds); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(changes), &p.AmountChanges); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(history), &p.History); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(metadata), &p.Metadata); err != nil {
+		return nil, err
+	}
+	if len(p.Metadata) == 0 {
+		p.Metadata = nil
+	}
+	if failure != "" {
+		if err := json.Unmarshal([]byte(failure), &p.LastFailure); err != nil {
+			return nil, err
+		}
+	}
+	if risk != "" {
+		if err := json.Unmarshal([]byte(risk), &p.Risk); err != nil {
+			return nil, err
+		}
+	}
+	if review != "" {
+		if err := json.Unmarshal([]byte(review), &p.Review); err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+func isUniqueViolation(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "unique constraint") || strings.Contains(msg, "duplicate key")
+}
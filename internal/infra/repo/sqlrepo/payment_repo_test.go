@@ -0,0 +1,185 @@
+package sqlrepo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+)
+
+func newPayment(t *testing.T, id string, md payment.Metadata) *payment.Payment {
+	t.Helper()
+	p, err := payment.New(id, payment.Money{Amount: 5000, Currency: "brl"}, "buyer@example.com",
+		payment.Details{Metadata: md, OrderReference: "order-" + id, ClientIP: "203.0.113.7"},
+		payment.Origin{Source: payment.SourceAPI, RequestID: "req_1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func countOutbox(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM outbox_messages`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestPaymentRepoRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPaymentRepo(db)
+
+	p := newPayment(t, "pay_1", payment.Metadata{"cart_id": "c_1"})
+	if err := repo.Create(p); err != nil {
+		t.Fatal(err)
+	}
+	steps := []func() error{
+		func() error { return p.MarkAuthorized("pi_1") },
+		func() error { return p.ChangeAmount(7000, payment.AmountChangeReauthorization, "pi_2") },
+		func() error { return p.MarkCaptured(6000) },
+		func() error {
+			return p.AddRefund(payment.Refund{ID: "ref_1", Amount: 1000, StripeRefundID: "re_1", CreatedAt: time.Now().UTC()})
+		},
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if err := repo.Update(p); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+
+	got, err := repo.Get("pay_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(p)
+	if string(gotJSON) != string(wantJSON) {
+		t.Fatalf("stored payment differs:\n got %s\nwant %s", gotJSON, wantJSON)
+	}
+	if got.Version != 5 || len(got.History) != len(p.History) {
+		t.Fatalf("version = %d, history = %d, want 5 and %d", got.Version, len(got.History), len(p.History))
+	}
+	// o PaymentIntent substituído na reautorização continua indexado
+	for _, pi := range []string{"pi_1", "pi_2"} {
+		if byPI, err := repo.GetByPaymentIntent(pi); err != nil || byPI.ID != "pay_1" {
+			t.Fatalf("GetByPaymentIntent(%s) = %v, %v", pi, byPI, err)
+		}
+	}
+	if _, err := repo.Get("pay_2"); err == nil {
+		t.Fatal("Get of a missing payment must fail")
+	}
+}
+
+func TestPaymentRepoRejectsStaleUpdate(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPaymentRepo(db)
+	if err := repo.Create(newPayment(t, "pay_1", nil)); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := repo.Get("pay_1")
+	b, _ := repo.Get("pay_1")
+
+	if err := a.MarkAuthorized("pi_1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Update(a); err != nil {
+		t.Fatal(err)
+	}
+	before := countOutbox(t, db)
+
+	if err := b.MarkCanceled(); err != nil {
+		t.Fatal(err)
+	}
+	err := repo.Update(b)
+	var conflict *payment.ConflictError
+	if !errors.As(err, &conflict) || conflict.Expected != 1 || conflict.Actual != 2 {
+		t.Fatalf("err = %v, want a conflict between versions 1 and 2", err)
+	}
+	// a transação inteira é desfeita: nem o estado nem o outbox mudam
+	stored, _ := repo.Get("pay_1")
+	if stored.Status != payment.StatusAuthorized || stored.Version != 2 {
+		t.Fatalf("stored status = %s, version = %d", stored.Status, stored.Version)
+	}
+	if after := countOutbox(t, db); after != before {
+		t.Fatalf("outbox messages = %d, want %d after the rejected update", after, before)
+	}
+	if len(b.PendingEvents()) == 0 {
+		t.Fatal("pending events of the rejected update must be kept")
+	}
+}
+
+func TestPaymentRepoWritesOutboxWithState(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPaymentRepo(db)
+	p := newPayment(t, "pay_1", nil)
+	if err := repo.Create(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.MarkAuthorized("pi_1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Update(p); err != nil {
+		t.Fatal(err)
+	}
+	if n := countOutbox(t, db); n != int(p.EventSeq) {
+		t.Fatalf("outbox messages = %d, want one per event (%d)", n, p.EventSeq)
+	}
+	if len(p.PendingEvents()) != 0 {
+		t.Fatal("pending events must be cleared after the write")
+	}
+	if err := repo.Create(newPayment(t, "pay_1", nil)); err == nil {
+		t.Fatal("creating a duplicate payment must fail")
+	}
+}
+
+func TestPaymentRepoListPaginatesWithFilters(t *testing.T) {
+	repo := NewPaymentRepo(openTestDB(t))
+	for i := range 5 {
+		md := payment.Metadata{"channel": "web"}
+		if i%2 == 1 {
+			md = payment.Metadata{"channel": "app"}
+		}
+		if err := repo.Create(newPayment(t, fmt.Sprintf("pay_%d", i), md)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	q := payment.Query{Metadata: payment.Metadata{"channel": "web"}, Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("pagination did not stop")
+		}
+		page, err := repo.List(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range page.Items {
+			got = append(got, p.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	if fmt.Sprint(got) != "[pay_4 pay_2 pay_0]" {
+		t.Fatalf("items = %v, want the web payments newest first", got)
+	}
+
+	page, err := repo.List(payment.Query{OrderReference: "order-pay_3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 1 || page.Items[0].ID != "pay_3" || page.NextCursor != "" {
+		t.Fatalf("order reference page = %+v", page)
+	}
+}
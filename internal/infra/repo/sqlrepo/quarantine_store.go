@@ -0,0 +1,131 @@
+package sqlrepo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/app/cardtesting"
+)
+
+const quarantineColumns = `id, kind, value, action, reason, attempts, declines, created_at, expires_at,
+	released_at, released_by, release_note`
+
+// QuarantineStore implementa cardtesting.Store na tabela quarantines.
+type QuarantineStore struct {
+	db *sql.DB
+}
+
+func NewQuarantineStore(db *sql.DB) *QuarantineStore {
+	return &QuarantineStore{db: db}
+}
+
+func (s *QuarantineStore) Create(q *cardtesting.Quarantine) error {
+	var released sql.NullTime
+	if q.ReleasedAt != nil {
+		released = nullTime(*q.ReleasedAt)
+	}
+	_, err := s.db.Exec(`INSERT INTO quarantines (`+quarantineColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		q.ID, string(q.Kind), q.Value, string(q.Action), q.Reason, q.Attempts, q.Declines,
+		q.CreatedAt.UTC(), q.ExpiresAt.UTC(), released, q.ReleasedBy, q.ReleaseNote)
+	return err
+}
+
+func (s *QuarantineStore) Get(id string) (*cardtesting.Quarantine, error) {
+	return scanQuarantine(s.db.QueryRow(`SELECT `+quarantineColumns+` FROM quarantines WHERE id = $1`, id))
+}
+
+func (s *QuarantineStore) Active(kind cardtesting.Kind, value string, now time.Time) (*cardtesting.Quarantine, error) {
+	out, err := s.List(cardtesting.Query{ActiveAt: now, Kind: kind, Value: value, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, cardtesting.ErrNotFound
+	}
+	return out[0], nil
+}
+
+func (s *QuarantineStore) Release(id, by, note string, at time.Time) (*cardtesting.Quarantine, error) {
+	res, err := s.db.Exec(`UPDATE quarantines SET released_at = $2, released_by = $3, release_note = $4
+		WHERE id = $1 AND released_at IS NULL`, id, at.UTC(), by, note)
+	if err != nil {
+		return nil, err
+	}
+	q, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, cardtesting.ErrReleased
+	}
+	return q, nil
+}
+
+func (s *QuarantineStore) List(q cardtesting.Query) ([]*cardtesting.Quarantine, error) {
+	var (
+		where []string
+		args  []any
+	)
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, strings.ReplaceAll(cond, "?", fmt.Sprintf("$%d", len(args))))
+	}
+	if !q.ActiveAt.IsZero() {
+		add("released_at IS NULL AND expires_at > ?", q.ActiveAt.UTC())
+	}
+	if q.Kind != "" {
+		add("kind = ?", string(q.Kind))
+	}
+	if q.Value != "" {
+		add("value = ?", q.Value)
+	}
+	query := `SELECT ` + quarantineColumns + ` FROM quarantines`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*cardtesting.Quarantine{}
+	for rows.Next() {
+		x, err := scanQuarantine(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, x)
+	}
+	return out, rows.Err()
+}
+
+func scanQuarantine(row scanner) (*cardtesting.Quarantine, error) {
+	var (
+		q            cardtesting.Quarantine
+		kind, action string
+		released     sql.NullTime
+	)
+	err := row.Scan(&q.ID, &kind, &q.Value, &action, &q.Reason, &q.Attempts, &q.Declines,
+		&q.CreatedAt, &q.ExpiresAt, &released, &q.ReleasedBy, &q.ReleaseNote)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, cardtesting.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	q.Kind = cardtesting.Kind(kind)
+	q.Action = cardtesting.Action(action)
+	if released.Valid {
+		t := released.Time
+		q.ReleasedAt = &t
+	}
+	return &q, nil
+}
@@ -0,0 +1,108 @@
+package riskrules
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/risk"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/velocity"
+	"go.uber.org/zap"
+)
+
+// Engine soma ao motor de regras do ambiente as regras do arquivo e recarrega
+// o arquivo em SIGHUP ou quando ele muda, sem reiniciar. Um arquivo inválido
+// é rejeitado e o conjunto anterior continua valendo.
+type Engine struct {
+	zl       *zap.Logger
+	base     *risk.Engine
+	counter  *velocity.Counter
+	path     string
+	interval time.Duration
+
+	rs atomic.Pointer[Ruleset]
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// NewEngine carrega o arquivo em path; falha se ele for inválido. counter é
+// o das regras de velocidade do base, consultado pelas condições velocity.
+func NewEngine(zl *zap.Logger, base *risk.Engine, counter *velocity.Counter, path string, interval time.Duration) (*Engine, error) {
+	e := &Engine{zl: zl, base: base, counter: counter, path: path, interval: interval}
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Engine) Evaluate(ctx context.Context, in risk.Input) risk.Decision {
+	d := e.base.Evaluate(ctx, in)
+	e.rs.Load().Apply(&d, in, e.counter)
+	return d
+}
+
+// Version é a versão do conjunto de regras ativo.
+func (e *Engine) Version() string { return e.rs.Load().Version }
+
+// Reload lê e valida o arquivo e, se válido, passa a usá-lo.
+func (e *Engine) Reload() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if fi, err := os.Stat(e.path); err == nil {
+		// registra mesmo se o arquivo for inválido, para não relogar o erro
+		// a cada verificação
+		e.modTime, e.size = fi.ModTime(), fi.Size()
+	}
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		return err
+	}
+	rs, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	e.rs.Store(rs)
+	e.zl.Info("risk_rules_loaded", zap.String("path", e.path), zap.String("version", rs.Version), zap.Int("rules", len(rs.rules)))
+	return nil
+}
+
+// changed informa se o arquivo mudou desde a última leitura.
+func (e *Engine) changed() bool {
+	fi, err := os.Stat(e.path)
+	if err != nil {
+		return false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return !fi.ModTime().Equal(e.modTime) || fi.Size() != e.size
+}
+
+// Run recarrega o arquivo em SIGHUP e quando a data de modificação ou o
+// tamanho mudam, verificados a cada interval.
+func (e *Engine) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	t := time.NewTicker(e.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-t.C:
+			if !e.changed() {
+				continue
+			}
+		}
+		if err := e.Reload(); err != nil {
+			e.zl.Error("risk_rules_reload_failed", zap.String("path", e.path), zap.String("version", e.Version()), zap.String("err", err.Error()))
+		}
+	}
+}
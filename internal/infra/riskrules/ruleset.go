@@ -0,0 +1,178 @@
+package riskrules
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/risk"
+	"github.com/williamkoller/golang-payment-stripe/internal/infra/velocity"
+	"gopkg.in/yaml.v3"
+)
+
+// File é o formato do arquivo de regras (YAML; JSON também é aceito).
+type File struct {
+	Version string     `yaml:"version"`
+	Rules   []RuleSpec `yaml:"rules"`
+}
+
+// RuleSpec é uma regra declarativa: se todas as condições de When valem,
+// aplica Action.
+type RuleSpec struct {
+	Name    string       `yaml:"name"`
+	Action  risk.Outcome `yaml:"action"`
+	Message string       `yaml:"message"`
+	When    Conditions   `yaml:"when"`
+}
+
+type Conditions struct {
+	Currency    []string          `yaml:"currency"`
+	AmountGT    *int64            `yaml:"amount_gt"` // unidade menor da moeda
+	AmountLT    *int64            `yaml:"amount_lt"`
+	EmailDomain []string          `yaml:"email_domain"`
+	Metadata    map[string]string `yaml:"metadata"` // todos os pares precisam coincidir
+	Velocity    *VelocityCond     `yaml:"velocity"`
+}
+
+// VelocityCond compara a janela de VELOCITY_WINDOW da dimensão (email, ip,
+// card) com os limites; a soma é na moeda do pagamento.
+type VelocityCond struct {
+	Dimension string `yaml:"dimension"`
+	CountGT   int    `yaml:"count_gt"`
+	SumGT     int64  `yaml:"sum_gt"`
+}
+
+// Ruleset é um arquivo de regras validado.
+type Ruleset struct {
+	Version string
+	rules   []RuleSpec
+}
+
+// Parse lê e valida um arquivo de regras. Sem "version", a versão é o
+// início do sha256 do conteúdo.
+func Parse(data []byte) (*Ruleset, error) {
+	var f File
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("risk rules: %w", err)
+	}
+	if f.Version == "" {
+		sum := sha256.Sum256(data)
+		f.Version = "sha256:" + hex.EncodeToString(sum[:6])
+	}
+
+	var errs []error
+	seen := make(map[string]bool, len(f.Rules))
+	for i := range f.Rules {
+		r := &f.Rules[i]
+		if err := r.normalize(); err != nil {
+			errs = append(errs, fmt.Errorf("rules[%d] %s: %w", i, r.Name, err))
+			continue
+		}
+		if seen[r.Name] {
+			errs = append(errs, fmt.Errorf("rules[%d] %s: duplicate name", i, r.Name))
+		}
+		seen[r.Name] = true
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("risk rules: %w", err)
+	}
+	return &Ruleset{Version: f.Version, rules: f.Rules}, nil
+}
+
+// normalize valida a regra e padroniza moedas e domínios em minúsculas.
+func (r *RuleSpec) normalize() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	if !r.Action.Valid() {
+		return fmt.Errorf("action must be allow, review or deny, got %q", r.Action)
+	}
+	c := &r.When
+	if len(c.Currency) == 0 && c.AmountGT == nil && c.AmountLT == nil && len(c.EmailDomain) == 0 && len(c.Metadata) == 0 && c.Velocity == nil {
+		return errors.New("when needs at least one condition")
+	}
+	for i, cur := range c.Currency {
+		if _, ok := payment.LookupCurrency(payment.Currency(cur)); !ok {
+			return fmt.Errorf("invalid currency %q", cur)
+		}
+		c.Currency[i] = strings.ToLower(cur)
+	}
+	for i, d := range c.EmailDomain {
+		c.EmailDomain[i] = strings.ToLower(strings.TrimPrefix(d, "@"))
+	}
+	if (c.AmountGT != nil && *c.AmountGT < 0) || (c.AmountLT != nil && *c.AmountLT <= 0) {
+		return errors.New("amount bounds must be positive")
+	}
+	if c.AmountGT != nil && c.AmountLT != nil && *c.AmountGT >= *c.AmountLT {
+		return errors.New("amount_gt must be less than amount_lt")
+	}
+	if v := c.Velocity; v != nil {
+		if !slices.Contains(velocity.Dimensions, v.Dimension) {
+			return fmt.Errorf("velocity dimension must be one of %v, got %q", velocity.Dimensions, v.Dimension)
+		}
+		if v.CountGT <= 0 && v.SumGT <= 0 {
+			return errors.New("velocity needs count_gt or sum_gt")
+		}
+	}
+	return nil
+}
+
+// Apply avalia as regras em ordem sobre in e acrescenta as objeções a d.
+// Uma regra allow que casa encerra a avaliação do arquivo: funciona como
+// exceção às regras seguintes, não às do ambiente.
+func (rs *Ruleset) Apply(d *risk.Decision, in risk.Input, c *velocity.Counter) {
+	d.Version = rs.Version
+	for _, r := range rs.rules {
+		if !r.When.match(in, c) {
+			continue
+		}
+		if r.Action == risk.Allow {
+			return
+		}
+		msg := r.Message
+		if msg == "" {
+			msg = "matched rule " + r.Name
+		}
+		d.Add(risk.Reason{Rule: r.Name, Outcome: r.Action, Message: msg})
+	}
+}
+
+func (c Conditions) match(in risk.Input, vc *velocity.Counter) bool {
+	if len(c.Currency) > 0 && !slices.Contains(c.Currency, strings.ToLower(in.Currency)) {
+		return false
+	}
+	if c.AmountGT != nil && in.Amount <= *c.AmountGT {
+		return false
+	}
+	if c.AmountLT != nil && in.Amount >= *c.AmountLT {
+		return false
+	}
+	if len(c.EmailDomain) > 0 {
+		_, domain, _ := strings.Cut(strings.ToLower(in.Email), "@")
+		if !slices.Contains(c.EmailDomain, domain) {
+			return false
+		}
+	}
+	for k, v := range c.Metadata {
+		if got, ok := in.Metadata[k]; !ok || got != v {
+			return false
+		}
+	}
+	if v := c.Velocity; v != nil {
+		if vc == nil {
+			return false
+		}
+		st := velocity.Lookup(vc, v.Dimension, in)
+		if (v.CountGT <= 0 || st.Count <= v.CountGT) && (v.SumGT <= 0 || st.Sum <= v.SumGT) {
+			return false
+		}
+	}
+	return true
+}
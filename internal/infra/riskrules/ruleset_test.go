@@ -0,0 +1,168 @@
+package riskrules
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/risk"
+)
+
+func TestParseRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"missing name", `
+rules:
+  - action: deny
+    when: {currency: [brl]}`, "name is required"},
+		{"unknown action", `
+rules:
+  - name: r1
+    action: block
+    when: {currency: [brl]}`, "action must be allow, review or deny"},
+		{"no conditions", `
+rules:
+  - name: r1
+    action: deny
+    when: {}`, "at least one condition"},
+		{"unknown currency", `
+rules:
+  - name: r1
+    action: deny
+    when: {currency: [xyz]}`, `invalid currency "xyz"`},
+		{"negative bound", `
+rules:
+  - name: r1
+    action: deny
+    when: {amount_lt: 0}`, "amount bounds must be positive"},
+		{"inverted bounds", `
+rules:
+  - name: r1
+    action: review
+    when: {amount_gt: 1000, amount_lt: 500}`, "amount_gt must be less than amount_lt"},
+		{"unknown velocity dimension", `
+rules:
+  - name: r1
+    action: review
+    when: {velocity: {dimension: phone, count_gt: 3}}`, "velocity dimension must be one of"},
+		{"velocity without limits", `
+rules:
+  - name: r1
+    action: review
+    when: {velocity: {dimension: email}}`, "velocity needs count_gt or sum_gt"},
+		{"duplicate name", `
+rules:
+  - name: r1
+    action: review
+    when: {currency: [brl]}
+  - name: r1
+    action: deny
+    when: {currency: [usd]}`, "rules[1] r1: duplicate name"},
+		{"unknown field", `
+rules:
+  - name: r1
+    action: deny
+    when: {amount_gte: 10}`, "amount_gte"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseReportsEveryInvalidRule(t *testing.T) {
+	_, err := Parse([]byte(`
+rules:
+  - name: r1
+    action: block
+    when: {currency: [brl]}
+  - name: r2
+    action: deny
+    when: {}`))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"rules[0] r1", "rules[1] r2"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error = %q, want it to mention %q", err, want)
+		}
+	}
+}
+
+func TestParseNormalizesAndVersions(t *testing.T) {
+	data := []byte(`
+rules:
+  - name: big-brl
+    action: review
+    when: {currency: [BRL], email_domain: ["@Example.COM"], amount_gt: 10000}`)
+	rs, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(rs.Version, "sha256:") {
+		t.Fatalf("version = %q, want a content hash", rs.Version)
+	}
+	again, _ := Parse(data)
+	if again.Version != rs.Version {
+		t.Fatalf("version changed between parses: %q != %q", again.Version, rs.Version)
+	}
+
+	var d risk.Decision
+	rs.Apply(&d, risk.Input{Amount: 20000, Currency: "brl", Email: "buyer@example.com"}, nil)
+	if d.Outcome != risk.Review || len(d.Reasons) != 1 || d.Reasons[0].Rule != "big-brl" {
+		t.Fatalf("decision = %+v, want review by big-brl", d)
+	}
+	if d.Version != rs.Version {
+		t.Fatalf("decision version = %q, want %q", d.Version, rs.Version)
+	}
+}
+
+func TestParseKeepsExplicitVersion(t *testing.T) {
+	rs, err := Parse([]byte(`
+version: "2024-06-01"
+rules:
+  - name: r1
+    action: deny
+    when: {metadata: {channel: test}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Version != "2024-06-01" {
+		t.Fatalf("version = %q, want 2024-06-01", rs.Version)
+	}
+}
+
+func TestApplyAllowStopsEvaluation(t *testing.T) {
+	rs, err := Parse([]byte(`
+rules:
+  - name: vip
+    action: allow
+    when: {metadata: {tier: vip}}
+  - name: big
+    action: deny
+    when: {amount_gt: 1000}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var vip risk.Decision
+	rs.Apply(&vip, risk.Input{Amount: 5000, Currency: "usd", Metadata: map[string]string{"tier": "vip"}}, nil)
+	if len(vip.Reasons) != 0 {
+		t.Fatalf("vip decision = %+v, want no objections", vip)
+	}
+
+	var other risk.Decision
+	rs.Apply(&other, risk.Input{Amount: 5000, Currency: "usd"}, nil)
+	if other.Outcome != risk.Deny {
+		t.Fatalf("decision = %+v, want deny", other)
+	}
+}
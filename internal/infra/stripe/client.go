@@ -3,14 +3,18 @@ package stripeinfra
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/sony/gobreaker"
 	"github.com/stripe/stripe-go/v76"
 	"github.com/stripe/stripe-go/v76/paymentintent"
+	"github.com/stripe/stripe-go/v76/paymentmethod"
 	"github.com/stripe/stripe-go/v76/refund"
 	"github.com/stripe/stripe-go/v76/webhook"
 	"github.com/williamkoller/golang-payment-stripe/internal/app/ports"
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/payment"
 	"github.com/williamkoller/golang-payment-stripe/internal/infra/config"
 	"go.uber.org/zap"
 )
@@ -21,7 +25,7 @@ type client struct {
 	breaker *gobreaker.CircuitBreaker
 }
 
-func NewClient(cfg *config.Config, zl *zap.Logger) ports.PaymentGateway {
+func NewClient(cfg *config.Config, zl *zap.Logger) ports.Gateway {
 	stripe.Key = cfg.StripeSecretKey
 	st := gobreaker.Settings{
 		Name:        "stripe",
@@ -35,60 +39,205 @@ func NewClient(cfg *config.Config, zl *zap.Logger) ports.PaymentGateway {
 	return &client{zl: zl, cfg: cfg, breaker: gobreaker.NewCircuitBreaker(st)}
 }
 
-func (c *client) AuthorizeManual(ctx context.Context, idemKey string, amount int64, currency, email string, useTest bool, testPM string) (string, string, error) {
+// AuthorizeManual cria o PaymentIntent com captura manual. Confirmado pela
+// API, não aceita métodos com redirect; sem confirmação, o frontend confirma
+// com o client_secret e pode passar por 3-D Secure ou redirects.
+func (c *client) AuthorizeManual(ctx context.Context, in ports.AuthorizeInput) (ports.AuthorizeResult, error) {
 	if c.cfg.StripeSecretKey == "" {
-		return "", "", errors.New("stripe secret key not configured")
+		return ports.AuthorizeResult{}, errors.New("stripe secret key not configured")
 	}
 	res, err := c.exec(ctx, func() (any, error) {
 		params := &stripe.PaymentIntentParams{
-			Amount:        stripe.Int64(amount),
-			Currency:      stripe.String(currency),
-			ReceiptEmail:  stripe.String(email),
+			Amount:        stripe.Int64(in.Amount),
+			Currency:      stripe.String(in.Currency),
+			ReceiptEmail:  stripe.String(in.Email),
 			CaptureMethod: stripe.String(string(stripe.PaymentIntentCaptureMethodManual)),
-			Confirm:       stripe.Bool(true),
 			AutomaticPaymentMethods: &stripe.PaymentIntentAutomaticPaymentMethodsParams{
-				Enabled:        stripe.Bool(true),
-				AllowRedirects: stripe.String(string(stripe.PaymentIntentAutomaticPaymentMethodsAllowRedirectsNever)),
+				Enabled: stripe.Bool(true),
+			},
+			PaymentMethodOptions: &stripe.PaymentIntentPaymentMethodOptionsParams{
+				Card: &stripe.PaymentIntentPaymentMethodOptionsCardParams{
+					RequestIncrementalAuthorization: stripe.String(string(stripe.PaymentIntentPaymentMethodOptionsCardRequestIncrementalAuthorizationIfAvailable)),
+				},
 			},
 		}
 
-		if useTest {
-			params.PaymentMethod = stripe.String(testPM)
+		if in.Customer != "" {
+			params.Customer = stripe.String(in.Customer)
+		}
+		if in.Description != "" {
+			params.Description = stripe.String(in.Description)
+		}
+		for k, v := range in.Metadata {
+			params.AddMetadata(k, v)
 		}
 
-		params.SetIdempotencyKey(idemKey)
+		if in.Confirm {
+			params.Confirm = stripe.Bool(true)
+			params.AutomaticPaymentMethods.AllowRedirects = stripe.String(string(stripe.PaymentIntentAutomaticPaymentMethodsAllowRedirectsNever))
+			switch {
+			case in.PaymentMethod != "":
+				params.PaymentMethod = stripe.String(in.PaymentMethod)
+			case in.UseTestPM:
+				params.PaymentMethod = stripe.String(in.TestPM)
+			}
+			if in.OffSession {
+				params.OffSession = stripe.Bool(true)
+			}
+		}
+
+		params.SetIdempotencyKey(in.IdemKey)
 
 		return paymentintent.New(params)
 	})
+	var se *stripe.Error
+	if errors.As(err, &se) && se.Type == stripe.ErrorTypeCard {
+		return ports.AuthorizeResult{}, fmt.Errorf("%w: %s", ports.ErrCardDeclined, se.Msg)
+	}
 	if err != nil {
-		return "", "", err
+		return ports.AuthorizeResult{}, err
 	}
 
 	pi := res.(*stripe.PaymentIntent)
-	return pi.ID, pi.ClientSecret, nil
+	return ports.AuthorizeResult{
+		PaymentIntentID: pi.ID,
+		ClientSecret:    pi.ClientSecret,
+		Status:          ports.IntentStatus(pi.Status),
+	}, nil
 }
 
-func (c *client) Capture(ctx context.Context, piID string) error {
-	_, err := c.exec(ctx, func() (any, error) {
-		return paymentintent.Capture(piID, &stripe.PaymentIntentCaptureParams{})
+// IncrementAuthorization eleva a autorização para amount. Retorna
+// ports.ErrIncrementalAuthUnsupported quando o cartão não suporta o recurso.
+func (c *client) IncrementAuthorization(ctx context.Context, idemKey, piID string, amount int64) error {
+	res, err := c.exec(ctx, func() (any, error) {
+		params := &stripe.PaymentIntentParams{}
+		params.AddExpand("latest_charge")
+		return paymentintent.Get(piID, params)
+	})
+	if err != nil {
+		return err
+	}
+	pi := res.(*stripe.PaymentIntent)
+	if !incrementAvailable(pi) {
+		return ports.ErrIncrementalAuthUnsupported
+	}
+
+	_, err = c.exec(ctx, func() (any, error) {
+		params := &stripe.PaymentIntentIncrementAuthorizationParams{Amount: stripe.Int64(amount)}
+		params.SetIdempotencyKey(idemKey)
+		return paymentintent.IncrementAuthorization(piID, params)
 	})
 	return err
 }
 
-func (c *client) Cancel(ctx context.Context, piID string) error {
+func incrementAvailable(pi *stripe.PaymentIntent) bool {
+	if pi.LatestCharge == nil || pi.LatestCharge.PaymentMethodDetails == nil {
+		return false
+	}
+	card := pi.LatestCharge.PaymentMethodDetails.Card
+	return card != nil && card.IncrementalAuthorization != nil &&
+		card.IncrementalAuthorization.Status == stripe.ChargePaymentMethodDetailsCardIncrementalAuthorizationStatusAvailable
+}
+
+// Capture captura amount do PaymentIntent; amount == 0 captura o valor autorizado.
+func (c *client) Capture(ctx context.Context, idemKey, piID string, amount int64) error {
 	_, err := c.exec(ctx, func() (any, error) {
-		return paymentintent.Cancel(piID, &stripe.PaymentIntentCancelParams{})
+		params := &stripe.PaymentIntentCaptureParams{}
+		if amount > 0 {
+			params.AmountToCapture = stripe.Int64(amount)
+		}
+		if idemKey != "" {
+			params.SetIdempotencyKey(idemKey)
+		}
+		return paymentintent.Capture(piID, params)
 	})
 	return err
 }
 
-func (c *client) Refund(ctx context.Context, piID string) error {
+// Cancel cancela o PaymentIntent; um PaymentIntent já cancelado conta como
+// sucesso.
+func (c *client) Cancel(ctx context.Context, idemKey, piID string) error {
 	_, err := c.exec(ctx, func() (any, error) {
-		return refund.New(&stripe.RefundParams{PaymentIntent: stripe.String(piID)})
+		params := &stripe.PaymentIntentCancelParams{}
+		if idemKey != "" {
+			params.SetIdempotencyKey(idemKey)
+		}
+		return paymentintent.Cancel(piID, params)
 	})
+	var se *stripe.Error
+	if errors.As(err, &se) && se.Code == stripe.ErrorCodePaymentIntentUnexpectedState &&
+		se.PaymentIntent != nil && se.PaymentIntent.Status == stripe.PaymentIntentStatusCanceled {
+		return nil
+	}
 	return err
 }
 
+// Refund devolve amount do PaymentIntent; amount == 0 reembolsa o saldo restante.
+func (c *client) Refund(ctx context.Context, idemKey, piID string, amount int64, reason string) (string, error) {
+	res, err := c.exec(ctx, func() (any, error) {
+		params := &stripe.RefundParams{PaymentIntent: stripe.String(piID)}
+		if amount > 0 {
+			params.Amount = stripe.Int64(amount)
+		}
+		if reason != "" {
+			params.Reason = stripe.String(reason)
+		}
+		if idemKey != "" {
+			params.SetIdempotencyKey(idemKey)
+		}
+		return refund.New(params)
+	})
+	if err != nil {
+		return "", err
+	}
+	return res.(*stripe.Refund).ID, nil
+}
+
+// PaymentMethodOf lê o payment_method e o customer do PaymentIntent piID.
+func (c *client) PaymentMethodOf(ctx context.Context, piID string) (ports.PaymentMethodRef, error) {
+	res, err := c.exec(ctx, func() (any, error) {
+		return paymentintent.Get(piID, nil)
+	})
+	if err != nil {
+		return ports.PaymentMethodRef{}, err
+	}
+	pi := res.(*stripe.PaymentIntent)
+	var ref ports.PaymentMethodRef
+	if pi.PaymentMethod != nil {
+		ref.PaymentMethodID = pi.PaymentMethod.ID
+	}
+	if pi.Customer != nil {
+		ref.CustomerID = pi.Customer.ID
+	}
+	return ref, nil
+}
+
+// Card lê fingerprint, BIN (iin) e país emissor do cartão no payment_method
+// do PaymentIntent piID ou, sem PaymentIntent, no PaymentMethod pmID. Sem
+// cartão associado, devolve um Card vazio.
+func (c *client) Card(ctx context.Context, piID, pmID string) (payment.Card, error) {
+	res, err := c.exec(ctx, func() (any, error) {
+		if piID != "" {
+			params := &stripe.PaymentIntentParams{}
+			params.AddExpand("payment_method")
+			pi, err := paymentintent.Get(piID, params)
+			if err != nil {
+				return nil, err
+			}
+			return pi.PaymentMethod, nil
+		}
+		return paymentmethod.Get(pmID, nil)
+	})
+	if err != nil {
+		return payment.Card{}, err
+	}
+	pm, _ := res.(*stripe.PaymentMethod)
+	if pm == nil || pm.Card == nil {
+		return payment.Card{}, nil
+	}
+	return payment.Card{Fingerprint: pm.Card.Fingerprint, BIN: pm.Card.IIN, Country: pm.Card.Country}, nil
+}
+
 func (c *client) VerifyWebhookSignature(payload []byte, sigHeader string) (stripe.Event, error) {
 	if c.cfg.StripeWebhookSecret == "" {
 		return stripe.Event{}, errors.New("webhook signing secret not configured")
@@ -109,10 +258,34 @@ func (c *client) exec(ctx context.Context, fn func() (any, error)) (any, error)
 	}()
 	select {
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return nil, fmt.Errorf("%w: %w", ports.ErrGatewayFailed, ctx.Err())
 	case r := <-ch:
-		return r.v, r.err
+		return r.v, classify(r.err)
 	case <-time.After(c.cfg.RequestTimeout):
-		return nil, errors.New("stripe call timeout")
+		return nil, fmt.Errorf("%w: stripe call timeout", ports.ErrGatewayFailed)
 	}
 }
+
+// classify marca as falhas transitórias com ports.ErrGatewayFailed ou
+// ports.ErrGatewayUnavailable; os erros 4xx do Stripe (cartão, requisição
+// inválida) passam como estão.
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests) {
+		return fmt.Errorf("%w: %w", ports.ErrGatewayUnavailable, err)
+	}
+	var se *stripe.Error
+	if !errors.As(err, &se) {
+		return fmt.Errorf("%w: %w", ports.ErrGatewayFailed, err) // rede
+	}
+	switch code := se.HTTPStatusCode; {
+	case code == http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %w", ports.ErrGatewayUnavailable, err)
+	case code == http.StatusConflict, code >= http.StatusInternalServerError:
+		// 409 é lock_timeout ou chave de idempotência em uso
+		return fmt.Errorf("%w: %w", ports.ErrGatewayFailed, err)
+	}
+	return err
+}
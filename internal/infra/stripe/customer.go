@@ -0,0 +1,53 @@
+package stripeinfra
+
+import (
+	"context"
+	"errors"
+
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/customer"
+	"github.com/williamkoller/golang-payment-stripe/internal/app/ports"
+)
+
+func (c *client) CreateCustomer(ctx context.Context, in ports.CustomerInput) (string, error) {
+	if c.cfg.StripeSecretKey == "" {
+		return "", errors.New("stripe secret key not configured")
+	}
+	res, err := c.exec(ctx, func() (any, error) {
+		params := customerParams(in)
+		if in.IdemKey != "" {
+			params.SetIdempotencyKey(in.IdemKey)
+		}
+		return customer.New(params)
+	})
+	if err != nil {
+		return "", err
+	}
+	return res.(*stripe.Customer).ID, nil
+}
+
+func (c *client) UpdateCustomer(ctx context.Context, stripeCustomerID string, in ports.CustomerInput) error {
+	_, err := c.exec(ctx, func() (any, error) {
+		return customer.Update(stripeCustomerID, customerParams(in))
+	})
+	return err
+}
+
+func (c *client) DeleteCustomer(ctx context.Context, stripeCustomerID string) error {
+	_, err := c.exec(ctx, func() (any, error) {
+		return customer.Del(stripeCustomerID, &stripe.CustomerParams{})
+	})
+	return err
+}
+
+func customerParams(in ports.CustomerInput) *stripe.CustomerParams {
+	params := &stripe.CustomerParams{
+		Email: stripe.String(in.Email),
+		Name:  stripe.String(in.Name),
+		Phone: stripe.String(in.Phone),
+	}
+	for k, v := range in.Metadata {
+		params.AddMetadata(k, v)
+	}
+	return params
+}
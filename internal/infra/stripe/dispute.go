@@ -0,0 +1,41 @@
+package stripeinfra
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/dispute"
+	"github.com/stripe/stripe-go/v76/file"
+)
+
+func (c *client) UploadDisputeFile(ctx context.Context, filename string, r io.Reader) (string, error) {
+	if c.cfg.StripeSecretKey == "" {
+		return "", errors.New("stripe secret key not configured")
+	}
+	res, err := c.exec(ctx, func() (any, error) {
+		return file.New(&stripe.FileParams{
+			FileReader: r,
+			Filename:   stripe.String(filename),
+			Purpose:    stripe.String(string(stripe.FilePurposeDisputeEvidence)),
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+	return res.(*stripe.File).ID, nil
+}
+
+// UpdateDisputeEvidence envia evidence como evidence[campo]; os nomes dos
+// campos já foram validados pelo domínio.
+func (c *client) UpdateDisputeEvidence(ctx context.Context, stripeDisputeID string, evidence map[string]string, submit bool) error {
+	_, err := c.exec(ctx, func() (any, error) {
+		params := &stripe.DisputeParams{Submit: stripe.Bool(submit)}
+		for k, v := range evidence {
+			params.AddExtra("evidence["+k+"]", v)
+		}
+		return dispute.Update(stripeDisputeID, params)
+	})
+	return err
+}
@@ -0,0 +1,92 @@
+package velocity
+
+import (
+	"sync"
+	"time"
+)
+
+type hit struct {
+	at       time.Time
+	currency string
+	amount   int64
+}
+
+// Stats resume as tentativas de uma chave dentro da janela.
+type Stats struct {
+	Count int
+	Sum   int64 // só da moeda consultada
+}
+
+// Counter é uma janela deslizante em memória: guarda cada tentativa por
+// chave e descarta as que saíram da janela. Os contadores são do processo;
+// com várias instâncias cada uma conta as próprias tentativas.
+type Counter struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	hits      map[string][]hit
+	lastPrune time.Time
+}
+
+func NewCounter(window time.Duration) *Counter {
+	return &Counter{window: window, hits: make(map[string][]hit)}
+}
+
+func (c *Counter) Window() time.Duration { return c.window }
+
+// Hit registra uma tentativa de amount em key e devolve as estatísticas da
+// janela terminada em at, incluindo esta tentativa.
+func (c *Counter) Hit(key, currency string, amount int64, at time.Time) Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	since := at.Add(-c.window)
+	if at.Sub(c.lastPrune) >= c.window {
+		c.prune(since)
+		c.lastPrune = at
+	}
+
+	hs := append(trim(c.hits[key], since), hit{at: at, currency: currency, amount: amount})
+	c.hits[key] = hs
+	st := Stats{Count: len(hs)}
+	for _, h := range hs {
+		if h.currency == currency {
+			st.Sum += h.amount
+		}
+	}
+	return st
+}
+
+// Peek devolve as estatísticas da janela terminada em at sem registrar
+// tentativa.
+func (c *Counter) Peek(key, currency string, at time.Time) Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var st Stats
+	for _, h := range trim(c.hits[key], at.Add(-c.window)) {
+		st.Count++
+		if h.currency == currency {
+			st.Sum += h.amount
+		}
+	}
+	return st
+}
+
+// prune remove as chaves sem tentativas na janela.
+func (c *Counter) prune(since time.Time) {
+	for k, hs := range c.hits {
+		if hs = trim(hs, since); len(hs) == 0 {
+			delete(c.hits, k)
+		} else {
+			c.hits[k] = hs
+		}
+	}
+}
+
+// trim descarta as tentativas anteriores a since; hs está em ordem de chegada.
+func trim(hs []hit, since time.Time) []hit {
+	i := 0
+	for i < len(hs) && hs[i].at.Before(since) {
+		i++
+	}
+	return hs[i:]
+}
@@ -0,0 +1,116 @@
+package velocity
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/williamkoller/golang-payment-stripe/internal/domain/risk"
+)
+
+// Limit são os máximos de tentativas e de soma (na unidade menor, por moeda; "*"
+// vale para as demais) por chave na janela. Zero não limita.
+type Limit struct {
+	Count int
+	Sum   map[string]int64
+}
+
+func (l Limit) sumFor(currency string) int64 {
+	if v, ok := l.Sum[strings.ToLower(currency)]; ok {
+		return v
+	}
+	return l.Sum[risk.AnyCurrency]
+}
+
+type Limits struct {
+	Email Limit
+	IP    Limit
+	Card  Limit
+	// Action é aplicada ao estourar um limite: risk.Deny bloqueia,
+	// risk.Review sinaliza.
+	Action risk.Outcome
+}
+
+// rule conta as tentativas de uma dimensão (e-mail, IP, cartão) no Counter
+// compartilhado e objeta quando a janela passa do limite.
+type rule struct {
+	name   string
+	limit  Limit
+	action risk.Outcome
+	c      *Counter
+}
+
+// NewRules devolve as regras de velocidade por e-mail, IP do cliente e
+// fingerprint do cartão. Cada avaliação conta como uma tentativa.
+func NewRules(c *Counter, l Limits) []risk.Rule {
+	return []risk.Rule{
+		&rule{name: "velocity_email", limit: l.Email, action: l.Action, c: c},
+		&rule{name: "velocity_ip", limit: l.IP, action: l.Action, c: c},
+		&rule{name: "velocity_card", limit: l.Card, action: l.Action, c: c},
+	}
+}
+
+// CardCheck aplica a regra velocity_card a um cartão que só ficou conhecido
+// depois da autorização (confirmação no frontend), contando a tentativa na
+// mesma janela das regras de NewRules.
+type CardCheck struct {
+	r *rule
+}
+
+func NewCardCheck(c *Counter, l Limits) *CardCheck {
+	return &CardCheck{r: &rule{name: "velocity_card", limit: l.Card, action: l.Action, c: c}}
+}
+
+// Check conta a tentativa de in.CardFingerprint e devolve a objeção quando
+// a janela passa do limite.
+func (k *CardCheck) Check(in risk.Input) (risk.Reason, bool) {
+	out, msg := k.r.Evaluate(in)
+	return risk.Reason{Rule: k.r.name, Outcome: out, Message: msg}, out != risk.Allow
+}
+
+// key é o valor de in contado na dimensão; vazio não conta.
+func key(dimension string, in risk.Input) string {
+	switch dimension {
+	case "email":
+		return strings.ToLower(in.Email)
+	case "ip":
+		return in.ClientIP
+	case "card":
+		return in.CardFingerprint
+	}
+	return ""
+}
+
+// Dimensions são as chaves contadas pelas regras de NewRules.
+var Dimensions = []string{"email", "ip", "card"}
+
+// Lookup devolve a janela de in na dimensão (email, ip ou card) contada pelas
+// regras de NewRules, sem registrar tentativa. Avaliada depois delas, inclui
+// a tentativa atual.
+func Lookup(c *Counter, dimension string, in risk.Input) Stats {
+	k := key(dimension, in)
+	if k == "" {
+		return Stats{}
+	}
+	return c.Peek("velocity_"+dimension+":"+k, strings.ToLower(in.Currency), in.At)
+}
+
+func (r *rule) Name() string { return r.name }
+
+// dimension é o nome curto da chave (email, ip, card) usado em key e
+// nas mensagens.
+func (r *rule) dimension() string { return strings.TrimPrefix(r.name, "velocity_") }
+
+func (r *rule) Evaluate(in risk.Input) (risk.Outcome, string) {
+	k := key(r.dimension(), in)
+	if k == "" {
+		return risk.Allow, ""
+	}
+	st := r.c.Hit(r.name+":"+k, strings.ToLower(in.Currency), in.Amount, in.At)
+	if r.limit.Count > 0 && st.Count > r.limit.Count {
+		return r.action, fmt.Sprintf("%s: %d attempts in %s exceed limit %d", r.dimension(), st.Count, r.c.Window(), r.limit.Count)
+	}
+	if limit := r.limit.sumFor(in.Currency); limit > 0 && st.Sum > limit {
+		return r.action, fmt.Sprintf("%s: %s %d in %s exceeds limit %d", r.dimension(), in.Currency, st.Sum, r.c.Window(), limit)
+	}
+	return risk.Allow, ""
+}